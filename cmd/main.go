@@ -1,12 +1,12 @@
 package main
 
 import (
+	"log"
 	"time"
 
 	"github.com/dassajib/prohor-api/config"
 	"github.com/dassajib/prohor-api/internal/handler"
 	"github.com/dassajib/prohor-api/internal/middleware"
-	"github.com/dassajib/prohor-api/internal/model"
 	"github.com/dassajib/prohor-api/internal/repository"
 	"github.com/dassajib/prohor-api/internal/service"
 	"github.com/gin-contrib/cors"
@@ -17,27 +17,100 @@ func main() {
 	config.InitDB()
 	db := config.DB
 
-	// to auto migrate user model
-	db.AutoMigrate(&model.User{}, &model.Note{})
+	// to migrate all models and search index
+	if err := repository.Migrate(db); err != nil {
+		log.Fatalf("Failed to migrate db: %v", err)
+	}
 
 	// layered structure with dependency injection
 	userRepo := repository.NewUserRepository(db)
-	userService := service.NewUserService(userRepo)
-	userHandler := handler.NewUserHandler(&userService)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	userService := service.NewUserService(userRepo, refreshTokenRepo)
+	revokedTokenRepo := repository.NewRevokedTokenRepository(db)
+	revocationService, err := service.NewTokenRevocationService(revokedTokenRepo, userRepo, refreshTokenRepo)
+	if err != nil {
+		log.Fatalf("Failed to load revoked tokens: %v", err)
+	}
+	userHandler := handler.NewUserHandler(&userService, revocationService)
+
+	accessTokenService := service.NewAccessTokenService(repository.NewAccessTokenRepository(db))
+	accessTokenHandler := handler.NewAccessTokenHandler(accessTokenService)
+
+	tagRepo := repository.NewTagRepository(db)
+	tagService := service.NewTagService(tagRepo)
+	tagHandler := handler.NewTagHandler(tagService)
 
 	noteRepo := repository.NewNoteRepository(db)
-	noteService := service.NewNoteService(noteRepo)
+	notebookRepo := repository.NewNotebookRepository(db)
+	revisionRepo := repository.NewNoteRevisionRepository(db)
+	shareRepo := repository.NewNoteShareRepository(db)
+	noteLinkRepo := repository.NewNoteLinkRepository(db)
+	noteEvents := service.NewNoteEventBus()
+	noteService := service.NewNoteService(noteRepo, tagRepo, notebookRepo, revisionRepo, shareRepo, noteLinkRepo, repository.NewTransactor(db), service.NewNotePolicy(shareRepo), noteEvents, service.NoteSettings{
+		TrashRetention:      config.TrashRetention(),
+		MaxRevisionsPerUser: config.GetEnvInt("MAX_REVISIONS_PER_USER", 1000),
+	})
 	noteHandler := handler.NewNoteHandler(noteService)
 
+	// frontends allowed to call the api, also checked on websocket upgrades
+	allowedOrigins := []string{"http://localhost:5173"}
+	collabService := service.NewCollabService(noteService, noteRepo, userRepo, 5*time.Second)
+	collabHandler := handler.NewCollabHandler(collabService, allowedOrigins)
+	eventHandler := handler.NewNoteEventHandler(noteEvents)
+
+	noteLinkHandler := handler.NewNoteLinkHandler(service.NewNoteLinkService(noteLinkRepo, noteService))
+
+	checklistService := service.NewChecklistService(repository.NewChecklistRepository(db), noteService)
+	checklistHandler := handler.NewChecklistHandler(checklistService)
+
+	// reminders fire over the event streams of the note's owner
+	reminderService := service.NewReminderService(noteRepo, service.NewEventNotifier(noteEvents))
+	reminderHandler := handler.NewReminderHandler(reminderService)
+
+	calendarService := service.NewCalendarService(repository.NewCalendarTokenRepository(db), noteRepo)
+	calendarHandler := handler.NewCalendarHandler(calendarService)
+
+	shareService := service.NewNoteShareService(shareRepo, userRepo, noteService, collabService)
+	shareHandler := handler.NewNoteShareHandler(shareService)
+
+	shareLinkRepo := repository.NewShareLinkRepository(db)
+	shareLinkService := service.NewShareLinkService(shareLinkRepo, noteService, noteRepo)
+	shareLinkHandler := handler.NewShareLinkHandler(shareLinkService)
+
+	syncService := service.NewSyncService(noteService, noteRepo, repository.NewNoteTombstoneRepository(db))
+	syncHandler := handler.NewSyncHandler(syncService)
+
+	revisionService := service.NewNoteRevisionService(revisionRepo, noteService)
+	revisionHandler := handler.NewNoteRevisionHandler(revisionService)
+
+	// attachment files live outside the database, on disk or in a bucket
+	store, err := config.InitStorage()
+	if err != nil {
+		log.Fatalf("Failed to init storage: %v", err)
+	}
+	maxAttachmentSize := int64(config.GetEnvInt("ATTACHMENT_MAX_MB", 20)) << 20
+	attachmentService := service.NewAttachmentService(repository.NewAttachmentRepository(db), store, noteService, service.AttachmentSettings{
+		MaxFileSize: maxAttachmentSize,
+		UserQuota:   int64(config.GetEnvInt("STORAGE_QUOTA_MB", 500)) << 20,
+	})
+	attachmentHandler := handler.NewAttachmentHandler(attachmentService, maxAttachmentSize)
+
+	exportHandler := handler.NewExportHandler(service.NewExportService(noteService), int64(config.GetEnvInt("IMPORT_MAX_MB", 50))<<20)
+	importJobService := service.NewImportJobService(repository.NewImportJobRepository(db), store, noteService)
+	importJobHandler := handler.NewImportJobHandler(importJobService, int64(config.GetEnvInt("IMPORT_JOB_MAX_MB", 500))<<20)
+
+	notebookService := service.NewNotebookService(notebookRepo, noteRepo, noteService, config.TrashRetention())
+	notebookHandler := handler.NewNotebookHandler(notebookService)
+
 	// to initialize gin router with default middleware
 	r := gin.Default()
 
 	// CORS config
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:5173"},
+		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "If-Match", "X-Share-Password"},
+		ExposeHeaders:    []string{"Content-Length", "ETag", "Content-Disposition"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -45,21 +118,152 @@ func main() {
 	// handler func call after call api route
 	r.POST("/register", userHandler.Register)
 	r.POST("/login", userHandler.Login)
+	r.POST("/refresh", userHandler.Refresh)
+
+	// public share links, the token is the only credential
+	r.GET("/s/:token", shareLinkHandler.OpenLink)
+
+	// calendar subscriptions, the url is the credential: /calendar/<token>.ics
+	r.GET("/calendar/:file", calendarHandler.Feed)
+
+	// logout routes need a valid access token from a login
+	authGroup := r.Group("/")
+	authGroup.Use(middleware.AuthMiddleware(revocationService, accessTokenService), middleware.RequireSession())
+	{
+		authGroup.POST("/logout", userHandler.Logout)
+		authGroup.POST("/logout-all", userHandler.LogoutAll)
+	}
+
+	// websocket for live editing, registered outside the note group because of its own auth
+	r.GET("/api/notes/:id/collab", middleware.WebSocketAuthMiddleware(revocationService), collabHandler.Connect)
 
 	// note routes after checking authorized or not
 	noteGroup := r.Group("/api/notes")
-	noteGroup.Use(middleware.AuthMiddleware())
+	noteGroup.Use(middleware.AuthMiddleware(revocationService, accessTokenService), middleware.RequireScopeByMethod(service.ScopeNotesWrite))
 	{
 		noteGroup.POST("/", noteHandler.CreateNote)
 		noteGroup.GET("/", noteHandler.GetUserNotes)
+		noteGroup.GET("/shared", noteHandler.GetSharedNotes)
+		noteGroup.GET("/events", eventHandler.Stream)
+		noteGroup.GET("/trash", noteHandler.GetTrash)
+		noteGroup.GET("/archived", noteHandler.GetArchivedNotes)
+		noteGroup.GET("/graph", noteLinkHandler.Graph)
+		noteGroup.GET("/upcoming", reminderHandler.Upcoming)
+		noteGroup.GET("/overdue", reminderHandler.Overdue)
+		noteGroup.DELETE("/trash", noteHandler.EmptyTrash)
+		noteGroup.GET("/:id", noteHandler.GetNote)
 		noteGroup.PUT("/:id", noteHandler.UpdateNote)
 		noteGroup.DELETE("/:id", noteHandler.DeleteNote)
 		noteGroup.PUT("/:id/restore", noteHandler.RestoreNote)
 		noteGroup.DELETE("/:id/permanent", noteHandler.DeleteNotePermanent)
 		noteGroup.GET("/search", noteHandler.SearchNotes)
 		noteGroup.PUT("/:id/pin", noteHandler.TogglePin)
+		noteGroup.PUT("/:id/archive", noteHandler.ArchiveNote)
+		noteGroup.PUT("/:id/unarchive", noteHandler.UnarchiveNote)
+		noteGroup.PUT("/:id/move", noteHandler.MoveNote)
+		noteGroup.GET("/:id/backlinks", noteLinkHandler.Backlinks)
+		noteGroup.GET("/:id/revisions", revisionHandler.ListRevisions)
+		noteGroup.GET("/:id/revisions/diff", revisionHandler.DiffRevisions)
+		noteGroup.GET("/:id/revisions/:rev", revisionHandler.GetRevision)
+		noteGroup.POST("/:id/revisions/:rev/restore", revisionHandler.RestoreRevision)
+		noteGroup.GET("/:id/shares", shareHandler.ListShares)
+		noteGroup.POST("/:id/shares", shareHandler.ShareNote)
+		noteGroup.DELETE("/:id/shares/:userId", shareHandler.RevokeShare)
+		noteGroup.GET("/:id/links", shareLinkHandler.ListLinks)
+		noteGroup.POST("/:id/links", shareLinkHandler.CreateLink)
+		noteGroup.DELETE("/:id/links/:linkId", shareLinkHandler.RevokeLink)
+		noteGroup.GET("/:id/items", checklistHandler.ListItems)
+		noteGroup.POST("/:id/items", checklistHandler.AddItem)
+		noteGroup.PUT("/:id/items/order", checklistHandler.ReorderItems)
+		noteGroup.PUT("/:id/items/:itemId", checklistHandler.UpdateItem)
+		noteGroup.DELETE("/:id/items/:itemId", checklistHandler.DeleteItem)
+		noteGroup.GET("/:id/attachments", attachmentHandler.ListAttachments)
+		noteGroup.POST("/:id/attachments", attachmentHandler.UploadAttachment)
+		noteGroup.GET("/:id/attachments/:attachmentId", attachmentHandler.DownloadAttachment)
+		noteGroup.DELETE("/:id/attachments/:attachmentId", attachmentHandler.DeleteAttachment)
 	}
 
+	// delta sync for offline clients
+	syncGroup := r.Group("/api/sync")
+	syncGroup.Use(middleware.AuthMiddleware(revocationService, accessTokenService), middleware.RequireScopeByMethod(service.ScopeNotesWrite))
+	{
+		syncGroup.GET("", syncHandler.Pull)
+		syncGroup.POST("", syncHandler.Push)
+	}
+
+	// backups and migration of all of the caller's notes
+	exportGroup := r.Group("/api")
+	exportGroup.Use(middleware.AuthMiddleware(revocationService, accessTokenService), middleware.RequireScopeByMethod(service.ScopeNotesWrite))
+	{
+		exportGroup.GET("/export", exportHandler.Export)
+		exportGroup.POST("/import", exportHandler.Import)
+		exportGroup.POST("/import/jobs", importJobHandler.StartImport)
+		exportGroup.GET("/import/jobs", importJobHandler.ListImports)
+		exportGroup.GET("/import/jobs/:id", importJobHandler.GetImport)
+	}
+
+	// personal access tokens for scripts, only a login can manage them
+	tokenGroup := r.Group("/api/tokens")
+	tokenGroup.Use(middleware.AuthMiddleware(revocationService, accessTokenService), middleware.RequireSession())
+	{
+		tokenGroup.GET("", accessTokenHandler.ListTokens)
+		tokenGroup.POST("", accessTokenHandler.CreateToken)
+		tokenGroup.DELETE("/:id", accessTokenHandler.RevokeToken)
+	}
+
+	// managing the calendar feed url
+	calendarGroup := r.Group("/api/calendar")
+	calendarGroup.Use(middleware.AuthMiddleware(revocationService, accessTokenService), middleware.RequireSession())
+	{
+		calendarGroup.POST("/token", calendarHandler.RegenerateToken)
+		calendarGroup.DELETE("/token", calendarHandler.DeleteToken)
+	}
+
+	// notebook routes, nesting is expressed through parent_id
+	notebookGroup := r.Group("/api/notebooks")
+	notebookGroup.Use(middleware.AuthMiddleware(revocationService, accessTokenService), middleware.RequireScopeByMethod(service.ScopeNotebooksWrite))
+	{
+		notebookGroup.GET("/", notebookHandler.ListNotebooks)
+		notebookGroup.POST("/", notebookHandler.CreateNotebook)
+		notebookGroup.GET("/:id/contents", notebookHandler.GetContents)
+		notebookGroup.PUT("/:id", notebookHandler.RenameNotebook)
+		notebookGroup.PUT("/:id/move", notebookHandler.MoveNotebook)
+		notebookGroup.DELETE("/:id", notebookHandler.DeleteNotebook)
+		notebookGroup.PUT("/:id/restore", notebookHandler.RestoreNotebook)
+	}
+
+	// tag routes, same auth as notes
+	tagGroup := r.Group("/api/tags")
+	tagGroup.Use(middleware.AuthMiddleware(revocationService, accessTokenService), middleware.RequireScopeByMethod(service.ScopeTagsWrite))
+	{
+		tagGroup.GET("/", tagHandler.ListTags)
+		tagGroup.POST("/", tagHandler.CreateTag)
+		tagGroup.PUT("/:id", tagHandler.UpdateTag)
+		tagGroup.POST("/:id/merge", tagHandler.MergeTag)
+		tagGroup.DELETE("/:id", tagHandler.DeleteTag)
+	}
+
+	// expired revocations are useless, clean them up every hour
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := revocationService.PurgeExpired(); err != nil {
+				log.Printf("Failed to purge revoked tokens: %v", err)
+			}
+		}
+	}()
+
+	// notes past the trash retention window are deleted for good, their attachments with them
+	go service.NewTrashPurger(noteService, notebookService, attachmentService, time.Hour).Run()
+
+	// due reminders are checked twice a minute
+	go service.NewReminderScheduler(reminderService, 30*time.Second).Run()
+
+	// collaborative edits are written to the notes every few seconds
+	go collabService.Run()
+
+	// Evernote and Keep imports run one at a time in the background
+	go importJobService.Run()
+
 	// serve port on this address
 	r.Run(":8080")
 }
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
+	"github.com/dassajib/prohor-api/internal/pkg/storage"
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -36,3 +39,44 @@ func InitDB() {
 
 	DB = db
 }
+
+// reads an integer env variable, falls back when it's missing or not a number
+func GetEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// number of days a soft-deleted note stays restorable (TRASH_RETENTION_DAYS, default 30)
+func TrashRetention() time.Duration {
+	return time.Duration(GetEnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+}
+
+// reads a string env variable, falls back when it's missing
+func GetEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// attachment storage picked by STORAGE_BACKEND: "local" (default, files below STORAGE_DIR)
+// or "s3" (any S3 compatible service configured through the S3_* variables)
+func InitStorage() (storage.Storage, error) {
+	switch backend := GetEnv("STORAGE_BACKEND", "local"); backend {
+	case "local":
+		return storage.NewLocal(GetEnv("STORAGE_DIR", "./uploads"))
+	case "s3":
+		return storage.NewS3(storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    GetEnv("S3_REGION", "us-east-1"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// longest lifetime a token can be created with, tokens without expires_in_days never expire
+const maxAccessTokenDays = 3650
+
+type AccessTokenHandler struct {
+	// uses the access token service layer
+	service service.AccessTokenService
+}
+
+// constructor for AccessTokenHandler
+func NewAccessTokenHandler(service service.AccessTokenService) *AccessTokenHandler {
+	return &AccessTokenHandler{service}
+}
+
+// response item for a personal access token, the hash stays internal
+type accessTokenItem struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func newAccessTokenItem(token *model.AccessToken) accessTokenItem {
+	return accessTokenItem{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     token.Scopes,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+// creates a token, the response is the only time the token itself is shown
+func (h *AccessTokenHandler) CreateToken(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var body struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		// leave out for a token that never expires
+		ExpiresInDays int `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+	if body.ExpiresInDays < 0 || body.ExpiresInDays > maxAccessTokenDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must be between 1 and 3650"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if body.ExpiresInDays > 0 {
+		at := time.Now().AddDate(0, 0, body.ExpiresInDays)
+		expiresAt = &at
+	}
+
+	token, accessToken, err := h.service.Create(userID, body.Name, body.Scopes, expiresAt)
+	if err != nil {
+		respondAccessTokenError(c, err, "could not create token")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":        token,
+		"access_token": newAccessTokenItem(accessToken),
+	})
+}
+
+// lists the caller's tokens without the tokens themselves
+func (h *AccessTokenHandler) ListTokens(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	tokens, err := h.service.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch tokens"})
+		return
+	}
+
+	items := make([]accessTokenItem, 0, len(tokens))
+	for i := range tokens {
+		items = append(items, newAccessTokenItem(&tokens[i]))
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// revokes a token right away
+func (h *AccessTokenHandler) RevokeToken(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	tokenID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid token ID"})
+		return
+	}
+
+	if err := h.service.Revoke(userID, tokenID); err != nil {
+		respondAccessTokenError(c, err, "could not revoke token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "token revoked"})
+}
+
+func respondAccessTokenError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrAccessTokenNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidAccessTokenName),
+		errors.Is(err, service.ErrInvalidScope),
+		errors.Is(err, service.ErrInvalidTokenExpiry),
+		errors.Is(err, service.ErrAccessTokenLimit):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
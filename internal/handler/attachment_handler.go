@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// room for the multipart headers around the file itself
+const multipartOverhead = 1 << 20
+
+type AttachmentHandler struct {
+	// uses the attachment service layer
+	service service.AttachmentService
+	// largest file accepted, bodies above it are cut off while reading
+	maxFileSize int64
+}
+
+// constructor for AttachmentHandler
+func NewAttachmentHandler(service service.AttachmentService, maxFileSize int64) *AttachmentHandler {
+	return &AttachmentHandler{service, maxFileSize}
+}
+
+// response item for an attachment, the storage key stays internal
+type attachmentItem struct {
+	ID          uint      `json:"id"`
+	NoteID      uint      `json:"note_id"`
+	UploadedBy  uint      `json:"uploaded_by"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newAttachmentItem(attachment *model.Attachment) attachmentItem {
+	return attachmentItem{
+		ID:          attachment.ID,
+		NoteID:      attachment.NoteID,
+		UploadedBy:  attachment.UploadedBy,
+		FileName:    attachment.FileName,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		Checksum:    attachment.Checksum,
+		CreatedAt:   attachment.CreatedAt,
+	}
+}
+
+// uploads a multipart form with the file in the "file" field
+func (h *AttachmentHandler) UploadAttachment(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxFileSize+multipartOverhead)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": service.ErrAttachmentTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not read file"})
+		return
+	}
+	defer file.Close()
+
+	attachment, err := h.service.Upload(c.Request.Context(), userID, noteID, header.Filename, file, header.Size)
+	if err != nil {
+		h.respondError(c, userID, err, "could not upload attachment")
+		return
+	}
+
+	c.JSON(http.StatusCreated, newAttachmentItem(attachment))
+}
+
+// lists the attachments of a note
+func (h *AttachmentHandler) ListAttachments(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	attachments, err := h.service.List(userID, noteID)
+	if err != nil {
+		h.respondError(c, userID, err, "could not fetch attachments")
+		return
+	}
+
+	items := make([]attachmentItem, 0, len(attachments))
+	for i := range attachments {
+		items = append(items, newAttachmentItem(&attachments[i]))
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// streams the file, always as a download so an uploaded file can't run in our origin
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, attachmentID, ok := parseAttachmentParams(c)
+	if !ok {
+		return
+	}
+
+	attachment, file, err := h.service.Open(c.Request.Context(), userID, noteID, attachmentID)
+	if err != nil {
+		h.respondError(c, userID, err, "could not fetch attachment")
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", attachment.ContentType)
+	c.Header("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, no-cache")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, file); err != nil {
+		// headers are out already, all we can do is note it
+		log.Printf("Failed to stream attachment %d: %v", attachment.ID, err)
+	}
+}
+
+// deletes an attachment together with its file
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, attachmentID, ok := parseAttachmentParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), userID, noteID, attachmentID); err != nil {
+		h.respondError(c, userID, err, "could not delete attachment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "attachment deleted"})
+}
+
+// note and attachment id of the route, answers 400 itself when one is invalid
+func parseAttachmentParams(c *gin.Context) (uint, uint, bool) {
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return 0, 0, false
+	}
+	attachmentID, ok := parseIDParam(c, "attachmentId")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment ID"})
+		return 0, 0, false
+	}
+	return noteID, attachmentID, true
+}
+
+// maps attachment service errors to a response, note errors are handled like everywhere else
+func (h *AttachmentHandler) respondError(c *gin.Context, userID uint, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrAttachmentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAttachmentEmpty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAttachmentTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAttachmentType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrStorageQuotaReached):
+		// usage is only shown for the caller's own notes
+		used, quota, usageErr := h.service.Usage(userID)
+		if usageErr != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "used": used, "quota": quota})
+	default:
+		respondNoteError(c, err, fallback)
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type CalendarHandler struct {
+	// uses the calendar service layer
+	service service.CalendarService
+}
+
+// constructor for CalendarHandler
+func NewCalendarHandler(service service.CalendarService) *CalendarHandler {
+	return &CalendarHandler{service}
+}
+
+// creates a new feed url, the old one stops working
+func (h *CalendarHandler) RegenerateToken(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	token, err := h.service.RegenerateToken(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create calendar feed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": token, "path": "/calendar/" + token + ".ics"})
+}
+
+// turns the feed off
+func (h *CalendarHandler) DeleteToken(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	if err := h.service.DeleteToken(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete calendar feed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "calendar feed deleted"})
+}
+
+// public route for calendar apps, /calendar/<token>.ics?tag=work limits the feed to tagged notes
+// gin params can't have a suffix, so the whole file name is read and .ics cut off
+func (h *CalendarHandler) Feed(c *gin.Context) {
+	token, ok := strings.CutSuffix(c.Param("file"), ".ics")
+	if !ok || token == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrCalendarNotFound.Error()})
+		return
+	}
+
+	feed, err := h.service.Feed(token, c.QueryArray("tag"))
+	if errors.Is(err, service.ErrCalendarNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not render calendar"})
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="prohor.ics"`)
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(feed))
+}
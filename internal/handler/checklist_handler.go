@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type ChecklistHandler struct {
+	// uses the checklist service layer
+	service service.ChecklistService
+}
+
+// constructor for ChecklistHandler
+func NewChecklistHandler(service service.ChecklistService) *ChecklistHandler {
+	return &ChecklistHandler{service}
+}
+
+// response item for a checklist entry
+type checklistItem struct {
+	ID        uint      `json:"id"`
+	NoteID    uint      `json:"note_id"`
+	Text      string    `json:"text"`
+	Checked   bool      `json:"checked"`
+	Position  int       `json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newChecklistItem(item *model.ChecklistItem) checklistItem {
+	return checklistItem{
+		ID:        item.ID,
+		NoteID:    item.NoteID,
+		Text:      item.Text,
+		Checked:   item.Checked,
+		Position:  item.Position,
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.UpdatedAt,
+	}
+}
+
+func newChecklistItems(items []model.ChecklistItem) []checklistItem {
+	res := make([]checklistItem, 0, len(items))
+	for i := range items {
+		res = append(res, newChecklistItem(&items[i]))
+	}
+	return res
+}
+
+// lists the checklist of a note in order
+func (h *ChecklistHandler) ListItems(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	items, err := h.service.List(userID, noteID)
+	if err != nil {
+		respondChecklistError(c, err, "could not fetch checklist")
+		return
+	}
+
+	c.JSON(http.StatusOK, newChecklistItems(items))
+}
+
+// adds an item, without "position" it goes to the end
+func (h *ChecklistHandler) AddItem(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	var body struct {
+		Text     string `json:"text"`
+		Checked  bool   `json:"checked"`
+		Position *int   `json:"position"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	item, err := h.service.Add(userID, noteID, body.Text, body.Checked, body.Position)
+	if err != nil {
+		respondChecklistError(c, err, "could not add checklist item")
+		return
+	}
+
+	c.JSON(http.StatusCreated, newChecklistItem(item))
+}
+
+// changes the text or ticks an item off, {"checked": true} is all a toggle needs
+func (h *ChecklistHandler) UpdateItem(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, itemID, ok := parseChecklistParams(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Text    *string `json:"text"`
+		Checked *bool   `json:"checked"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	item, err := h.service.Update(userID, noteID, itemID, body.Text, body.Checked)
+	if err != nil {
+		respondChecklistError(c, err, "could not update checklist item")
+		return
+	}
+
+	c.JSON(http.StatusOK, newChecklistItem(item))
+}
+
+// removes an item
+func (h *ChecklistHandler) DeleteItem(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, itemID, ok := parseChecklistParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(userID, noteID, itemID); err != nil {
+		respondChecklistError(c, err, "could not delete checklist item")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "checklist item deleted"})
+}
+
+// sets the order of all items, body is {"item_ids": [3, 1, 2]}
+func (h *ChecklistHandler) ReorderItems(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	var body struct {
+		ItemIDs []uint `json:"item_ids"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	items, err := h.service.Reorder(userID, noteID, body.ItemIDs)
+	if err != nil {
+		respondChecklistError(c, err, "could not reorder checklist")
+		return
+	}
+
+	c.JSON(http.StatusOK, newChecklistItems(items))
+}
+
+// note and item id of the route, answers 400 itself when one is invalid
+func parseChecklistParams(c *gin.Context) (uint, uint, bool) {
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return 0, 0, false
+	}
+	itemID, ok := parseIDParam(c, "itemId")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid item ID"})
+		return 0, 0, false
+	}
+	return noteID, itemID, true
+}
+
+// maps checklist service errors to a response, note errors are handled like everywhere else
+func respondChecklistError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrChecklistItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidChecklistItem),
+		errors.Is(err, service.ErrChecklistFull),
+		errors.Is(err, service.ErrInvalidChecklistOrder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondNoteError(c, err, fallback)
+	}
+}
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/middleware"
+	"github.com/dassajib/prohor-api/internal/pkg/ot"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// websocket timings and limits
+const (
+	collabWriteWait  = 10 * time.Second
+	collabPongWait   = 60 * time.Second
+	collabPingPeriod = 50 * time.Second
+	collabMaxMessage = 1 << 20
+)
+
+// sent back when a client message couldn't be applied
+const collabMessageError = "error"
+
+var errUnknownCollabMessage = errors.New("unknown message type")
+
+type CollabHandler struct {
+	// uses the collaboration service layer
+	service service.CollabService
+	// origins allowed to open a socket, same list as CORS
+	upgrader websocket.Upgrader
+}
+
+// constructor for CollabHandler
+func NewCollabHandler(service service.CollabService, allowedOrigins []string) *CollabHandler {
+	return &CollabHandler{
+		service: service,
+		upgrader: websocket.Upgrader{
+			// a browser sends the token along from any page, so only trusted pages may connect
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				return origin == "" || slices.Contains(allowedOrigins, origin)
+			},
+		},
+	}
+}
+
+// what clients send over the socket
+// {"type":"op","rev":3,"op":[5,"hi",-2]} is an ot.js operation made on top of revision 3
+// {"type":"cursor","rev":3,"cursor":{"position":7,"selection_end":7}} shares the cursor
+type collabClientMessage struct {
+	Type   string                `json:"type"`
+	Rev    int                   `json:"rev"`
+	Op     *ot.Operation         `json:"op"`
+	Cursor *service.CollabCursor `json:"cursor"`
+}
+
+// upgrades to a websocket for live editing of a note's content
+// the socket is closed when the access token expires or is revoked, clients reconnect with a fresh one
+func (h *CollabHandler) Connect(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	expiresAt, _ := c.Get("token_expires_at")
+	tokenValid, _ := c.Get("token_valid")
+	stillValid, _ := tokenValid.(middleware.TokenCheck)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	// access is checked before upgrading so errors are plain http responses
+	session, err := h.service.Join(userID, noteID)
+	if err != nil {
+		respondNoteError(c, err, "could not join note")
+		return
+	}
+	defer session.Leave()
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader already answered the request
+		return
+	}
+	defer conn.Close()
+
+	var expired <-chan time.Time
+	if at, ok := expiresAt.(time.Time); ok {
+		timer := time.NewTimer(time.Until(at))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	// gorilla allows one writer at a time, so errors of the read loop go through the write loop
+	errs := make(chan service.CollabMessage, 8)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.readLoop(conn, session, errs)
+	}()
+
+	ping := time.NewTicker(collabPingPeriod)
+	defer ping.Stop()
+
+	for {
+		var msg any
+		select {
+		case <-done:
+			return
+		case <-expired:
+			writeClose(conn, websocket.ClosePolicyViolation, "access token expired")
+			return
+		case <-ping.C:
+			// a logout ends the session within one ping period
+			if stillValid != nil && !stillValid() {
+				writeClose(conn, websocket.ClosePolicyViolation, "access token revoked")
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+			continue
+		case m := <-errs:
+			msg = m
+		case m, ok := <-session.Messages():
+			if !ok {
+				// room closed or the client fell too far behind
+				writeClose(conn, websocket.CloseGoingAway, "session ended")
+				return
+			}
+			msg = m
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(collabWriteWait))
+		if err := conn.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+}
+
+// reads client messages until the socket breaks
+func (h *CollabHandler) readLoop(conn *websocket.Conn, session *service.CollabSession, errs chan<- service.CollabMessage) {
+	conn.SetReadLimit(collabMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(collabPongWait))
+	})
+
+	for {
+		var msg collabClientMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			// not the json we expect, the socket itself is still fine
+			if isDecodeError(err) {
+				sendCollabError(errs, msg.Rev, "invalid message")
+				continue
+			}
+			return
+		}
+
+		var err error
+		switch {
+		case msg.Type == service.CollabMessageOp && msg.Op != nil:
+			err = session.Edit(msg.Rev, msg.Op)
+		case msg.Type == service.CollabMessageCursor && msg.Cursor != nil:
+			err = session.MoveCursor(msg.Rev, *msg.Cursor)
+		default:
+			err = errUnknownCollabMessage
+		}
+		if err != nil {
+			sendCollabError(errs, msg.Rev, collabErrorText(err))
+		}
+	}
+}
+
+// error message for the client, dropped if the client isn't reading anyway
+func sendCollabError(errs chan<- service.CollabMessage, rev int, text string) {
+	select {
+	case errs <- service.CollabMessage{Type: collabMessageError, Rev: rev, Error: text}:
+	default:
+	}
+}
+
+// service errors are safe to show, anything else is hidden
+func collabErrorText(err error) string {
+	switch {
+	case errors.Is(err, service.ErrForbidden),
+		errors.Is(err, service.ErrCollabRevision),
+		errors.Is(err, service.ErrCollabOperation),
+		errors.Is(err, service.ErrCollabClosed),
+		errors.Is(err, errUnknownCollabMessage):
+		return err.Error()
+	default:
+		return "could not apply message"
+	}
+}
+
+// json errors leave the connection usable, io errors don't
+func isDecodeError(err error) bool {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || errors.Is(err, ot.ErrMalformed)
+}
+
+// best effort close frame before the connection is dropped
+func writeClose(conn *websocket.Conn, code int, text string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(collabWriteWait))
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// note version as a strong ETag, e.g. "7"
+func noteETag(note *model.Note) string {
+	return `"` + strconv.FormatUint(uint64(note.Version), 10) + `"`
+}
+
+// sends the note's current version so the client can send it back in If-Match
+func setNoteETag(c *gin.Context, note *model.Note) {
+	c.Header("ETag", noteETag(note))
+}
+
+// reads the version from If-Match, responds 428 when it's missing and 400 when it isn't one of our ETags
+// "*" gives service.AnyVersion, the change goes through whatever the current version is
+func requireIfMatch(c *gin.Context) (uint, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "If-Match header with the note's ETag is required"})
+		return 0, false
+	}
+	if header == "*" {
+		return service.AnyVersion, true
+	}
+	// If-Match compares strongly, a weak tag could never match
+	if strings.HasPrefix(header, "W/") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "If-Match needs a strong ETag"})
+		return 0, false
+	}
+
+	// only a single strong ETag makes sense for a single note, a bare version is accepted too
+	value := header
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+	version, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || version == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid If-Match header"})
+		return 0, false
+	}
+	return uint(version), true
+}
+
+// 412 with the server's copy, so the client can merge and retry with the new ETag
+func respondVersionConflict(c *gin.Context, current *model.Note) {
+	setNoteETag(c, current)
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error": "note was modified in the meantime",
+		"note":  current,
+	})
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestIfMatch(t *testing.T) {
+	routes := []struct {
+		name   string
+		noteID uint
+		suffix string
+		body   string
+	}{
+		{"update", liveNoteID, "", `{"title":"Shopping"}`},
+		{"pin", liveNoteID, "/pin", `{"pinned":true}`},
+		{"archive", liveNoteID, "/archive", ""},
+		{"restore", trashedNoteID, "/restore", ""},
+	}
+	headers := []struct {
+		name    string
+		ifMatch string
+		want    int
+	}{
+		{"current ETag", `"1"`, http.StatusOK},
+		{"current version unquoted", `1`, http.StatusOK},
+		{"any version", `*`, http.StatusOK},
+		{"stale ETag", `"7"`, http.StatusPreconditionFailed},
+		{"weak ETag", `W/"1"`, http.StatusBadRequest},
+		{"lowercase weak prefix", `w/"1"`, http.StatusBadRequest},
+		{"several ETags", `"1", "2"`, http.StatusBadRequest},
+		{"unbalanced quotes", `"1`, http.StatusBadRequest},
+		{"zero", `"0"`, http.StatusBadRequest},
+		{"not a version", `"abc"`, http.StatusBadRequest},
+	}
+	for _, route := range routes {
+		for _, header := range headers {
+			t.Run(route.name+"/"+header.name, func(t *testing.T) {
+				r, _ := newNoteFixture(t)
+				path := "/api/notes/" + strconv.Itoa(int(route.noteID)) + route.suffix
+				w := doNoteRequest(r, ownerID, http.MethodPut, path, route.body, header.ifMatch)
+				if w.Code != header.want {
+					t.Fatalf("PUT %s with If-Match %s = %d, want %d: %s", path, header.ifMatch, w.Code, header.want, w.Body)
+				}
+				if header.want == http.StatusOK {
+					if etag := w.Header().Get("ETag"); etag != `"2"` {
+						t.Errorf("ETag = %s, want the bumped version", etag)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type ExportHandler struct {
+	// uses the export service layer
+	service service.ExportService
+	// largest zip accepted by an import
+	maxImportSize int64
+}
+
+// constructor for ExportHandler
+func NewExportHandler(service service.ExportService, maxImportSize int64) *ExportHandler {
+	return &ExportHandler{service, maxImportSize}
+}
+
+// response for an import, files are listed in archive order
+type importReportResponse struct {
+	Imported int                  `json:"imported"`
+	Failed   int                  `json:"failed"`
+	Files    []importFileResponse `json:"files"`
+}
+
+type importFileResponse struct {
+	File   string `json:"file"`
+	NoteID uint   `json:"note_id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func newImportReportResponse(report *service.ImportReport) importReportResponse {
+	res := importReportResponse{
+		Imported: report.Imported,
+		Failed:   report.Failed,
+		Files:    make([]importFileResponse, 0, len(report.Files)),
+	}
+	for _, file := range report.Files {
+		res.Files = append(res.Files, importFileResponse{File: file.File, NoteID: file.NoteID, Error: file.Error})
+	}
+	return res
+}
+
+// streams a zip of the caller's notes, markdown is the only format so far
+func (h *ExportHandler) Export(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	if format := c.DefaultQuery("format", "markdown"); format != "markdown" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be markdown"})
+		return
+	}
+
+	fileName := "prohor-notes-" + time.Now().Format("2006-01-02") + ".zip"
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	c.Header("Cache-Control", "private, no-cache")
+	c.Status(http.StatusOK)
+
+	// the status is already sent, a failure can only cut the download short
+	if err := h.service.Export(userID, c.Writer); err != nil {
+		log.Printf("Failed to export notes of user %d: %v", userID, err)
+		c.Abort()
+	}
+}
+
+// creates notes from a zip of markdown files uploaded in the "file" field
+// answers 200 with a per-file report even when some files failed
+func (h *ExportHandler) Import(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxImportSize+multipartOverhead)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "import file is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not read file"})
+		return
+	}
+	defer file.Close()
+
+	report, err := h.service.Import(userID, file, header.Size)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidArchive), errors.Is(err, service.ErrTooManyFiles):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not import notes"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, newImportReportResponse(report))
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type ImportJobHandler struct {
+	// uses the import job service layer
+	service service.ImportJobService
+	// largest file accepted for a job
+	maxFileSize int64
+}
+
+// constructor for ImportJobHandler
+func NewImportJobHandler(service service.ImportJobService, maxFileSize int64) *ImportJobHandler {
+	return &ImportJobHandler{service, maxFileSize}
+}
+
+// response item for an import job, the storage key stays internal
+type importJobItem struct {
+	ID         uint                `json:"id"`
+	Source     string              `json:"source"`
+	FileName   string              `json:"file_name"`
+	Status     string              `json:"status"`
+	Total      int                 `json:"total"`
+	Processed  int                 `json:"processed"`
+	Imported   int                 `json:"imported"`
+	Failed     int                 `json:"failed"`
+	Failures   []importFailureItem `json:"failures"`
+	Error      string              `json:"error,omitempty"`
+	StartedAt  *time.Time          `json:"started_at"`
+	FinishedAt *time.Time          `json:"finished_at"`
+	CreatedAt  time.Time           `json:"created_at"`
+}
+
+type importFailureItem struct {
+	Item  string `json:"item"`
+	Error string `json:"error"`
+}
+
+func newImportJobItem(job *model.ImportJob) importJobItem {
+	item := importJobItem{
+		ID:         job.ID,
+		Source:     job.Source,
+		FileName:   job.FileName,
+		Status:     job.Status,
+		Total:      job.Total,
+		Processed:  job.Processed,
+		Imported:   job.Imported,
+		Failed:     job.Failed,
+		Failures:   make([]importFailureItem, 0, len(job.Failures)),
+		Error:      job.Error,
+		StartedAt:  job.StartedAt,
+		FinishedAt: job.FinishedAt,
+		CreatedAt:  job.CreatedAt,
+	}
+	for _, failure := range job.Failures {
+		item.Failures = append(item.Failures, importFailureItem{Item: failure.Item, Error: failure.Error})
+	}
+	return item
+}
+
+// uploads an Evernote .enex file or a Google Keep Takeout zip in the "file" field
+// "source" is enex or keep, without it the file extension decides
+// answers 202 right away, the job is polled for progress
+func (h *ImportJobHandler) StartImport(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxFileSize+multipartOverhead)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "import file is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+
+	source := c.PostForm("source")
+	if source == "" {
+		switch strings.ToLower(path.Ext(header.Filename)) {
+		case ".enex":
+			source = model.ImportSourceEnex
+		case ".zip":
+			source = model.ImportSourceKeep
+		}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not read file"})
+		return
+	}
+	defer file.Close()
+
+	job, err := h.service.Start(c.Request.Context(), userID, source, header.Filename, file, header.Size)
+	if err != nil {
+		respondImportJobError(c, err, "could not start import")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, newImportJobItem(job))
+}
+
+// latest import jobs of the caller
+func (h *ImportJobHandler) ListImports(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	jobs, err := h.service.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch imports"})
+		return
+	}
+
+	items := make([]importJobItem, 0, len(jobs))
+	for i := range jobs {
+		items = append(items, newImportJobItem(&jobs[i]))
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// status and progress of one import job
+func (h *ImportJobHandler) GetImport(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	jobID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid import ID"})
+		return
+	}
+
+	job, err := h.service.Get(userID, jobID)
+	if err != nil {
+		respondImportJobError(c, err, "could not fetch import")
+		return
+	}
+
+	c.JSON(http.StatusOK, newImportJobItem(job))
+}
+
+func respondImportJobError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrImportJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrImportSource), errors.Is(err, service.ErrImportEmpty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/middleware"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+)
+
+// keeps proxies from closing an idle stream
+const sseKeepAlive = 25 * time.Second
+
+type NoteEventHandler struct {
+	// subscribes to the note event bus
+	events service.NoteEventBus
+}
+
+// constructor for NoteEventHandler
+func NewNoteEventHandler(events service.NoteEventBus) *NoteEventHandler {
+	return &NoteEventHandler{events}
+}
+
+// streams events of the caller's notes and notes shared with them as server-sent events
+// the event name is the event type, data is the NoteEvent as json
+// the stream ends when the access token expires or is revoked or the client can't keep up,
+// clients should reconnect and reload
+func (h *NoteEventHandler) Stream(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	expiresAt, _ := c.Get("token_expires_at")
+	tokenValid, _ := c.Get("token_valid")
+	stillValid, _ := tokenValid.(middleware.TokenCheck)
+
+	events, unsubscribe := h.events.Subscribe(userID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// nginx would buffer the stream otherwise
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	var expired <-chan time.Time
+	if at, ok := expiresAt.(time.Time); ok {
+		timer := time.NewTimer(time.Until(at))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	// tells the client the stream is live before the first event
+	c.SSEvent("ready", gin.H{"user_id": userID})
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-expired:
+			c.SSEvent("expired", gin.H{"error": "access token expired"})
+			return false
+		case <-keepAlive.C:
+			// a logout or a deleted personal access token ends the stream within one keep-alive
+			if stillValid != nil && !stillValid() {
+				c.SSEvent("revoked", gin.H{"error": "access token was revoked"})
+				return false
+			}
+			// sse comment line, ignored by clients
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.Render(-1, sse.Event{
+				Id:    strconv.FormatUint(event.ID, 10),
+				Event: event.Type,
+				Data:  event,
+			})
+			return true
+		}
+	})
+}
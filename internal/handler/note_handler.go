@@ -1,11 +1,12 @@
 package handler
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/repository"
 	"github.com/dassajib/prohor-api/internal/service"
 	"github.com/gin-gonic/gin"
 )
@@ -20,55 +21,114 @@ func NewNoteHandler(service service.NoteService) *NoteHandler {
 	return &NoteHandler{service}
 }
 
-// saves a new note with title, content, tag, and auto-filled user and date
+// saves a new note with title, content, tags, and auto-filled user and date
 func (h *NoteHandler) CreateNote(c *gin.Context) {
 	// get logged-in user's ID from token (set by auth middleware)
 	userID := c.MustGet("user_id").(uint)
-	var note model.Note
 
-	// bind JSON input to note model
-	if err := c.ShouldBindJSON(&note); err != nil {
+	// bind JSON input, "tag" is the old single-tag field and still accepted
+	var body struct {
+		Title   string   `json:"title"`
+		Content string   `json:"content"`
+		Tags    []string `json:"tags"`
+		Tag     string   `json:"tag"`
+		Pinned  bool     `json:"pinned"`
+		// plain (default) or markdown
+		Format string `json:"format"`
+		// RFC 3339 times, recurrence is an RRULE like "FREQ=WEEKLY;BYDAY=MO"
+		RemindAt   *time.Time `json:"remind_at"`
+		DueAt      *time.Time `json:"due_at"`
+		Recurrence string     `json:"recurrence"`
+		EventAt    *time.Time `json:"event_at"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
 		return
 	}
 
-	// set required fields manually
-	note.UserID = userID
-	note.Date = time.Now()
+	// set required fields manually, owner is set by the service
+	note := model.Note{
+		Title:   body.Title,
+		Content: body.Content,
+		Tags:    tagsFromNames(append(body.Tags, nonEmpty(body.Tag)...)),
+		Pinned:  body.Pinned,
+		Format:  body.Format,
+		Date:    time.Now(),
+
+		RemindAt:   body.RemindAt,
+		DueAt:      body.DueAt,
+		Recurrence: body.Recurrence,
+		EventAt:    body.EventAt,
+	}
 
-	if err := h.service.Create(&note); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not create note"})
+	if err := h.service.Create(userID, &note); err != nil {
+		respondNoteError(c, err, "could not create note")
 		return
 	}
 
+	setNoteETag(c, &note)
 	c.JSON(http.StatusCreated, note)
 }
 
-// allows partial update (title, content, tag), also updates date automatically
+// returns a single note with its version as ETag, ?render=html adds its content as html
+func (h *NoteHandler) GetNote(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	render, err := parseRenderParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	note, err := h.service.GetNoteByID(userID, noteID)
+	if err != nil {
+		respondNoteError(c, err, "could not fetch note")
+		return
+	}
+	view, err := newNoteView(note, render)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not render note"})
+		return
+	}
+
+	setNoteETag(c, note)
+	c.JSON(http.StatusOK, view)
+}
+
+// allows partial update (title, content, format, tags, reminder), also updates date automatically
+// If-Match must carry the ETag the changes are based on
 func (h *NoteHandler) UpdateNote(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
 
 	// read note ID from URL param
-	var noteID uint
-	if _, err := fmt.Sscan(c.Param("id"), &noteID); err != nil {
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
 		return
 	}
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
 
-	// fetch note from DB
-	existingNote, err := h.service.GetNoteByID(noteID)
+	// fetch note from DB, service checks the caller may see it
+	existingNote, err := h.service.GetNoteByID(userID, noteID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "note not found"})
+		respondNoteError(c, err, "could not fetch note")
 		return
 	}
-
-	// only allow editing user's own note
-	if existingNote.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized access"})
+	if version != service.AnyVersion && existingNote.Version != version {
+		respondVersionConflict(c, existingNote)
 		return
 	}
 
-	// allow partial update (title, content, tag)
+	// allow partial update (title, content, tags)
 	var updateData map[string]interface{}
 	if err := c.ShouldBindJSON(&updateData); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
@@ -81,77 +141,183 @@ func (h *NoteHandler) UpdateNote(c *gin.Context) {
 	if content, ok := updateData["content"].(string); ok {
 		existingNote.Content = content
 	}
-	if tag, ok := updateData["tag"].(string); ok {
-		existingNote.Tag = tag
+	if format, ok := updateData["format"].(string); ok {
+		existingNote.Format = format
+	}
+	if rawTags, ok := updateData["tags"].([]interface{}); ok {
+		names := make([]string, 0, len(rawTags))
+		for _, raw := range rawTags {
+			name, ok := raw.(string)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "tags must be a list of names"})
+				return
+			}
+			names = append(names, name)
+		}
+		existingNote.Tags = tagsFromNames(names)
+	} else if tag, ok := updateData["tag"].(string); ok {
+		existingNote.Tags = tagsFromNames(nonEmpty(tag))
+	}
+
+	// null clears a reminder, due date, event time or recurrence
+	if remindAt, present, err := optionalTime(updateData, "remind_at"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if present {
+		existingNote.RemindAt = remindAt
+	}
+	if dueAt, present, err := optionalTime(updateData, "due_at"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if present {
+		existingNote.DueAt = dueAt
+	}
+	if eventAt, present, err := optionalTime(updateData, "event_at"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if present {
+		existingNote.EventAt = eventAt
+	}
+	if raw, ok := updateData["recurrence"]; ok {
+		recurrence, ok := raw.(string)
+		if raw != nil && !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recurrence must be a string"})
+			return
+		}
+		existingNote.Recurrence = recurrence
 	}
 
 	// update the date field on every update
 	existingNote.Date = time.Now()
 
-	if err := h.service.Update(existingNote); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not update note"})
+	if err := h.service.Update(userID, existingNote); err != nil {
+		h.respondWriteError(c, userID, noteID, err, "could not update note")
 		return
 	}
 
+	setNoteETag(c, existingNote)
 	c.JSON(http.StatusOK, existingNote)
 }
 
-// returns all notes created by the logged-in user
+// returns a page of notes created by the logged-in user
 func (h *NoteHandler) GetUserNotes(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
 
-	notes, err := h.service.GetUserNotes(userID)
+	opts, err := parseNoteListOptions(c, false)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch notes"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	render, err := parseRenderParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, notes)
+	page, err := h.service.GetUserNotes(userID, opts)
+	if err != nil {
+		respondListError(c, err, "could not fetch notes")
+		return
+	}
+
+	res, err := newNotePageResponse(page, render)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not render notes"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// returns a page of notes other users shared with the logged-in user
+func (h *NoteHandler) GetSharedNotes(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	opts, err := parseNoteListOptions(c, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	render, err := parseRenderParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.service.GetSharedNotes(userID, opts)
+	if err != nil {
+		respondListError(c, err, "could not fetch shared notes")
+		return
+	}
+
+	res, err := newNotePageResponse(page, render)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not render notes"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
 }
 
 // performs a soft delete (sets deleted_at) for safety
 func (h *NoteHandler) DeleteNote(c *gin.Context) {
-	var id uint
-	fmt.Sscan(c.Param("id"), &id)
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
 
-	if err := h.service.Delete(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not delete note"})
+	if err := h.service.Delete(userID, id); err != nil {
+		respondNoteError(c, err, "could not delete note")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "note soft deleted"})
 }
 
-// restores a soft-deleted note (if deleted less than 30 days ago)
+// restores a soft-deleted note (if deleted within the retention window, 30 days by default)
 func (h *NoteHandler) RestoreNote(c *gin.Context) {
-	var id uint
-	fmt.Sscan(c.Param("id"), &id)
+	userID := c.MustGet("user_id").(uint)
 
-	if err := h.service.Restore(id); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+	version, ok := requireIfMatch(c)
+	if !ok {
 		return
 	}
 
+	note, err := h.service.Restore(userID, id, version)
+	if err != nil {
+		h.respondWriteError(c, userID, id, err, "could not restore note")
+		return
+	}
+
+	setNoteETag(c, note)
 	c.JSON(http.StatusOK, gin.H{"message": "note restored"})
 }
 
 // del permanently
 func (h *NoteHandler) DeleteNotePermanent(c *gin.Context) {
-	var id uint
-	if _, err := fmt.Sscan(c.Param("id"), &id); err != nil {
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
 		return
 	}
 
-	if err := h.service.DeletePermanent(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not permanently delete note"})
+	if err := h.service.DeletePermanent(userID, id); err != nil {
+		respondNoteError(c, err, "could not permanently delete note")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "note permanently deleted"})
 }
 
-// search note
+// full-text search over title, tag and content, ranked with highlighted snippets
 func (h *NoteHandler) SearchNotes(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
 	query := c.Query("q")
@@ -161,13 +327,29 @@ func (h *NoteHandler) SearchNotes(c *gin.Context) {
 		return
 	}
 
-	notes, err := h.service.SearchUserNotes(userID, query)
+	opts, err := parseNoteListOptions(c, true)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	render, err := parseRenderParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, notes)
+	page, err := h.service.SearchUserNotes(userID, query, opts)
+	if err != nil {
+		respondListError(c, err, "search failed")
+		return
+	}
+
+	res, err := newNoteSearchResponse(page, render)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not render notes"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
 }
 
 // to handle toggle pinned
@@ -175,16 +357,13 @@ func (h *NoteHandler) TogglePin(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
 
 	// read note id from URL parameter and convert to uint
-	var noteID uint
-	if _, err := fmt.Sscan(c.Param("id"), &noteID); err != nil {
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
 		return
 	}
-
-	// fetch the note from the service
-	note, err := h.service.GetNoteByID(noteID)
-	if err != nil || note.UserID != userID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized access"})
+	version, ok := requireIfMatch(c)
+	if !ok {
 		return
 	}
 
@@ -200,11 +379,210 @@ func (h *NoteHandler) TogglePin(c *gin.Context) {
 		return
 	}
 
-	// call service to toggle the pinned status
-	if err := h.service.TogglePin(noteID, payload.Pinned); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update pin status"})
+	// call service to toggle the pinned status, it also checks ownership
+	note, err := h.service.TogglePin(userID, noteID, payload.Pinned, version)
+	if err != nil {
+		h.respondWriteError(c, userID, noteID, err, "failed to update pin status")
 		return
 	}
 
+	setNoteETag(c, note)
 	c.JSON(http.StatusOK, gin.H{"message": "pin status updated"})
 }
+
+// archives a note, it leaves the default listing but stays searchable with ?archived=include
+func (h *NoteHandler) ArchiveNote(c *gin.Context) {
+	h.setArchived(c, true)
+}
+
+// brings an archived note back into the default listing
+func (h *NoteHandler) UnarchiveNote(c *gin.Context) {
+	h.setArchived(c, false)
+}
+
+// returns a page of the logged-in user's archived notes
+func (h *NoteHandler) GetArchivedNotes(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	opts, err := parseNoteListOptions(c, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	render, err := parseRenderParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.service.GetArchivedNotes(userID, opts)
+	if err != nil {
+		respondListError(c, err, "could not fetch archived notes")
+		return
+	}
+
+	res, err := newNotePageResponse(page, render)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not render notes"})
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// archive and unarchive only differ in the flag, both need If-Match like pinning
+func (h *NoteHandler) setArchived(c *gin.Context, archived bool) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	note, err := h.service.Archive(userID, noteID, archived, version)
+	if err != nil {
+		h.respondWriteError(c, userID, noteID, err, "could not update archive state")
+		return
+	}
+
+	setNoteETag(c, note)
+	c.JSON(http.StatusOK, note)
+}
+
+// files a note in a notebook, "notebook_id": null takes it out again
+func (h *NoteHandler) MoveNote(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	var body struct {
+		NotebookID *uint `json:"notebook_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	note, err := h.service.Move(userID, id, body.NotebookID)
+	if err != nil {
+		respondNoteError(c, err, "could not move note")
+		return
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
+// lists soft-deleted notes that can still be restored
+func (h *NoteHandler) GetTrash(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	notes, err := h.service.GetTrash(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch trash"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notes)
+}
+
+// permanently deletes every note in the caller's trash
+func (h *NoteHandler) EmptyTrash(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	deleted, err := h.service.EmptyTrash(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not empty trash"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "trash emptied", "deleted": deleted})
+}
+
+// like respondNoteError, but a version conflict is answered with the current copy of the note
+func (h *NoteHandler) respondWriteError(c *gin.Context, userID, noteID uint, err error, fallback string) {
+	if errors.Is(err, service.ErrVersionConflict) {
+		current, getErr := h.service.GetNoteByID(userID, noteID)
+		if getErr != nil {
+			respondNoteError(c, getErr, fallback)
+			return
+		}
+		respondVersionConflict(c, current)
+		return
+	}
+	respondNoteError(c, err, fallback)
+}
+
+// maps note service errors to a response, anything unexpected becomes a 500 with the fallback message
+func respondNoteError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrNoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNotebookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidTagName):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrNoteNotInTrash):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRestoreExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidNoteFormat):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidRecurrence), errors.Is(err, service.ErrRecurrenceWithoutReminder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
+
+// a stale or tampered cursor is the client's fault, everything else is ours
+func respondListError(c *gin.Context, err error, fallback string) {
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+}
+
+// note.Tags only needs names, the service looks up or creates the tags
+func tagsFromNames(names []string) []model.Tag {
+	tags := make([]model.Tag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, model.Tag{Name: name})
+	}
+	return tags
+}
+
+// RFC 3339 time from a partial update, present is false when the key is missing
+func optionalTime(data map[string]interface{}, key string) (value *time.Time, present bool, err error) {
+	raw, present := data[key]
+	if !present || raw == nil {
+		return nil, present, nil
+	}
+	text, ok := raw.(string)
+	if !ok {
+		return nil, true, errors.New(key + " must be an RFC 3339 time or null")
+	}
+	t, err := time.Parse(time.RFC3339, text)
+	if err != nil {
+		return nil, true, errors.New(key + " must be an RFC 3339 time or null")
+	}
+	return &t, true, nil
+}
+
+// single value as list, empty list for an empty string
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
@@ -0,0 +1,555 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// users of the fixture, every collaborator has a grant on both notes
+const (
+	ownerID    uint = 1
+	viewerID   uint = 2
+	editorID   uint = 3
+	coOwnerID  uint = 4
+	strangerID uint = 5
+)
+
+// notes and notebook of the fixture, all belonging to ownerID
+const (
+	liveNoteID    uint = 10
+	trashedNoteID uint = 11
+	notebookID    uint = 20
+)
+
+// in-memory notes, only what the note service uses is implemented
+type fakeNoteRepo struct {
+	repository.NoteRepository
+	shares *fakeShareRepo
+
+	mu     sync.Mutex
+	notes  map[uint]model.Note
+	nextID uint
+}
+
+func (r *fakeNoteRepo) Create(note *model.Note) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	note.ID = r.nextID
+	note.Version = 1
+	r.notes[note.ID] = *note
+	return nil
+}
+
+func (r *fakeNoteRepo) Update(note *model.Note) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.notes[note.ID]
+	if !ok || stored.Version != note.Version {
+		return repository.ErrVersionConflict
+	}
+	note.Version++
+	r.notes[note.ID] = *note
+	return nil
+}
+
+func (r *fakeNoteRepo) FindByID(id uint) (*model.Note, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	note, ok := r.notes[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &note, nil
+}
+
+func (r *fakeNoteRepo) FindByUser(userID uint, opts repository.NoteListOptions) (*repository.NotePage, error) {
+	return r.list(opts, func(note model.Note) bool { return note.UserID == userID }), nil
+}
+
+func (r *fakeNoteRepo) FindSharedWith(userID uint, opts repository.NoteListOptions) (*repository.NotePage, error) {
+	return r.list(opts, func(note model.Note) bool { return r.shares.role(note.ID, userID) != "" }), nil
+}
+
+func (r *fakeNoteRepo) DeleteSoft(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	note := r.notes[id]
+	note.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	note.Version++
+	r.notes[id] = note
+	return nil
+}
+
+func (r *fakeNoteRepo) RestoreDeleted(id uint, version uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	note, ok := r.notes[id]
+	if !ok || note.Version != version {
+		return repository.ErrVersionConflict
+	}
+	note.DeletedAt = gorm.DeletedAt{}
+	note.Version++
+	r.notes[id] = note
+	return nil
+}
+
+func (r *fakeNoteRepo) DeletePermanent(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.notes, id)
+	return nil
+}
+
+// title match is enough to tell whose notes a search looks at
+func (r *fakeNoteRepo) SearchUserNotes(userID uint, query string, opts repository.NoteListOptions) (*repository.NoteSearchPage, error) {
+	page := r.list(opts, func(note model.Note) bool {
+		return note.UserID == userID && strings.Contains(strings.ToLower(note.Title), strings.ToLower(query))
+	})
+	res := &repository.NoteSearchPage{}
+	for _, note := range page.Notes {
+		res.Results = append(res.Results, repository.NoteSearchResult{Note: note})
+	}
+	return res, nil
+}
+
+func (r *fakeNoteRepo) FindTrashByUser(userID uint, deletedSince time.Time) ([]model.Note, error) {
+	page := r.list(repository.NoteListOptions{Deleted: repository.DeletedOnly, Archived: repository.ArchivedInclude}, func(note model.Note) bool {
+		return note.UserID == userID && !note.DeletedAt.Time.Before(deletedSince)
+	})
+	return page.Notes, nil
+}
+
+// notes passing match and the deleted and archived filters, by id
+func (r *fakeNoteRepo) list(opts repository.NoteListOptions, match func(model.Note) bool) *repository.NotePage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	page := &repository.NotePage{Notes: []model.Note{}}
+	for id := uint(1); id <= r.nextID; id++ {
+		note, ok := r.notes[id]
+		if !ok || !match(note) {
+			continue
+		}
+		switch opts.Deleted {
+		case repository.DeletedOnly:
+			if !note.DeletedAt.Valid {
+				continue
+			}
+		case repository.DeletedInclude:
+		default:
+			if note.DeletedAt.Valid {
+				continue
+			}
+		}
+		switch opts.Archived {
+		case repository.ArchivedOnly:
+			if note.ArchivedAt == nil {
+				continue
+			}
+		case repository.ArchivedInclude:
+		default:
+			if note.ArchivedAt != nil {
+				continue
+			}
+		}
+		page.Notes = append(page.Notes, note)
+	}
+	return page
+}
+
+// grants keyed by note and user, the value is the role
+type fakeShareRepo struct {
+	repository.NoteShareRepository
+
+	mu     sync.Mutex
+	grants map[[2]uint]string
+}
+
+func (r *fakeShareRepo) role(noteID, userID uint) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.grants[[2]uint{noteID, userID}]
+}
+
+func (r *fakeShareRepo) FindByNoteAndUser(noteID, userID uint) (*model.NoteShare, error) {
+	role := r.role(noteID, userID)
+	if role == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &model.NoteShare{NoteID: noteID, UserID: userID, Role: role}, nil
+}
+
+func (r *fakeShareRepo) FindByNote(noteID uint) ([]model.NoteShare, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var shares []model.NoteShare
+	for key, role := range r.grants {
+		if key[0] == noteID {
+			shares = append(shares, model.NoteShare{NoteID: noteID, UserID: key[1], Role: role})
+		}
+	}
+	return shares, nil
+}
+
+type fakeTagRepo struct {
+	repository.TagRepository
+}
+
+func (fakeTagRepo) FindOrCreateByNames(userID uint, names []string) ([]model.Tag, error) {
+	tags := make([]model.Tag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, model.Tag{UserID: userID, Name: name})
+	}
+	return tags, nil
+}
+
+type fakeNotebookRepo struct {
+	repository.NotebookRepository
+	notebooks map[uint]model.Notebook
+}
+
+func (r fakeNotebookRepo) FindByID(id uint) (*model.Notebook, error) {
+	notebook, ok := r.notebooks[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &notebook, nil
+}
+
+// revisions and links are not what these tests look at, writes to them always succeed
+type fakeRevisionRepo struct {
+	repository.NoteRevisionRepository
+}
+
+func (fakeRevisionRepo) FindLatest(noteID uint) (*model.NoteRevision, error) {
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (fakeRevisionRepo) Create(revision *model.NoteRevision) error {
+	return nil
+}
+
+type fakeLinkRepo struct {
+	repository.NoteLinkRepository
+}
+
+func (fakeLinkRepo) ReplaceForSource(source *model.Note, titles []string, ids []uint) error {
+	return nil
+}
+
+func (fakeLinkRepo) ResolveDangling(userID uint, title string, targetID uint) error {
+	return nil
+}
+
+func (fakeLinkRepo) FindTitleLinksTo(targetID uint) ([]model.NoteLink, error) {
+	return nil, nil
+}
+
+// runs fn against the fakes, there is nothing to roll back
+type fakeTransactor struct {
+	tx repository.TxRepositories
+}
+
+func (t fakeTransactor) Transaction(fn func(tx repository.TxRepositories) error) error {
+	return fn(t.tx)
+}
+
+// a live and a trashed note of ownerID, shared with a viewer, an editor and a co-owner
+func newNoteFixture(t *testing.T) (*gin.Engine, *fakeNoteRepo) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	shares := &fakeShareRepo{grants: map[[2]uint]string{}}
+	notes := &fakeNoteRepo{shares: shares, notes: map[uint]model.Note{}, nextID: trashedNoteID}
+	notes.notes[liveNoteID] = model.Note{ID: liveNoteID, UserID: ownerID, Title: "Groceries", Format: model.NoteFormatPlain, Version: 1}
+	notes.notes[trashedNoteID] = model.Note{
+		ID: trashedNoteID, UserID: ownerID, Title: "Old plans", Format: model.NoteFormatPlain, Version: 1,
+		DeletedAt: gorm.DeletedAt{Time: time.Now().Add(-time.Hour), Valid: true},
+	}
+	for _, noteID := range []uint{liveNoteID, trashedNoteID} {
+		shares.grants[[2]uint{noteID, viewerID}] = model.ShareRoleViewer
+		shares.grants[[2]uint{noteID, editorID}] = model.ShareRoleEditor
+		shares.grants[[2]uint{noteID, coOwnerID}] = model.ShareRoleOwner
+	}
+	notebooks := fakeNotebookRepo{notebooks: map[uint]model.Notebook{
+		notebookID: {ID: notebookID, UserID: ownerID, Name: "Home"},
+	}}
+
+	tx := fakeTransactor{repository.TxRepositories{Notes: notes, Revisions: fakeRevisionRepo{}, Links: fakeLinkRepo{}}}
+	noteService := service.NewNoteService(notes, fakeTagRepo{}, notebooks, fakeRevisionRepo{}, shares, fakeLinkRepo{}, tx,
+		service.NewNotePolicy(shares), service.NewNoteEventBus(), service.NoteSettings{TrashRetention: 30 * 24 * time.Hour, MaxRevisionsPerUser: 100})
+	h := NewNoteHandler(noteService)
+
+	// stands in for the auth middleware, the acting user comes from a header
+	r := gin.New()
+	noteGroup := r.Group("/api/notes")
+	noteGroup.Use(func(c *gin.Context) {
+		userID, _ := strconv.ParseUint(c.GetHeader("X-User-ID"), 10, 64)
+		c.Set("user_id", uint(userID))
+	})
+	{
+		noteGroup.POST("/", h.CreateNote)
+		noteGroup.GET("/", h.GetUserNotes)
+		noteGroup.GET("/shared", h.GetSharedNotes)
+		noteGroup.GET("/trash", h.GetTrash)
+		noteGroup.GET("/archived", h.GetArchivedNotes)
+		noteGroup.DELETE("/trash", h.EmptyTrash)
+		noteGroup.GET("/:id", h.GetNote)
+		noteGroup.PUT("/:id", h.UpdateNote)
+		noteGroup.DELETE("/:id", h.DeleteNote)
+		noteGroup.PUT("/:id/restore", h.RestoreNote)
+		noteGroup.DELETE("/:id/permanent", h.DeleteNotePermanent)
+		noteGroup.GET("/search", h.SearchNotes)
+		noteGroup.PUT("/:id/pin", h.TogglePin)
+		noteGroup.PUT("/:id/archive", h.ArchiveNote)
+		noteGroup.PUT("/:id/unarchive", h.UnarchiveNote)
+		noteGroup.PUT("/:id/move", h.MoveNote)
+	}
+	return r, notes
+}
+
+// sends the request as the user, ifMatch is left out when empty
+func doNoteRequest(r *gin.Engine, userID uint, method, path, body, ifMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("X-User-ID", strconv.FormatUint(uint64(userID), 10))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// expected status of a route on a single note for every user of the fixture
+type noteRouteCase struct {
+	name    string
+	method  string
+	suffix  string
+	body    string
+	ifMatch string
+	want    map[uint]int
+}
+
+func runNoteRouteCases(t *testing.T, noteID uint, cases []noteRouteCase) {
+	for _, tc := range cases {
+		for userID, want := range tc.want {
+			t.Run(tc.name+"/user"+strconv.Itoa(int(userID)), func(t *testing.T) {
+				r, _ := newNoteFixture(t)
+				path := "/api/notes/" + strconv.Itoa(int(noteID)) + tc.suffix
+				w := doNoteRequest(r, userID, tc.method, path, tc.body, tc.ifMatch)
+				if w.Code != want {
+					t.Errorf("%s %s as user %d = %d, want %d: %s", tc.method, path, userID, w.Code, want, w.Body)
+				}
+			})
+		}
+	}
+}
+
+// who may do what follows NotePolicy: viewers view, editors also edit, owner grants do everything,
+// anyone without a grant can't tell the note exists
+func TestNoteRoutesOnLiveNote(t *testing.T) {
+	const ok, forbidden, notFound = http.StatusOK, http.StatusForbidden, http.StatusNotFound
+	view := map[uint]int{ownerID: ok, viewerID: ok, editorID: ok, coOwnerID: ok, strangerID: notFound}
+	edit := map[uint]int{ownerID: ok, viewerID: forbidden, editorID: ok, coOwnerID: ok, strangerID: notFound}
+	manage := map[uint]int{ownerID: ok, viewerID: forbidden, editorID: forbidden, coOwnerID: ok, strangerID: notFound}
+
+	runNoteRouteCases(t, liveNoteID, []noteRouteCase{
+		{name: "get", method: http.MethodGet, want: view},
+		{name: "update", method: http.MethodPut, body: `{"title":"Shopping"}`, ifMatch: `"1"`, want: edit},
+		{name: "pin", method: http.MethodPut, suffix: "/pin", body: `{"pinned":true}`, ifMatch: `"1"`, want: edit},
+		{name: "archive", method: http.MethodPut, suffix: "/archive", ifMatch: `"1"`, want: manage},
+		{name: "unarchive", method: http.MethodPut, suffix: "/unarchive", ifMatch: `"1"`, want: manage},
+		{name: "move", method: http.MethodPut, suffix: "/move", body: `{"notebook_id":20}`, want: manage},
+		{name: "move to a missing notebook", method: http.MethodPut, suffix: "/move", body: `{"notebook_id":99}`, want: map[uint]int{
+			ownerID: notFound, viewerID: forbidden, editorID: forbidden, coOwnerID: notFound, strangerID: notFound,
+		}},
+		{name: "delete", method: http.MethodDelete, want: manage},
+		{name: "delete permanent", method: http.MethodDelete, suffix: "/permanent", want: manage},
+		{name: "restore", method: http.MethodPut, suffix: "/restore", ifMatch: `"1"`, want: map[uint]int{
+			ownerID: http.StatusBadRequest, viewerID: forbidden, editorID: forbidden, coOwnerID: http.StatusBadRequest, strangerID: notFound,
+		}},
+	})
+}
+
+// the owner's trash is only visible to those who could restore from it,
+// viewers and editors get the same 404 as a stranger
+func TestNoteRoutesOnTrashedNote(t *testing.T) {
+	const ok, notFound = http.StatusOK, http.StatusNotFound
+	restorers := map[uint]int{ownerID: ok, viewerID: notFound, editorID: notFound, coOwnerID: ok, strangerID: notFound}
+	hidden := map[uint]int{ownerID: notFound, viewerID: notFound, editorID: notFound, coOwnerID: notFound, strangerID: notFound}
+
+	runNoteRouteCases(t, trashedNoteID, []noteRouteCase{
+		{name: "get", method: http.MethodGet, want: restorers},
+		{name: "update", method: http.MethodPut, body: `{"title":"New plans"}`, ifMatch: `"1"`, want: restorers},
+		{name: "restore", method: http.MethodPut, suffix: "/restore", ifMatch: `"1"`, want: restorers},
+		{name: "delete permanent", method: http.MethodDelete, suffix: "/permanent", want: restorers},
+		// notes in the trash can't be archived, not even by the owner
+		{name: "archive", method: http.MethodPut, suffix: "/archive", ifMatch: `"1"`, want: hidden},
+	})
+}
+
+func TestNoteRoutesMissingNote(t *testing.T) {
+	r, _ := newNoteFixture(t)
+
+	w := doNoteRequest(r, ownerID, http.MethodGet, "/api/notes/99", "", "")
+	if w.Code != http.StatusNotFound {
+		t.Errorf("GET of a missing note = %d, want 404", w.Code)
+	}
+	// a stranger gets the same answer for a note that exists
+	stranger := doNoteRequest(r, strangerID, http.MethodGet, "/api/notes/10", "", "")
+	if stranger.Code != w.Code || stranger.Body.String() != w.Body.String() {
+		t.Errorf("stranger got %d %s, missing note got %d %s", stranger.Code, stranger.Body, w.Code, w.Body)
+	}
+}
+
+func TestUpdateNoteVersionConflict(t *testing.T) {
+	r, _ := newNoteFixture(t)
+
+	w := doNoteRequest(r, editorID, http.MethodPut, "/api/notes/10", `{"title":"Shopping"}`, `"7"`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("update with a stale ETag = %d, want 412", w.Code)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"1"` {
+		t.Errorf("ETag = %s, want the current version", etag)
+	}
+
+	w = doNoteRequest(r, editorID, http.MethodPut, "/api/notes/10", `{"title":"Shopping"}`, "")
+	if w.Code != http.StatusPreconditionRequired {
+		t.Errorf("update without If-Match = %d, want 428", w.Code)
+	}
+}
+
+func TestCreateNoteBelongsToCaller(t *testing.T) {
+	r, notes := newNoteFixture(t)
+
+	w := doNoteRequest(r, viewerID, http.MethodPost, "/api/notes/", `{"title":"Mine","content":"hi","tags":["home"]}`, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create = %d: %s", w.Code, w.Body)
+	}
+	var created model.Note
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := notes.FindByID(created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.UserID != viewerID || len(stored.Tags) != 1 || stored.Tags[0].Name != "home" {
+		t.Errorf("stored note = %+v, want one owned by user %d tagged home", stored, viewerID)
+	}
+}
+
+// listings only ever contain notes of the caller, or notes shared with them
+func TestNoteListings(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID uint
+		path   string
+		want   []uint
+	}{
+		{"own notes", ownerID, "/api/notes/", []uint{liveNoteID}},
+		{"own notes of a collaborator", editorID, "/api/notes/", nil},
+		{"shared leaves out the trash", viewerID, "/api/notes/shared", []uint{liveNoteID}},
+		{"shared with the owner", ownerID, "/api/notes/shared", nil},
+		{"archived", ownerID, "/api/notes/archived", nil},
+		{"search", ownerID, "/api/notes/search?q=groc", []uint{liveNoteID}},
+		{"search of a collaborator", coOwnerID, "/api/notes/search?q=groc", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := newNoteFixture(t)
+			w := doNoteRequest(r, tt.userID, http.MethodGet, tt.path, "", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("GET %s = %d: %s", tt.path, w.Code, w.Body)
+			}
+
+			var res struct {
+				Notes   []model.Note `json:"notes"`
+				Results []struct {
+					Note model.Note `json:"note"`
+				} `json:"results"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			var got []uint
+			for _, note := range res.Notes {
+				got = append(got, note.ID)
+			}
+			for _, result := range res.Results {
+				got = append(got, result.Note.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("GET %s as user %d returned notes %v, want %v", tt.path, tt.userID, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchivedListingAfterArchive(t *testing.T) {
+	r, _ := newNoteFixture(t)
+
+	if w := doNoteRequest(r, ownerID, http.MethodPut, "/api/notes/10/archive", "", `"1"`); w.Code != http.StatusOK {
+		t.Fatalf("archive = %d: %s", w.Code, w.Body)
+	}
+	w := doNoteRequest(r, ownerID, http.MethodGet, "/api/notes/archived", "", "")
+	if !strings.Contains(w.Body.String(), `"Title":"Groceries"`) {
+		t.Errorf("archived listing = %s, want the archived note", w.Body)
+	}
+	// collaborators keep seeing what the owner archived
+	w = doNoteRequest(r, viewerID, http.MethodGet, "/api/notes/shared", "", "")
+	if !strings.Contains(w.Body.String(), `"Title":"Groceries"`) {
+		t.Errorf("shared listing = %s, want the archived note", w.Body)
+	}
+}
+
+// the trash belongs to the owner, a co-owner restores from it one note at a time
+func TestTrashRoutes(t *testing.T) {
+	r, notes := newNoteFixture(t)
+
+	w := doNoteRequest(r, coOwnerID, http.MethodGet, "/api/notes/trash", "", "")
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("trash of a collaborator = %d %s, want an empty list", w.Code, w.Body)
+	}
+	w = doNoteRequest(r, coOwnerID, http.MethodDelete, "/api/notes/trash", "", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":0`) {
+		t.Errorf("emptying the trash of a collaborator = %d %s", w.Code, w.Body)
+	}
+
+	w = doNoteRequest(r, ownerID, http.MethodGet, "/api/notes/trash", "", "")
+	var trash []model.Note
+	if err := json.Unmarshal(w.Body.Bytes(), &trash); err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != trashedNoteID {
+		t.Errorf("trash of the owner = %s, want the trashed note", w.Body)
+	}
+
+	w = doNoteRequest(r, ownerID, http.MethodDelete, "/api/notes/trash", "", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"deleted":1`) {
+		t.Errorf("emptying the trash = %d %s", w.Code, w.Body)
+	}
+	if _, err := notes.FindByID(trashedNoteID); err == nil {
+		t.Error("trashed note still stored after emptying the trash")
+	}
+	if _, err := notes.FindByID(liveNoteID); err != nil {
+		t.Error("emptying the trash removed a live note")
+	}
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/dassajib/prohor-api/internal/repository"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type NoteLinkHandler struct {
+	// uses the note link service layer
+	service service.NoteLinkService
+}
+
+// constructor for NoteLinkHandler
+func NewNoteLinkHandler(service service.NoteLinkService) *NoteLinkHandler {
+	return &NoteLinkHandler{service}
+}
+
+// response shape of the note graph
+type graphNode struct {
+	ID       uint   `json:"id"`
+	Title    string `json:"title"`
+	Archived bool   `json:"archived"`
+}
+
+type graphEdge struct {
+	Source uint `json:"source"`
+	Target uint `json:"target"`
+}
+
+type noteGraphResponse struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+func newNoteGraphResponse(graph *repository.NoteGraph) noteGraphResponse {
+	res := noteGraphResponse{
+		Nodes: make([]graphNode, 0, len(graph.Nodes)),
+		Edges: make([]graphEdge, 0, len(graph.Edges)),
+	}
+	for _, node := range graph.Nodes {
+		res.Nodes = append(res.Nodes, graphNode{ID: node.ID, Title: node.Title, Archived: node.Archived})
+	}
+	for _, edge := range graph.Edges {
+		res.Edges = append(res.Edges, graphEdge{Source: edge.SourceID, Target: edge.TargetID})
+	}
+	return res
+}
+
+// notes linking to this one with [[Title]] or [[id:123]]
+func (h *NoteLinkHandler) Backlinks(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	notes, err := h.service.Backlinks(userID, noteID)
+	if err != nil {
+		respondNoteError(c, err, "could not fetch backlinks")
+		return
+	}
+
+	c.JSON(http.StatusOK, notes)
+}
+
+// nodes and edges of the caller's notes for a graph view
+func (h *NoteLinkHandler) Graph(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	graph, err := h.service.Graph(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not build note graph"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newNoteGraphResponse(graph))
+}
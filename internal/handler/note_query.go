@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// response envelope for paginated note listings
+type notePageResponse struct {
+	Notes      []noteView `json:"notes"`
+	NextCursor *string    `json:"next_cursor"`
+}
+
+// builds the envelope, next_cursor is null on the last page
+func newNotePageResponse(page *repository.NotePage, render bool) (notePageResponse, error) {
+	notes, err := newNoteViews(page.Notes, render)
+	if err != nil {
+		return notePageResponse{}, err
+	}
+	res := notePageResponse{Notes: notes}
+	if page.NextCursor != "" {
+		res.NextCursor = &page.NextCursor
+	}
+	return res, nil
+}
+
+// response item for full-text search, snippet and title_highlight are html with <mark> tags
+type noteSearchItem struct {
+	Note           noteView `json:"note"`
+	Rank           float32  `json:"rank"`
+	Snippet        string   `json:"snippet"`
+	TitleHighlight string   `json:"title_highlight"`
+}
+
+// response envelope for paginated search results
+type noteSearchResponse struct {
+	Results    []noteSearchItem `json:"results"`
+	NextCursor *string          `json:"next_cursor"`
+}
+
+// builds the search envelope, next_cursor is null on the last page
+func newNoteSearchResponse(page *repository.NoteSearchPage, render bool) (noteSearchResponse, error) {
+	res := noteSearchResponse{Results: make([]noteSearchItem, 0, len(page.Results))}
+	for i := range page.Results {
+		r := &page.Results[i]
+		note, err := newNoteView(&r.Note, render)
+		if err != nil {
+			return noteSearchResponse{}, err
+		}
+		res.Results = append(res.Results, noteSearchItem{
+			Note:           note,
+			Rank:           r.Rank,
+			Snippet:        r.Snippet,
+			TitleHighlight: r.TitleHighlight,
+		})
+	}
+	if page.NextCursor != "" {
+		res.NextCursor = &page.NextCursor
+	}
+	return res, nil
+}
+
+// reads limit, cursor, sort, order and filter query params of note listings
+// search additionally accepts sort=relevance, which is also its default
+func parseNoteListOptions(c *gin.Context, search bool) (repository.NoteListOptions, error) {
+	opts := repository.NoteListOptions{
+		Cursor: c.Query("cursor"),
+		// repeat tag to require several, e.g. ?tag=work&tag=urgent
+		Tags: c.QueryArray("tag"),
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > repository.MaxNoteLimit {
+			return opts, errors.New("limit must be between 1 and " + strconv.Itoa(repository.MaxNoteLimit))
+		}
+		opts.Limit = n
+	}
+
+	// sort defaults to date, newest first (relevance for search)
+	if sort := c.Query("sort"); sort != "" {
+		if search && sort == repository.SortRelevance {
+			opts.Sort = sort
+		} else if !repository.IsValidNoteSort(sort) {
+			return opts, errors.New("sort must be one of created, updated, title, date")
+		} else {
+			opts.Sort = sort
+		}
+	}
+	if opts.Sort == "" && search {
+		opts.Sort = repository.SortRelevance
+	}
+	switch c.Query("order") {
+	case "":
+		opts.Desc = opts.Sort != "title"
+	case "asc":
+		opts.Desc = false
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, errors.New("order must be asc or desc")
+	}
+	if opts.Sort == "" {
+		opts.Sort = "date"
+	}
+
+	if pinned := c.Query("pinned"); pinned != "" {
+		value, err := strconv.ParseBool(pinned)
+		if err != nil {
+			return opts, errors.New("pinned must be true or false")
+		}
+		opts.Pinned = &value
+	}
+
+	// ?done=true lists notes whose checklist is complete
+	if done := c.Query("done"); done != "" {
+		value, err := strconv.ParseBool(done)
+		if err != nil {
+			return opts, errors.New("done must be true or false")
+		}
+		opts.ChecklistDone = &value
+	}
+
+	from, err := parseDateParam(c.Query("from"))
+	if err != nil {
+		return opts, errors.New("from must be a date (YYYY-MM-DD) or RFC3339 time")
+	}
+	opts.DateFrom = from
+
+	to, err := parseDateParam(c.Query("to"))
+	if err != nil {
+		return opts, errors.New("to must be a date (YYYY-MM-DD) or RFC3339 time")
+	}
+	// a plain date includes the whole day
+	if to != nil && len(c.Query("to")) == len("2006-01-02") {
+		end := to.AddDate(0, 0, 1)
+		to = &end
+	}
+	opts.DateTo = to
+
+	switch deleted := repository.DeletedFilter(c.Query("deleted")); deleted {
+	case "", repository.DeletedExclude, repository.DeletedOnly, repository.DeletedInclude:
+		opts.Deleted = deleted
+	default:
+		return opts, errors.New("deleted must be exclude, only or include")
+	}
+
+	// archived notes are left out unless asked for, e.g. ?archived=include when searching
+	switch archived := repository.ArchivedFilter(c.Query("archived")); archived {
+	case "", repository.ArchivedExclude, repository.ArchivedOnly, repository.ArchivedInclude:
+		opts.Archived = archived
+	default:
+		return opts, errors.New("archived must be exclude, only or include")
+	}
+
+	return opts, nil
+}
+
+// accepts YYYY-MM-DD or a full RFC3339 timestamp, nil when empty
+func parseDateParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
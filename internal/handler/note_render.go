@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/markdown"
+	"github.com/gin-gonic/gin"
+)
+
+// a note in responses, html and toc are only filled with ?render=html
+// the note's own fields stay at the top level so the shape doesn't change without it
+type noteView struct {
+	model.Note
+	// sanitized, safe to insert into a page as is
+	HTML string `json:"html,omitempty"`
+	// headings of a markdown note in document order, omitted when there are none
+	TOC []markdown.Heading `json:"toc,omitempty"`
+}
+
+// reads ?render=, html is the only format so far
+func parseRenderParam(c *gin.Context) (bool, error) {
+	switch c.Query("render") {
+	case "":
+		return false, nil
+	case "html":
+		return true, nil
+	default:
+		return false, errors.New("render must be html")
+	}
+}
+
+// renders the content according to the note's format
+func newNoteView(note *model.Note, render bool) (noteView, error) {
+	view := noteView{Note: *note}
+	if !render {
+		return view, nil
+	}
+
+	if note.Format == model.NoteFormatMarkdown {
+		html, toc, err := markdown.Render(note.Content)
+		if err != nil {
+			return view, err
+		}
+		view.HTML, view.TOC = html, toc
+		return view, nil
+	}
+	view.HTML = markdown.RenderPlain(note.Content)
+	return view, nil
+}
+
+// newNoteView for every note, never nil so it encodes as []
+func newNoteViews(notes []model.Note, render bool) ([]noteView, error) {
+	views := make([]noteView, 0, len(notes))
+	for i := range notes {
+		view, err := newNoteView(&notes[i], render)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, view)
+	}
+	return views, nil
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type NoteRevisionHandler struct {
+	// uses the revision service layer
+	service service.NoteRevisionService
+}
+
+// constructor for NoteRevisionHandler
+func NewNoteRevisionHandler(service service.NoteRevisionService) *NoteRevisionHandler {
+	return &NoteRevisionHandler{service}
+}
+
+// returns the history of a note, newest first
+func (h *NoteRevisionHandler) ListRevisions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	revisions, err := h.service.List(userID, noteID)
+	if err != nil {
+		respondRevisionError(c, err, "could not fetch revisions")
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+// returns a single revision
+func (h *NoteRevisionHandler) GetRevision(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || rev < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+		return
+	}
+
+	revision, err := h.service.Get(userID, noteID, rev)
+	if err != nil {
+		respondRevisionError(c, err, "could not fetch revision")
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+// line-level diff between ?from=<rev> and ?to=<rev>
+func (h *NoteRevisionHandler) DiffRevisions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+	from, fromErr := strconv.Atoi(c.Query("from"))
+	to, toErr := strconv.Atoi(c.Query("to"))
+	if fromErr != nil || toErr != nil || from < 1 || to < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be revision numbers"})
+		return
+	}
+
+	result, err := h.service.Diff(userID, noteID, from, to)
+	if err != nil {
+		respondRevisionError(c, err, "could not diff revisions")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// rolls the note back to a revision, which itself becomes a new revision
+func (h *NoteRevisionHandler) RestoreRevision(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || rev < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+		return
+	}
+
+	note, err := h.service.Restore(userID, noteID, rev)
+	if err != nil {
+		respondRevisionError(c, err, "could not restore revision")
+		return
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
+// revision errors first, then the usual note errors
+func respondRevisionError(c *gin.Context, err error, fallback string) {
+	if errors.Is(err, service.ErrRevisionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	respondNoteError(c, err, fallback)
+}
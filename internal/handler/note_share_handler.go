@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type NoteShareHandler struct {
+	// uses the share service layer
+	service service.NoteShareService
+}
+
+// constructor for NoteShareHandler
+func NewNoteShareHandler(service service.NoteShareService) *NoteShareHandler {
+	return &NoteShareHandler{service}
+}
+
+// response item for a collaborator, never exposes more of the user than name and email
+type noteShareItem struct {
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	GrantedBy uint      `json:"granted_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newNoteShareItem(share *model.NoteShare) noteShareItem {
+	return noteShareItem{
+		UserID:    share.UserID,
+		Username:  share.User.Username,
+		Email:     share.User.Email,
+		Role:      share.Role,
+		GrantedBy: share.GrantedBy,
+		CreatedAt: share.CreatedAt,
+		UpdatedAt: share.UpdatedAt,
+	}
+}
+
+// shares the note with a registered user by email, sharing again changes the role
+func (h *NoteShareHandler) ShareNote(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	var body struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	share, err := h.service.Share(userID, noteID, body.Email, body.Role)
+	if err != nil {
+		respondShareError(c, err, "could not share note")
+		return
+	}
+
+	c.JSON(http.StatusOK, newNoteShareItem(share))
+}
+
+// lists everyone the note is shared with
+func (h *NoteShareHandler) ListShares(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	shares, err := h.service.List(userID, noteID)
+	if err != nil {
+		respondShareError(c, err, "could not fetch shares")
+		return
+	}
+
+	items := make([]noteShareItem, 0, len(shares))
+	for i := range shares {
+		items = append(items, newNoteShareItem(&shares[i]))
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// takes away a user's access, users can also remove themselves
+func (h *NoteShareHandler) RevokeShare(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+	targetID, ok := parseIDParam(c, "userId")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	if err := h.service.Revoke(userID, noteID, targetID); err != nil {
+		respondShareError(c, err, "could not revoke share")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "share revoked"})
+}
+
+// maps share service errors to a response, note errors are handled like everywhere else
+func respondShareError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrShareUserNotFound), errors.Is(err, service.ErrShareNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidShareRole), errors.Is(err, service.ErrShareWithOwner):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondNoteError(c, err, fallback)
+	}
+}
@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type NotebookHandler struct {
+	// uses the notebook service layer
+	service service.NotebookService
+}
+
+// constructor for NotebookHandler
+func NewNotebookHandler(service service.NotebookService) *NotebookHandler {
+	return &NotebookHandler{service}
+}
+
+// returns all notebooks of the logged-in user as a flat list with parent ids
+func (h *NotebookHandler) ListNotebooks(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	notebooks, err := h.service.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch notebooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notebooks)
+}
+
+// creates a notebook, optionally inside another one
+func (h *NotebookHandler) CreateNotebook(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var body struct {
+		Name     string `json:"name"`
+		ParentID *uint  `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	notebook, err := h.service.Create(userID, body.Name, body.ParentID)
+	if err != nil {
+		respondNotebookError(c, err, "could not create notebook")
+		return
+	}
+
+	c.JSON(http.StatusCreated, notebook)
+}
+
+// renames a notebook
+func (h *NotebookHandler) RenameNotebook(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notebook ID"})
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	notebook, err := h.service.Rename(userID, id, body.Name)
+	if err != nil {
+		respondNotebookError(c, err, "could not rename notebook")
+		return
+	}
+
+	c.JSON(http.StatusOK, notebook)
+}
+
+// moves a notebook under another one, "parent_id": null moves it to the top level
+func (h *NotebookHandler) MoveNotebook(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notebook ID"})
+		return
+	}
+
+	var body struct {
+		ParentID *uint `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	notebook, err := h.service.Move(userID, id, body.ParentID)
+	if err != nil {
+		respondNotebookError(c, err, "could not move notebook")
+		return
+	}
+
+	c.JSON(http.StatusOK, notebook)
+}
+
+// lists child notebooks and a page of notes, ?recursive=true includes every level below
+func (h *NotebookHandler) GetContents(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notebook ID"})
+		return
+	}
+
+	opts, err := parseNoteListOptions(c, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	render, err := parseRenderParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	contents, err := h.service.Contents(userID, id, c.Query("recursive") == "true", opts)
+	if err != nil {
+		respondNotebookError(c, err, "could not fetch notebook contents")
+		return
+	}
+
+	notebooks := contents.Notebooks
+	if notebooks == nil {
+		notebooks = []model.Notebook{}
+	}
+	notes, err := newNotePageResponse(contents.Notes, render)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not render notes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notebook":    contents.Notebook,
+		"notebooks":   notebooks,
+		"notes":       notes.Notes,
+		"next_cursor": notes.NextCursor,
+	})
+}
+
+// soft-deletes the notebook with everything inside it
+func (h *NotebookHandler) DeleteNotebook(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notebook ID"})
+		return
+	}
+
+	if err := h.service.Delete(userID, id); err != nil {
+		respondNotebookError(c, err, "could not delete notebook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "notebook soft deleted"})
+}
+
+// restores a notebook with everything that was deleted together with it
+func (h *NotebookHandler) RestoreNotebook(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid notebook ID"})
+		return
+	}
+
+	if err := h.service.Restore(userID, id); err != nil {
+		respondNotebookError(c, err, "could not restore notebook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "notebook restored"})
+}
+
+// maps notebook service errors to a response
+func respondNotebookError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrNotebookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidNotebookName), errors.Is(err, service.ErrNotebookCycle), errors.Is(err, service.ErrNotebookNotInTrash):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRestoreExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	default:
+		respondListError(c, err, fallback)
+	}
+}
@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+// window of the upcoming list, in days
+const (
+	defaultUpcomingDays = 7
+	maxUpcomingDays     = 365
+)
+
+type ReminderHandler struct {
+	// uses the reminder service layer
+	service service.ReminderService
+}
+
+// constructor for ReminderHandler
+func NewReminderHandler(service service.ReminderService) *ReminderHandler {
+	return &ReminderHandler{service}
+}
+
+// lists notes with a reminder or due date in the next ?days=7 days
+func (h *ReminderHandler) Upcoming(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	days := defaultUpcomingDays
+	if raw := c.Query("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxUpcomingDays {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and " + strconv.Itoa(maxUpcomingDays)})
+			return
+		}
+		days = n
+	}
+
+	notes, err := h.service.Upcoming(userID, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch upcoming notes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notes)
+}
+
+// lists notes past their due date, most overdue first
+func (h *ReminderHandler) Overdue(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	notes, err := h.service.Overdue(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch overdue notes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notes)
+}
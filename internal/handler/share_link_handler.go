@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type ShareLinkHandler struct {
+	// uses the share link service layer
+	service service.ShareLinkService
+}
+
+// constructor for ShareLinkHandler
+func NewShareLinkHandler(service service.ShareLinkService) *ShareLinkHandler {
+	return &ShareLinkHandler{service}
+}
+
+// response item for a share link, token is only set right after creation
+type shareLinkItem struct {
+	ID          uint       `json:"id"`
+	NoteID      uint       `json:"note_id"`
+	Token       string     `json:"token,omitempty"`
+	Path        string     `json:"path,omitempty"`
+	HasPassword bool       `json:"has_password"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	MaxViews    *int       `json:"max_views"`
+	ViewCount   int        `json:"view_count"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func newShareLinkItem(link *model.ShareLink, token string) shareLinkItem {
+	item := shareLinkItem{
+		ID:          link.ID,
+		NoteID:      link.NoteID,
+		HasPassword: link.PasswordHash != "",
+		ExpiresAt:   link.ExpiresAt,
+		MaxViews:    link.MaxViews,
+		ViewCount:   link.ViewCount,
+		RevokedAt:   link.RevokedAt,
+		CreatedAt:   link.CreatedAt,
+	}
+	if token != "" {
+		item.Token = token
+		item.Path = "/s/" + token
+	}
+	return item
+}
+
+// what a visitor of a public link gets to see, nothing about the owner
+type publicNoteResponse struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Tags      []string  `json:"tags"`
+	Date      time.Time `json:"date"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// creates a public link, every field of the body is optional
+func (h *ShareLinkHandler) CreateLink(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	var body struct {
+		Password  string     `json:"password"`
+		ExpiresAt *time.Time `json:"expires_at"`
+		MaxViews  *int       `json:"max_views"`
+	}
+	// an empty body is a link without restrictions
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+			return
+		}
+	}
+
+	link, token, err := h.service.Create(userID, noteID, service.ShareLinkOptions{
+		Password:  body.Password,
+		ExpiresAt: body.ExpiresAt,
+		MaxViews:  body.MaxViews,
+	})
+	if err != nil {
+		respondShareLinkError(c, err, "could not create share link")
+		return
+	}
+
+	c.JSON(http.StatusCreated, newShareLinkItem(link, token))
+}
+
+// lists the links of a note, tokens aren't stored so they can't be shown again
+func (h *ShareLinkHandler) ListLinks(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+
+	links, err := h.service.List(userID, noteID)
+	if err != nil {
+		respondShareLinkError(c, err, "could not fetch share links")
+		return
+	}
+
+	items := make([]shareLinkItem, 0, len(links))
+	for i := range links {
+		items = append(items, newShareLinkItem(&links[i], ""))
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// revokes a link, it stops working right away
+func (h *ShareLinkHandler) RevokeLink(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	noteID, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note ID"})
+		return
+	}
+	linkID, ok := parseIDParam(c, "linkId")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid link ID"})
+		return
+	}
+
+	if err := h.service.Revoke(userID, noteID, linkID); err != nil {
+		respondShareLinkError(c, err, "could not revoke share link")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "share link revoked"})
+}
+
+// public route, password protected links expect it in the X-Share-Password header
+func (h *ShareLinkHandler) OpenLink(c *gin.Context) {
+	note, err := h.service.Open(c.Param("token"), c.GetHeader("X-Share-Password"))
+	if err != nil {
+		respondShareLinkError(c, err, "could not open share link")
+		return
+	}
+
+	tags := make([]string, 0, len(note.Tags))
+	for _, tag := range note.Tags {
+		tags = append(tags, tag.Name)
+	}
+	// every view is counted, caches must not serve it again
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, publicNoteResponse{
+		Title:     note.Title,
+		Content:   note.Content,
+		Tags:      tags,
+		Date:      note.Date,
+		UpdatedAt: note.UpdatedAt,
+	})
+}
+
+// maps share link service errors to a response, note errors are handled like everywhere else
+func respondShareLinkError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrShareLinkNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrShareLinkExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrShareLinkPasswordWrong):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidShareLink):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		respondNoteError(c, err, fallback)
+	}
+}
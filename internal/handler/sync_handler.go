@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type SyncHandler struct {
+	// uses the sync service layer
+	service service.SyncService
+}
+
+// constructor for SyncHandler
+func NewSyncHandler(service service.SyncService) *SyncHandler {
+	return &SyncHandler{service}
+}
+
+// a permanently deleted note in the change feed
+type syncTombstone struct {
+	NoteID   uint      `json:"note_id"`
+	PurgedAt time.Time `json:"purged_at"`
+}
+
+// response of GET /api/sync, cursor is opaque to clients and passed back as since
+type syncPullResponse struct {
+	Notes      []model.Note    `json:"notes"`
+	Tombstones []syncTombstone `json:"tombstones"`
+	Cursor     string          `json:"cursor"`
+	HasMore    bool            `json:"has_more"`
+}
+
+// returns notes created, changed or moved to the trash and notes deleted for good since the cursor
+// notes in the trash come with DeletedAt set
+func (h *SyncHandler) Pull(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var since int64
+	if raw := c.Query("since"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid since cursor"})
+			return
+		}
+		since = n
+	}
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = n
+	}
+
+	page, err := h.service.Pull(userID, since, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch changes"})
+		return
+	}
+
+	res := syncPullResponse{
+		Notes:      page.Notes,
+		Tombstones: make([]syncTombstone, 0, len(page.Tombstones)),
+		Cursor:     strconv.FormatInt(page.Cursor, 10),
+		HasMore:    page.HasMore,
+	}
+	for _, t := range page.Tombstones {
+		res.Tombstones = append(res.Tombstones, syncTombstone{NoteID: t.NoteID, PurgedAt: t.PurgedAt})
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// applies a batch of offline changes, each one gets its own result
+// clients pull afterwards to pick up their own writes with the new cursor
+func (h *SyncHandler) Push(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var body struct {
+		Changes []service.SyncChange `json:"changes"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	results, err := h.service.Push(userID, body.Changes)
+	if errors.Is(err, service.ErrSyncBatchTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "max_changes": service.MaxSyncBatch})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not apply changes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
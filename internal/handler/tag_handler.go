@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/dassajib/prohor-api/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type TagHandler struct {
+	// uses the tag service layer
+	service service.TagService
+}
+
+// constructor for TagHandler
+func NewTagHandler(service service.TagService) *TagHandler {
+	return &TagHandler{service}
+}
+
+// returns all tags of the logged-in user
+func (h *TagHandler) ListTags(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	tags, err := h.service.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not fetch tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// creates a tag with a name and an optional color
+func (h *TagHandler) CreateTag(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	var body struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	tag, err := h.service.Create(userID, body.Name, body.Color)
+	if err != nil {
+		respondTagError(c, err, "could not create tag")
+		return
+	}
+
+	c.JSON(http.StatusCreated, tag)
+}
+
+// renames and/or recolors a tag, missing fields are left unchanged
+func (h *TagHandler) UpdateTag(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag ID"})
+		return
+	}
+
+	var body struct {
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	tag, err := h.service.Update(userID, id, body.Name, body.Color)
+	if err != nil {
+		respondTagError(c, err, "could not update tag")
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// moves every note of the tag in the url to the tag in the body and deletes the first one
+func (h *TagHandler) MergeTag(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag ID"})
+		return
+	}
+
+	var body struct {
+		IntoID uint `json:"into_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.IntoID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	tag, err := h.service.Merge(userID, id, body.IntoID)
+	if err != nil {
+		respondTagError(c, err, "could not merge tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// deletes a tag, its notes are kept
+func (h *TagHandler) DeleteTag(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag ID"})
+		return
+	}
+
+	if err := h.service.Delete(userID, id); err != nil {
+		respondTagError(c, err, "could not delete tag")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "tag deleted"})
+}
+
+// maps tag service errors to a response
+func respondTagError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrTagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrTagExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidTagName), errors.Is(err, service.ErrInvalidColor), errors.Is(err, service.ErrMergeSameTag):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,18 +1,21 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/dassajib/prohor-api/internal/service"
 	"github.com/gin-gonic/gin"
 )
 
 type UserHandler struct {
-	service service.UserService
+	service     service.UserService
+	revocations service.TokenRevocationService
 }
 
-func NewUserHandler(service service.UserService) *UserHandler {
-	return &UserHandler{service: service}
+func NewUserHandler(service service.UserService, revocations service.TokenRevocationService) *UserHandler {
+	return &UserHandler{service: service, revocations: revocations}
 }
 
 func (h *UserHandler) Register(c *gin.Context) {
@@ -65,3 +68,88 @@ func (h *UserHandler) Login(c *gin.Context) {
 		"refresh_token": refreshToken,
 	})
 }
+
+func (h *UserHandler) Refresh(c *gin.Context) {
+	// refresh token is sent in the body, not in the auth header
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil || body.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+		return
+	}
+
+	// call service layer to rotate the token pair
+	token, refreshToken, err := h.service.Refresh(body.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":  token,
+		"refresh_token": refreshToken,
+	})
+}
+
+func (h *UserHandler) Logout(c *gin.Context) {
+	// token info set by auth middleware
+	userID := c.MustGet("user_id").(uint)
+	tokenID := c.MustGet("token_id").(string)
+	expiresAt := c.MustGet("token_expires_at").(time.Time)
+
+	// refresh token is optional, when given its family is revoked as well
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
+			return
+		}
+	}
+
+	if body.RefreshToken != "" {
+		if err := h.service.Logout(userID, body.RefreshToken); err != nil {
+			if errors.Is(err, service.ErrInvalidRefreshToken) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not log out"})
+			return
+		}
+	}
+
+	// current access token stops working right away
+	if err := h.revocations.RevokeToken(tokenID, userID, expiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out."})
+}
+
+func (h *UserHandler) LogoutAll(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	tokenID := c.MustGet("token_id").(string)
+	expiresAt := c.MustGet("token_expires_at").(time.Time)
+
+	// revokes every access and refresh token issued so far
+	if err := h.revocations.RevokeAllForUser(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not log out"})
+		return
+	}
+
+	// the cutoff has second precision, so revoke the current token explicitly
+	if err := h.revocations.RevokeToken(tokenID, userID, expiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out from all devices."})
+}
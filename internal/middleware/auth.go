@@ -1,15 +1,22 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
 
+	"github.com/dassajib/prohor-api/internal/pkg/utils"
+	"github.com/dassajib/prohor-api/internal/service"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// reports whether the token of the request still works, revoked and expired ones don't
+// long-lived connections call it now and then since the middleware only ran when they opened
+type TokenCheck func() bool
+
+// accepts a JWT access token or a personal access token
+func AuthMiddleware(revocations service.TokenRevocationService, accessTokens service.AccessTokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// extract and validate auth header format
 		authHeader := c.GetHeader("Authorization")
@@ -20,31 +27,124 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		// extract raw token (removes "Bearer " prefix)
 		tokenStr := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
-
-		// parse and validate jwt using secret from .env
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-			return []byte(os.Getenv("ACCESS_SECRET")), nil
-		})
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		// personal access tokens are told apart by their prefix, a JWT never starts with it
+		if strings.HasPrefix(tokenStr, service.AccessTokenPrefix) {
+			authenticateAccessToken(c, accessTokens, tokenStr)
 			return
 		}
+		authenticate(c, revocations, tokenStr)
+	}
+}
 
-		// extract and type-convert user ID from token claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+// lets login sessions through and personal access tokens only if they carry the scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasScope(c, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token is missing the " + scope + " scope."})
 			return
 		}
+		c.Next()
+	}
+}
 
-		userID, ok := claims["user_id"].(float64)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+// RequireScope for a whole group: reading needs the read scope, every other method the write scope
+func RequireScopeByMethod(writeScope string) gin.HandlerFunc {
+	read, write := RequireScope(service.ScopeRead), RequireScope(writeScope)
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			read(c)
 			return
 		}
+		write(c)
+	}
+}
 
-		// attach user ID to context for downstream handlers
-		c.Set("user_id", uint(userID))
+// for routes that manage credentials, a personal access token can't be used to log out or mint new tokens
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("token_scopes"); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Personal access tokens can't be used here."})
+			return
+		}
 		c.Next()
 	}
 }
+
+// same checks as AuthMiddleware for websocket upgrades
+// browsers can't set headers on a websocket handshake, so the token may also come as ?access_token=
+func WebSocketAuthMiddleware(revocations service.TokenRevocationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenStr := c.Query("access_token")
+		if authHeader := c.GetHeader("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+			tokenStr = strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+		}
+		if tokenStr == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing or malformed token."})
+			return
+		}
+		authenticate(c, revocations, tokenStr)
+	}
+}
+
+// validates an access token and puts its claims into the context, aborts with 401 otherwise
+func authenticate(c *gin.Context, revocations service.TokenRevocationService, tokenStr string) {
+	// parse and validate jwt using secret from .env
+	claims, err := utils.ParseAccessToken(tokenStr)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+
+	// reject tokens that were logged out before they expired
+	revoked, err := revocations.IsRevoked(claims.TokenID, claims.UserID, claims.IssuedAt)
+	if err != nil || revoked {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+		return
+	}
+
+	// attach user ID and token info to context for downstream handlers
+	c.Set("user_id", claims.UserID)
+	c.Set("token_id", claims.TokenID)
+	c.Set("token_expires_at", claims.ExpiresAt)
+	c.Set("token_valid", TokenCheck(func() bool {
+		revoked, err := revocations.IsRevoked(claims.TokenID, claims.UserID, claims.IssuedAt)
+		return err == nil && !revoked
+	}))
+	c.Next()
+}
+
+// validates a personal access token, its scopes go into the context for RequireScope
+func authenticateAccessToken(c *gin.Context, accessTokens service.AccessTokenService, tokenStr string) {
+	token, err := accessTokens.Authenticate(tokenStr)
+	if errors.Is(err, service.ErrInvalidAccessToken) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Could not check token"})
+		return
+	}
+
+	c.Set("user_id", token.UserID)
+	c.Set("access_token_id", token.ID)
+	c.Set("token_scopes", token.Scopes)
+	// event streams end when the token expires
+	if token.ExpiresAt != nil {
+		c.Set("token_expires_at", *token.ExpiresAt)
+	}
+	c.Set("token_valid", TokenCheck(func() bool {
+		_, err := accessTokens.Authenticate(tokenStr)
+		return err == nil
+	}))
+	c.Next()
+}
+
+// login sessions carry no scopes and may do everything
+func hasScope(c *gin.Context, scope string) bool {
+	value, ok := c.Get("token_scopes")
+	if !ok {
+		return true
+	}
+	scopes, _ := value.([]string)
+	return slices.Contains(scopes, scope)
+}
@@ -0,0 +1,20 @@
+package model
+
+import "time"
+
+// long-lived token for scripts and integrations, sent as "Bearer phr_..." like an access token
+// only the hash is stored, the token itself is shown once when created
+type AccessToken struct {
+	ID     uint   `gorm:"primaryKey"`
+	UserID uint   `gorm:"not null;index"`
+	Name   string `gorm:"not null;size:100"`
+	// first characters of the token so users can tell their tokens apart
+	Prefix    string `gorm:"not null;size:16"`
+	TokenHash string `gorm:"not null;uniqueIndex;size:64" json:"-"`
+	// what the token may do, see service.AccessTokenScopes
+	Scopes []string `gorm:"serializer:json;type:text"`
+	// nil when the token never expires
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// file attached to a note, the bytes live in storage under StorageKey
+// rows outlive their note on purpose, the orphan sweep removes row and file together
+type Attachment struct {
+	ID     uint `gorm:"primaryKey"`
+	NoteID uint `gorm:"not null;index"`
+	// owner of the note, the storage quota is per owner
+	UserID uint `gorm:"not null;index"`
+	// who uploaded the file, may be a collaborator
+	UploadedBy uint   `gorm:"not null"`
+	FileName   string `gorm:"not null;size:255"`
+	// sniffed from the content, never taken from the client
+	ContentType string `gorm:"not null;size:100"`
+	Size        int64  `gorm:"not null"`
+	// sha256 of the content as hex
+	Checksum   string `gorm:"not null;size:64"`
+	StorageKey string `gorm:"not null;size:255" json:"-"`
+	CreatedAt  time.Time
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// secret of a user's calendar feed, calendar apps can't log in so the url is the credential
+// a user has at most one, regenerating it replaces the old one
+type CalendarToken struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"not null;uniqueIndex"`
+	// sha256 of the token, the token itself is only shown once
+	TokenHash string `gorm:"not null;uniqueIndex;size:64" json:"-"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// one entry of a note's checklist, positions of a note run from 0 without gaps
+type ChecklistItem struct {
+	ID        uint   `gorm:"primaryKey"`
+	NoteID    uint   `gorm:"not null;index:idx_checklist_items_note_position"`
+	Text      string `gorm:"not null;size:500"`
+	Checked   bool   `gorm:"not null;default:false"`
+	Position  int    `gorm:"not null;index:idx_checklist_items_note_position"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
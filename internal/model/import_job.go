@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// sources an import job can read
+const (
+	ImportSourceEnex = "enex"
+	ImportSourceKeep = "keep"
+)
+
+// states of an import job, done and failed are final
+const (
+	ImportStatusQueued  = "queued"
+	ImportStatusRunning = "running"
+	ImportStatusDone    = "done"
+	ImportStatusFailed  = "failed"
+)
+
+// a notes import running in the background, the uploaded file lives in storage until the job ends
+type ImportJob struct {
+	ID     uint `gorm:"primaryKey"`
+	UserID uint `gorm:"not null;index"`
+	// enex or keep
+	Source   string `gorm:"not null;size:16"`
+	FileName string `gorm:"not null;size:255"`
+	Status   string `gorm:"not null;size:16;index"`
+	// notes found in the file, known once the job started
+	Total     int `gorm:"not null;default:0"`
+	Processed int `gorm:"not null;default:0"`
+	Imported  int `gorm:"not null;default:0"`
+	Failed    int `gorm:"not null;default:0"`
+	// why single notes failed, only the first ones are kept
+	Failures []ImportFailure `gorm:"serializer:json;type:text"`
+	// why the whole job failed
+	Error      string `gorm:"size:500"`
+	StorageKey string `gorm:"size:255" json:"-"`
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// a note that couldn't be imported, Item names it by title or file
+type ImportFailure struct {
+	Item  string
+	Error string
+}
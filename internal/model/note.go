@@ -6,19 +6,59 @@ import (
 	"gorm.io/gorm"
 )
 
+// how a note's content is meant to be read
+const (
+	NoteFormatPlain    = "plain"
+	NoteFormatMarkdown = "markdown"
+)
+
 type Note struct {
 	ID     uint `gorm:"primaryKey"`
 	UserID uint `gorm:"not null"`
+	// nil when the note isn't filed in a notebook
+	NotebookID *uint `gorm:"index"`
 	// User User `gorm:"foreignKey:UserID"`
-	Title     string `gorm:"not null;size:255"`
-	Content   string `gorm:"type:text"`
-	Tag       string `gorm:"not null;size:30"`
-	Date      time.Time
-	Pinned    bool `gorm:"default:false"`
+	Title   string `gorm:"not null;size:255"`
+	Content string `gorm:"type:text"`
+	// plain or markdown, decides how ?render=html renders the content
+	Format string `gorm:"size:16;not null;default:plain"`
+	// labels of the note, join rows go away with the note or the tag
+	Tags   []Tag `gorm:"many2many:note_tags;constraint:OnDelete:CASCADE"`
+	Date   time.Time
+	Pinned bool `gorm:"default:false"`
+	// set while the note is archived, archived notes are hidden from the default listing but not deleted
+	ArchivedAt *time.Time `gorm:"index"`
+	// next time the owner gets reminded, cleared once a one-off reminder fired
+	RemindAt *time.Time `gorm:"index"`
+	DueAt    *time.Time `gorm:"index"`
+	// RRULE subset repeating the reminder, see pkg/rrule
+	Recurrence string `gorm:"size:255"`
+	// when set the note shows up as an event in calendar feeds
+	EventAt *time.Time
+	// checklist progress, kept in sync with ChecklistItems by the repository
+	ChecklistTotal int `gorm:"not null;default:0"`
+	ChecklistDone  int `gorm:"not null;default:0"`
+	// bumped on every write, sent to clients as ETag for optimistic concurrency
+	Version uint `gorm:"not null;default:1"`
+	// position in the owner's change feed, set by a database trigger on every write
+	ChangeSeq int64 `gorm:"not null;default:0"`
+	// id the offline client gave a note it created, makes retried uploads idempotent
+	ClientID  *string `gorm:"size:64"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	// for soft delete
 	// `gorm:"index"` | create index col for fast query
 	// when soft delete, this field will mark instead of delete
 	DeletedAt gorm.DeletedAt `gorm:"index"`
+	// history is removed together with the note, never serialized with it
+	Revisions []NoteRevision `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	// other users the note is shared with, grants go away with the note
+	Shares []NoteShare `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	// public links stop working once the note is gone
+	ShareLinks []ShareLink `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	// served by the checklist endpoints, listings only carry the counts
+	ChecklistItems []ChecklistItem `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	// [[links]] in the content, and links of other notes pointing here
+	Links     []NoteLink `gorm:"foreignKey:SourceID;constraint:OnDelete:CASCADE" json:"-"`
+	Backlinks []NoteLink `gorm:"foreignKey:TargetID;constraint:OnDelete:SET NULL" json:"-"`
 }
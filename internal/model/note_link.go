@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// a [[...]] reference from one note to another, rebuilt from the content on every write
+type NoteLink struct {
+	ID uint `gorm:"primaryKey"`
+	// owner of the source note, links only resolve to notes of the same owner
+	UserID   uint `gorm:"not null;index"`
+	SourceID uint `gorm:"not null;index"`
+	// nil while no note has the linked title, or once the target was deleted for good
+	TargetID *uint `gorm:"index"`
+	// title as written in [[Title]], empty for [[id:123]] links
+	TargetTitle string `gorm:"size:255"`
+	CreatedAt   time.Time
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// immutable snapshot of a note after a create or update
+type NoteRevision struct {
+	ID uint `gorm:"primaryKey"`
+	// Rev counts up from 1 per note
+	NoteID uint `gorm:"not null;uniqueIndex:idx_note_revisions_note_rev"`
+	Rev    int  `gorm:"not null;uniqueIndex:idx_note_revisions_note_rev"`
+	// owner of the note, the revision cap is per owner
+	UserID uint `gorm:"not null;index"`
+	// who made the change
+	AuthorID  uint     `gorm:"not null"`
+	Title     string   `gorm:"not null;size:255"`
+	Content   string   `gorm:"type:text"`
+	TagNames  []string `gorm:"serializer:json;type:text"`
+	CreatedAt time.Time
+}
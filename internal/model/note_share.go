@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// roles a note can be shared with, each one includes the permissions of the one before
+const (
+	ShareRoleViewer = "viewer"
+	ShareRoleEditor = "editor"
+	ShareRoleOwner  = "owner"
+)
+
+// grants another user access to a note, one grant per note and user
+type NoteShare struct {
+	ID     uint `gorm:"primaryKey"`
+	NoteID uint `gorm:"not null;uniqueIndex:idx_note_shares_note_user"`
+	UserID uint `gorm:"not null;uniqueIndex:idx_note_shares_note_user;index"`
+	User   User `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	// one of viewer, editor, owner
+	Role string `gorm:"not null;size:10"`
+	// user who created or last changed the grant
+	GrantedBy uint `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
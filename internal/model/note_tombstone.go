@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// left behind by a permanently deleted note so sync clients learn it's gone
+// written by a database trigger, never by the api itself
+type NoteTombstone struct {
+	ID        uint  `gorm:"primaryKey"`
+	NoteID    uint  `gorm:"not null"`
+	UserID    uint  `gorm:"not null;index:idx_note_tombstones_user_seq,priority:1"`
+	ChangeSeq int64 `gorm:"not null;index:idx_note_tombstones_user_seq,priority:2"`
+	PurgedAt  time.Time
+}
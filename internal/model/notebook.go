@@ -0,0 +1,20 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// folder for notes, notebooks without a parent sit at the top level
+type Notebook struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	ParentID  *uint  `gorm:"index"`
+	Name      string `gorm:"not null;size:100"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// deleting a notebook soft-deletes its whole subtree with the same timestamp,
+	// so restoring it only brings back what was deleted together with it
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
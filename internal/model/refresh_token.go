@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// one row per refresh token we ever issued
+// tokens created by the same login share a FamilyID, so a replayed token can revoke all of them
+type RefreshToken struct {
+	ID       uint   `gorm:"primaryKey"`
+	UserID   uint   `gorm:"not null;index"`
+	TokenID  string `gorm:"not null;uniqueIndex;size:64"`
+	FamilyID string `gorm:"not null;index;size:64"`
+	// set once the token was exchanged for a new pair
+	RotatedAt *time.Time
+	// set when the whole family is no longer usable
+	RevokedAt *time.Time
+	ExpiresAt time.Time `gorm:"not null"`
+	CreatedAt time.Time
+}
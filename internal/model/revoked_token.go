@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// access token that was logged out before it expired
+// rows are only needed until ExpiresAt, after that the token is rejected anyway
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	TokenID   string    `gorm:"not null;uniqueIndex;size:64"`
+	UserID    uint      `gorm:"not null;index"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
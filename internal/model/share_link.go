@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// public read-only link to a note, anyone with the token can read the note
+type ShareLink struct {
+	ID     uint `gorm:"primaryKey"`
+	NoteID uint `gorm:"not null;index"`
+	// user who created the link
+	CreatedBy uint `gorm:"not null"`
+	// sha256 of the token, the token itself is only shown once on creation
+	TokenHash string `gorm:"not null;uniqueIndex;size:64" json:"-"`
+	// bcrypt hash, empty when the link has no password
+	PasswordHash string `json:"-"`
+	// nil means the link never expires
+	ExpiresAt *time.Time
+	// nil means unlimited views
+	MaxViews  *int
+	ViewCount int `gorm:"not null;default:0"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
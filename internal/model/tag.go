@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// label a user files notes under, names are unique per user ignoring case
+type Tag struct {
+	ID     uint   `gorm:"primaryKey"`
+	UserID uint   `gorm:"not null;index"`
+	Name   string `gorm:"not null;size:30"`
+	// hex color like #ff8800, empty when the client should pick one
+	Color     string `gorm:"size:7"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
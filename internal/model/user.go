@@ -1,10 +1,16 @@
 package model
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type User struct {
 	gorm.Model
 	Username     string `gorm:"unique;not null"`
 	Email        string `gorm:"unique;not null"`
 	PasswordHash string `gorm:"not null"`
+	// access tokens issued before this moment are rejected (logout from all devices)
+	TokensRevokedAt *time.Time
 }
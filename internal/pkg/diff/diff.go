@@ -0,0 +1,177 @@
+package diff
+
+import "strings"
+
+// kind of change for one line
+type Op string
+
+const (
+	Equal  Op = "equal"
+	Insert Op = "insert"
+	Delete Op = "delete"
+)
+
+// one line of a diff, line numbers are 1-based and 0 when the line doesn't exist on that side
+type Line struct {
+	Op      Op     `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line"`
+	NewLine int    `json:"new_line"`
+}
+
+// edit distance after which the search gives up, the trace it keeps grows with its square
+const maxEditDistance = 1000
+
+// Lines compares two texts line by line with the Myers algorithm,
+// the result is the shortest edit script from old to new
+// texts that differ in more than maxEditDistance lines are shown as the changed block
+// deleted and inserted as a whole
+func Lines(old, new string) []Line {
+	a := splitLines(old)
+	b := splitLines(new)
+
+	// lines unchanged at both ends don't need the search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]Line, 0, len(a)+len(b)-prefix-suffix)
+	for i := 0; i < prefix; i++ {
+		lines = append(lines, Line{Op: Equal, Text: a[i], OldLine: i + 1, NewLine: i + 1})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	var middle []Line
+	if trace, ok := shortestEdit(midA, midB); ok {
+		middle = build(midA, midB, trace)
+	} else {
+		middle = replace(midA, midB)
+	}
+	for _, line := range middle {
+		if line.OldLine > 0 {
+			line.OldLine += prefix
+		}
+		if line.NewLine > 0 {
+			line.NewLine += prefix
+		}
+		lines = append(lines, line)
+	}
+
+	for i := 0; i < suffix; i++ {
+		lines = append(lines, Line{
+			Op:      Equal,
+			Text:    a[len(a)-suffix+i],
+			OldLine: len(a) - suffix + i + 1,
+			NewLine: len(b) - suffix + i + 1,
+		})
+	}
+	return lines
+}
+
+// every old line deleted, then every new line inserted
+func replace(a, b []string) []Line {
+	lines := make([]Line, 0, len(a)+len(b))
+	for i, text := range a {
+		lines = append(lines, Line{Op: Delete, Text: text, OldLine: i + 1})
+	}
+	for i, text := range b {
+		lines = append(lines, Line{Op: Insert, Text: text, NewLine: i + 1})
+	}
+	return lines
+}
+
+// splits on \n, an empty text has no lines
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// forward pass of Myers' algorithm, returns the frontier before every step for backtracking
+// only diagonals -d-1..d+1 are kept per step, so memory grows with the square of the edit distance
+// reports false when the distance is over maxEditDistance
+func shortestEdit(a, b []string) ([][]int, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		if d > maxEditDistance {
+			return nil, false
+		}
+		snapshot := make([]int, 2*d+3)
+		copy(snapshot, v[offset-d-1:offset+d+2])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return trace, true
+			}
+		}
+	}
+	return trace, true
+}
+
+// walks the trace backwards and turns it into diff lines in document order
+func build(a, b []string, trace [][]int) []Line {
+	x, y := len(a), len(b)
+
+	var reversed []Line
+	for d := len(trace) - 1; d >= 0; d-- {
+		// snapshot of step d starts at diagonal -d-1
+		v := trace[d]
+		offset := d + 1
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		// diagonal moves are unchanged lines
+		for x > prevX && y > prevY {
+			reversed = append(reversed, Line{Op: Equal, Text: a[x-1], OldLine: x, NewLine: y})
+			x--
+			y--
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			reversed = append(reversed, Line{Op: Insert, Text: b[y-1], NewLine: y})
+		} else {
+			reversed = append(reversed, Line{Op: Delete, Text: a[x-1], OldLine: x})
+		}
+		x, y = prevX, prevY
+	}
+
+	lines := make([]Line, len(reversed))
+	for i, line := range reversed {
+		lines[len(reversed)-1-i] = line
+	}
+	return lines
+}
@@ -0,0 +1,127 @@
+package diff
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func eq(text string, oldLine, newLine int) Line {
+	return Line{Op: Equal, Text: text, OldLine: oldLine, NewLine: newLine}
+}
+
+func ins(text string, newLine int) Line {
+	return Line{Op: Insert, Text: text, NewLine: newLine}
+}
+
+func del(text string, oldLine int) Line {
+	return Line{Op: Delete, Text: text, OldLine: oldLine}
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     []Line
+	}{
+		{"both empty", "", "", []Line{}},
+		{"unchanged", "a\nb\n", "a\nb", []Line{eq("a", 1, 1), eq("b", 2, 2)}},
+		{"from empty", "", "a\nb", []Line{ins("a", 1), ins("b", 2)}},
+		{"to empty", "a\nb", "", []Line{del("a", 1), del("b", 2)}},
+		{"line added in the middle", "a\nc", "a\nb\nc", []Line{eq("a", 1, 1), ins("b", 2), eq("c", 2, 3)}},
+		{"line removed in the middle", "a\nb\nc", "a\nc", []Line{eq("a", 1, 1), del("b", 2), eq("c", 3, 2)}},
+		{"line changed", "a\nb\nc", "a\nB\nc", []Line{eq("a", 1, 1), del("b", 2), ins("B", 2), eq("c", 3, 3)}},
+		{
+			"moved line",
+			"a\nb\nc\nd", "b\nc\na\nd",
+			[]Line{del("a", 1), eq("b", 2, 1), eq("c", 3, 2), ins("a", 3), eq("d", 4, 4)},
+		},
+		{
+			"repeated lines",
+			"x\ny\nx\ny", "y\nx\ny\nx",
+			[]Line{del("x", 1), eq("y", 2, 1), eq("x", 3, 2), eq("y", 4, 3), ins("x", 4)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines(%q, %q) = %v, want %v", tt.old, tt.new, got, tt.want)
+			}
+		})
+	}
+}
+
+// the diff must be an edit script, replaying it gives back both texts
+func TestLinesRebuildsBothSides(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+	}{
+		{"small edit in a long text", numbered(0, 5000, ""), numbered(0, 2500, "") + "new\n" + numbered(2500, 5000, "")},
+		{"everything changed", numbered(0, 3000, "old "), numbered(0, 3000, "new ")},
+		{"some lines changed", numbered(0, 50, ""), strings.Replace(numbered(0, 50, ""), "line 7\n", "line seven\n", 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := Lines(tt.old, tt.new)
+
+			var old, new []string
+			for _, line := range lines {
+				if line.Op != Insert {
+					old = append(old, line.Text)
+					if line.OldLine != len(old) {
+						t.Fatalf("old line number = %d, want %d", line.OldLine, len(old))
+					}
+				}
+				if line.Op != Delete {
+					new = append(new, line.Text)
+					if line.NewLine != len(new) {
+						t.Fatalf("new line number = %d, want %d", line.NewLine, len(new))
+					}
+				}
+			}
+			if got := strings.Join(old, "\n") + "\n"; got != tt.old {
+				t.Error("old side of the diff doesn't match the old text")
+			}
+			if got := strings.Join(new, "\n") + "\n"; got != tt.new {
+				t.Error("new side of the diff doesn't match the new text")
+			}
+		})
+	}
+}
+
+// texts too far apart are shown as one replaced block instead of searching for the shortest script
+func TestLinesFallsBackToReplace(t *testing.T) {
+	n := maxEditDistance
+	old := "same\n" + numbered(0, n, "old ") + "end\n"
+	new := "same\n" + numbered(0, n, "new ") + "end\n"
+
+	lines := Lines(old, new)
+	if len(lines) != 2*n+2 {
+		t.Fatalf("len(Lines) = %d, want %d", len(lines), 2*n+2)
+	}
+	if lines[0] != eq("same", 1, 1) || lines[len(lines)-1] != eq("end", n+2, n+2) {
+		t.Errorf("unchanged ends = %v, %v, want them kept", lines[0], lines[len(lines)-1])
+	}
+	for i, line := range lines[1 : n+1] {
+		if want := del(fmt.Sprintf("old line %d", i), i+2); line != want {
+			t.Fatalf("line %d = %v, want %v", i+1, line, want)
+		}
+	}
+	for i, line := range lines[n+1 : 2*n+1] {
+		if want := ins(fmt.Sprintf("new line %d", i), i+2); line != want {
+			t.Fatalf("line %d = %v, want %v", n+i+1, line, want)
+		}
+	}
+}
+
+// lines "<prefix>line from" up to to, each ending in \n
+func numbered(from, to int, prefix string) string {
+	var sb strings.Builder
+	for i := from; i < to; i++ {
+		fmt.Fprintf(&sb, "%sline %d\n", prefix, i)
+	}
+	return sb.String()
+}
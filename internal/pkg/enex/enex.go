@@ -0,0 +1,164 @@
+// Package enex reads Evernote export files (.enex).
+//
+// An export is one XML document with a <note> element per note. Notes are
+// decoded one at a time so large exports don't have to fit in memory, the
+// note body is ENML (XHTML with a few en-* elements) and can be turned into
+// markdown with Markdown.
+package enex
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+var (
+	// the document isn't an Evernote export, reading can't go on
+	ErrInvalid = errors.New("enex: not an Evernote export")
+	// one note couldn't be read, the next one can
+	ErrInvalidNote = errors.New("enex: invalid note")
+)
+
+// layout of ENEX timestamps, always UTC
+const timeLayout = "20060102T150405Z"
+
+// Note is one exported note, attachments are left out.
+type Note struct {
+	Title   string
+	Content string
+	Tags    []string
+	Created time.Time
+	Updated time.Time
+	// set for notes that were in the trash
+	Deleted *time.Time
+	// set for notes with a pending reminder
+	ReminderTime *time.Time
+}
+
+// the elements of <note> this package reads
+type xmlNote struct {
+	Title      string   `xml:"title"`
+	Content    string   `xml:"content"`
+	Created    string   `xml:"created"`
+	Updated    string   `xml:"updated"`
+	Deleted    string   `xml:"deleted"`
+	Tags       []string `xml:"tag"`
+	Attributes struct {
+		ReminderTime     string `xml:"reminder-time"`
+		ReminderDoneTime string `xml:"reminder-done-time"`
+	} `xml:"note-attributes"`
+}
+
+// Reader decodes the notes of an export in document order.
+type Reader struct {
+	dec *xml.Decoder
+}
+
+// NewReader reads an export from r.
+func NewReader(r io.Reader) *Reader {
+	dec := xml.NewDecoder(r)
+	// exports carry a DOCTYPE and entities from the Evernote DTD
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	return &Reader{dec}
+}
+
+// Next returns the next note, io.EOF after the last one.
+// After an error wrapping ErrInvalidNote the reader can go on with the next note.
+func (r *Reader) Next() (*Note, error) {
+	start, err := r.nextNote()
+	if err != nil {
+		return nil, err
+	}
+
+	var raw xmlNote
+	if err := r.dec.DecodeElement(&raw, start); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return raw.note()
+}
+
+// Count returns how many notes the export in r has without decoding them.
+func Count(r io.Reader) (int, error) {
+	reader := NewReader(r)
+	count := 0
+	for {
+		if _, err := reader.nextNote(); err == io.EOF {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+		count++
+		if err := reader.dec.Skip(); err != nil {
+			return count, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+}
+
+// moves to the next <note> start element
+func (r *Reader) nextNote() (*xml.StartElement, error) {
+	for {
+		token, err := r.dec.Token()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "note" {
+			return &start, nil
+		}
+	}
+}
+
+// converts the raw strings, a missing timestamp stays zero
+func (raw *xmlNote) note() (*Note, error) {
+	note := &Note{
+		Title:   strings.TrimSpace(raw.Title),
+		Content: raw.Content,
+	}
+	for _, tag := range raw.Tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			note.Tags = append(note.Tags, tag)
+		}
+	}
+
+	var err error
+	if note.Created, err = parseTime(raw.Created); err != nil {
+		return nil, err
+	}
+	if note.Updated, err = parseTime(raw.Updated); err != nil {
+		return nil, err
+	}
+	if raw.Deleted != "" {
+		deleted, err := parseTime(raw.Deleted)
+		if err != nil {
+			return nil, err
+		}
+		note.Deleted = &deleted
+	}
+	// a done reminder is no longer pending
+	if raw.Attributes.ReminderTime != "" && raw.Attributes.ReminderDoneTime == "" {
+		reminder, err := parseTime(raw.Attributes.ReminderTime)
+		if err != nil {
+			return nil, err
+		}
+		note.ReminderTime = &reminder
+	}
+	return note, nil
+}
+
+func parseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(timeLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: bad timestamp %q", ErrInvalidNote, value)
+	}
+	return t, nil
+}
@@ -0,0 +1,176 @@
+package enex
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const header = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE en-export SYSTEM "http://xml.evernote.com/pub/evernote-export4.dtd">
+<en-export export-date="20261001T120000Z" application="Evernote" version="10.0">
+`
+
+func export(notes ...string) string {
+	return header + strings.Join(notes, "\n") + "\n</en-export>\n"
+}
+
+const firstNote = `<note>
+  <title> Groceries </title>
+  <content><![CDATA[<?xml version="1.0" encoding="UTF-8"?><en-note><div>milk &amp; eggs</div></en-note>]]></content>
+  <created>20260101T080000Z</created>
+  <updated>20260102T090000Z</updated>
+  <tag>home</tag>
+  <tag> </tag>
+  <tag>shopping</tag>
+  <note-attributes>
+    <reminder-time>20260105T100000Z</reminder-time>
+  </note-attributes>
+</note>`
+
+const trashedNote = `<note>
+  <title>Old</title>
+  <content>x</content>
+  <deleted>20260301T000000Z</deleted>
+  <note-attributes>
+    <reminder-time>20260105T100000Z</reminder-time>
+    <reminder-done-time>20260105T110000Z</reminder-done-time>
+  </note-attributes>
+</note>`
+
+func utc(value string) time.Time {
+	t, err := time.Parse(timeLayout, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestReader(t *testing.T) {
+	r := NewReader(strings.NewReader(export(firstNote, trashedNote)))
+
+	note, err := r.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	reminder := utc("20260105T100000Z")
+	want := &Note{
+		Title:        "Groceries",
+		Content:      `<?xml version="1.0" encoding="UTF-8"?><en-note><div>milk &amp; eggs</div></en-note>`,
+		Tags:         []string{"home", "shopping"},
+		Created:      utc("20260101T080000Z"),
+		Updated:      utc("20260102T090000Z"),
+		ReminderTime: &reminder,
+	}
+	if !reflect.DeepEqual(note, want) {
+		t.Errorf("first note = %+v, want %+v", note, want)
+	}
+
+	note, err = r.Next()
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if note.Deleted == nil || !note.Deleted.Equal(utc("20260301T000000Z")) {
+		t.Errorf("Deleted = %v, want 2026-03-01", note.Deleted)
+	}
+	if note.ReminderTime != nil {
+		t.Errorf("ReminderTime = %v, a done reminder isn't pending", note.ReminderTime)
+	}
+	if !note.Created.IsZero() {
+		t.Errorf("Created = %v, want zero when missing", note.Created)
+	}
+
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("Next() after the last note error = %v, want io.EOF", err)
+	}
+}
+
+// a note with a bad value is skipped, the notes after it are still read
+func TestReaderSkipsInvalidNote(t *testing.T) {
+	tests := []struct {
+		name string
+		note string
+	}{
+		{"bad created", `<note><title>a</title><created>yesterday</created></note>`},
+		{"bad updated", `<note><title>a</title><updated>2026-01-01</updated></note>`},
+		{"bad deleted", `<note><title>a</title><deleted>20261301T000000Z</deleted></note>`},
+		{"bad reminder", `<note><title>a</title><note-attributes><reminder-time>soon</reminder-time></note-attributes></note>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(export(tt.note, firstNote)))
+			if _, err := r.Next(); !errors.Is(err, ErrInvalidNote) {
+				t.Fatalf("Next() error = %v, want ErrInvalidNote", err)
+			}
+			note, err := r.Next()
+			if err != nil {
+				t.Fatalf("Next() after the invalid note error = %v", err)
+			}
+			if note.Title != "Groceries" {
+				t.Errorf("Title = %q, want the next note", note.Title)
+			}
+		})
+	}
+}
+
+// a broken document ends reading with ErrInvalid instead of a note
+func TestReaderMalformedExport(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"truncated inside a note", header + `<note><title>Groceries</title><content>milk`},
+		{"truncated between notes", header + firstNote + "\n<no"},
+		{"mismatched tags", header + `<note><title>a</content></note></en-export>`},
+		{"broken tag", header + `<note <title>a</title></note></en-export>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tt.doc))
+			var err error
+			for i := 0; i < 3 && err == nil; i++ {
+				_, err = r.Next()
+			}
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("Next() error = %v, want ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func TestReaderWithoutNotes(t *testing.T) {
+	for _, doc := range []string{"", "not xml at all", header + "</en-export>"} {
+		if _, err := NewReader(strings.NewReader(doc)).Next(); err != io.EOF {
+			t.Errorf("Next() on %q error = %v, want io.EOF", doc, err)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		want    int
+		wantErr bool
+	}{
+		{"two notes", export(firstNote, trashedNote), 2, false},
+		// values aren't checked when counting
+		{"invalid note counts", export(`<note><created>soon</created></note>`), 1, false},
+		{"empty export", export(), 0, false},
+		{"truncated", header + firstNote + `<note><title>a`, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Count(strings.NewReader(tt.doc))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Count() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Count() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package enex
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// characters that would start markdown formatting in plain text
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`")
+
+// runs of blank lines left by nested blocks
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// Markdown converts an ENML body to markdown.
+// Formatting markdown has no syntax for, like colors and fonts, is dropped and
+// attachments (en-media) are left out.
+func Markdown(enml string) string {
+	c := &converter{marks: map[string]int{}}
+	z := html.NewTokenizer(strings.NewReader(enml))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		token := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			c.start(token)
+			if tt == html.SelfClosingTagToken {
+				c.end(token)
+			}
+		case html.EndTagToken:
+			c.end(token)
+		case html.TextToken:
+			c.text(token.Data)
+		}
+	}
+	return c.String()
+}
+
+// one open list, ordered lists count their items
+type list struct {
+	ordered bool
+	n       int
+}
+
+type converter struct {
+	b     strings.Builder
+	lists []list
+	// links waiting for their closing tag, "" for anchors without href
+	links []string
+	pre   int
+	skip  int
+	// open emphasis marks by their markdown, closing tags without an opening one are ignored
+	marks map[string]int
+	// whitespace seen since the last text, written as one space before the next text
+	space bool
+}
+
+func (c *converter) start(t html.Token) {
+	switch t.Data {
+	case "script", "style", "title", "head":
+		c.skip++
+	case "p", "div", "blockquote", "table", "tr":
+		c.newline()
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.blankLine()
+		c.write(strings.Repeat("#", int(t.Data[1]-'0')) + " ")
+	case "br":
+		c.write("\n")
+	case "hr":
+		c.blankLine()
+		c.write("---\n\n")
+	case "ul", "ol":
+		c.newline()
+		c.lists = append(c.lists, list{ordered: t.Data == "ol"})
+	case "li":
+		c.newline()
+		c.write(c.bullet())
+	case "en-todo":
+		// Evernote puts checkboxes in front of plain lines as well as in lists
+		if c.atLineStart() {
+			c.write("- ")
+		}
+		if attr(t, "checked") == "true" {
+			c.write("[x] ")
+		} else {
+			c.write("[ ] ")
+		}
+	case "td", "th":
+		c.write(" | ")
+	case "b", "strong":
+		c.openMark("**")
+	case "i", "em":
+		c.openMark("*")
+	case "s", "strike", "del":
+		c.openMark("~~")
+	case "code":
+		if c.pre == 0 {
+			c.openMark("`")
+		}
+	case "pre":
+		c.blankLine()
+		c.write("```\n")
+		c.pre++
+	case "a":
+		href := attr(t, "href")
+		c.links = append(c.links, href)
+		if href != "" {
+			c.write("[")
+		}
+	}
+}
+
+func (c *converter) end(t html.Token) {
+	switch t.Data {
+	case "script", "style", "title", "head":
+		if c.skip > 0 {
+			c.skip--
+		}
+	case "p", "blockquote", "table":
+		c.blankLine()
+	case "div", "tr", "li":
+		c.newline()
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.blankLine()
+	case "ul", "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		if len(c.lists) == 0 {
+			c.blankLine()
+		}
+	case "b", "strong":
+		c.closeEmphasis("**")
+	case "i", "em":
+		c.closeEmphasis("*")
+	case "s", "strike", "del":
+		c.closeEmphasis("~~")
+	case "code":
+		if c.pre == 0 {
+			c.closeEmphasis("`")
+		}
+	case "pre":
+		if c.pre == 0 {
+			return
+		}
+		c.pre--
+		c.newline()
+		c.write("```\n\n")
+	case "a":
+		if len(c.links) == 0 {
+			return
+		}
+		href := c.links[len(c.links)-1]
+		c.links = c.links[:len(c.links)-1]
+		if href != "" {
+			c.closeMark("](" + href + ")")
+		}
+	}
+}
+
+// html whitespace collapses to one space, inside <pre> it is kept
+func (c *converter) text(s string) {
+	if c.skip > 0 {
+		return
+	}
+	if c.pre > 0 {
+		c.b.WriteString(s)
+		return
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		c.space = c.space || s != ""
+		return
+	}
+	if (c.space || startsWithSpace(s)) && !c.atLineStart() {
+		c.b.WriteByte(' ')
+	}
+	c.b.WriteString(markdownEscaper.Replace(strings.Join(fields, " ")))
+	c.space = endsWithSpace(s)
+}
+
+// opening markup, a pending space is written before it
+func (c *converter) write(s string) {
+	if c.skip > 0 {
+		return
+	}
+	if c.space && !c.atLineStart() && !strings.HasPrefix(s, "\n") {
+		c.b.WriteByte(' ')
+	}
+	c.space = false
+	c.b.WriteString(s)
+}
+
+// emphasis that is closed again by closeEmphasis
+func (c *converter) openMark(s string) {
+	if c.skip > 0 {
+		return
+	}
+	c.marks[s]++
+	c.write(s)
+}
+
+// closes emphasis opened before, anything else is a stray tag of malformed ENML
+func (c *converter) closeEmphasis(s string) {
+	if c.skip > 0 || c.marks[s] == 0 {
+		return
+	}
+	c.marks[s]--
+	c.closeMark(s)
+}
+
+// closing markup sticks to the text before it, a pending space goes after it
+func (c *converter) closeMark(s string) {
+	if c.skip > 0 {
+		return
+	}
+	c.b.WriteString(s)
+}
+
+// ends the current line unless it is empty
+func (c *converter) newline() {
+	c.space = false
+	if !c.atLineStart() {
+		c.b.WriteByte('\n')
+	}
+}
+
+// leaves one empty line before the next block
+func (c *converter) blankLine() {
+	c.newline()
+	if s := c.b.String(); s != "" && !strings.HasSuffix(s, "\n\n") {
+		c.b.WriteByte('\n')
+	}
+}
+
+func (c *converter) atLineStart() bool {
+	s := c.b.String()
+	return s == "" || strings.HasSuffix(s, "\n")
+}
+
+// list marker indented by the depth of the list
+func (c *converter) bullet() string {
+	if len(c.lists) == 0 {
+		return "- "
+	}
+	current := &c.lists[len(c.lists)-1]
+	indent := strings.Repeat("  ", len(c.lists)-1)
+	if !current.ordered {
+		return indent + "- "
+	}
+	current.n++
+	return indent + strconv.Itoa(current.n) + ". "
+}
+
+// trailing spaces and runs of empty lines are dropped
+func (c *converter) String() string {
+	lines := strings.Split(c.b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+func attr(t html.Token, name string) string {
+	for _, a := range t.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func startsWithSpace(s string) bool {
+	return s != "" && strings.TrimLeftFunc(s, unicode.IsSpace) != s
+}
+
+func endsWithSpace(s string) bool {
+	return s != "" && strings.TrimRightFunc(s, unicode.IsSpace) != s
+}
@@ -0,0 +1,36 @@
+package enex
+
+import "testing"
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		enml string
+		want string
+	}{
+		{"empty", "", ""},
+		{"paragraphs", `<en-note><div>one</div><div>two</div></en-note>`, "one\ntwo"},
+		{"heading", `<en-note><h2>Title</h2><p>text</p></en-note>`, "## Title\n\ntext"},
+		{"inline formatting", `<en-note><div><b>bold</b> and <i>italic</i> and <s>gone</s></div></en-note>`, "**bold** and *italic* and ~~gone~~"},
+		{"link", `<en-note><div>see <a href="https://example.com">the site</a></div></en-note>`, "see [the site](https://example.com)"},
+		{"anchor without href", `<en-note><div><a name="x">here</a></div></en-note>`, "here"},
+		{"nested lists", `<en-note><ul><li>a<ol><li>b</li><li>c</li></ol></li><li>d</li></ul></en-note>`, "- a\n  1. b\n  2. c\n- d"},
+		{"todos", `<en-note><div><en-todo checked="true"/>done</div><div><en-todo/>open</div></en-note>`, "- [x] done\n- [ ] open"},
+		{"code block keeps whitespace", "<en-note><pre>a  b\n  c</pre></en-note>", "```\na  b\n  c\n```"},
+		{"markdown characters are escaped", `<en-note><div>2*3_4 \ x</div></en-note>`, `2\*3\_4 \\ x`},
+		{"entities", `<en-note><div>a &amp; b&nbsp;c</div></en-note>`, "a & b c"},
+		{"attachments are left out", `<en-note><div>pic: <en-media type="image/png" hash="abc"/></div></en-note>`, "pic:"},
+		{"scripts and styles are dropped", `<en-note><style>p{}</style><script>alert(1)</script><div>ok</div></en-note>`, "ok"},
+		// malformed ENML still gives the text instead of failing the import
+		{"unclosed tags", `<en-note><div><b>bold<div>next`, "**bold\nnext"},
+		{"stray closing tags", `<en-note></ul></b></a></pre></code><div>text</div></en-note>`, "text"},
+		{"broken tag", `<en-note><div>a < b</div></en-note>`, "a < b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Markdown(tt.enml); got != tt.want {
+				t.Errorf("Markdown(%q) = %q, want %q", tt.enml, got, tt.want)
+			}
+		})
+	}
+}
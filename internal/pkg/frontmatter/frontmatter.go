@@ -0,0 +1,63 @@
+// Package frontmatter reads and writes markdown files that start with a YAML
+// front matter block:
+//
+//	---
+//	title: Groceries
+//	---
+//	the body
+package frontmatter
+
+import (
+	"bytes"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const delimiter = "---"
+
+// Marshal writes v as front matter followed by the body.
+func Marshal(v any, body string) ([]byte, error) {
+	meta, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(delimiter + "\n")
+	buf.Write(meta)
+	buf.WriteString(delimiter + "\n")
+	buf.WriteString(body)
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes the front matter of data into v and returns the body after it.
+// Data without front matter is all body and leaves v untouched.
+func Unmarshal(data []byte, v any) (string, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	first, rest, ok := strings.Cut(text, "\n")
+	if !ok || strings.TrimRight(first, " \t") != delimiter {
+		return text, nil
+	}
+
+	// the block ends at the next line that is only the delimiter
+	var meta strings.Builder
+	for {
+		line, after, more := strings.Cut(rest, "\n")
+		if strings.TrimRight(line, " \t") == delimiter {
+			if err := yaml.Unmarshal([]byte(meta.String()), v); err != nil {
+				return "", err
+			}
+			return after, nil
+		}
+		if !more {
+			// never closed, so it wasn't front matter
+			return text, nil
+		}
+		meta.WriteString(line)
+		meta.WriteByte('\n')
+		rest = after
+	}
+}
@@ -0,0 +1,96 @@
+package frontmatter
+
+import (
+	"reflect"
+	"testing"
+)
+
+type meta struct {
+	Title string   `yaml:"title"`
+	Tags  []string `yaml:"tags,omitempty"`
+	Pin   bool     `yaml:"pinned,omitempty"`
+}
+
+func TestMarshal(t *testing.T) {
+	data, err := Marshal(meta{Title: "Groceries: week 1", Tags: []string{"home"}}, "milk\n")
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := "---\ntitle: 'Groceries: week 1'\ntags:\n    - home\n---\nmilk\n"
+	if string(data) != want {
+		t.Errorf("Marshal() = %q, want %q", data, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		meta meta
+		body string
+	}{
+		{"plain", meta{Title: "a"}, "body"},
+		{"empty body", meta{Title: "a", Pin: true}, ""},
+		{"title that looks like yaml", meta{Title: "---\nkey: value #x"}, "b"},
+		{"body with its own delimiters", meta{Title: "a"}, "---\nnot: meta\n---\ntext\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Marshal(tt.meta, tt.body)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var got meta
+			body, err := Unmarshal(data, &got)
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.meta) {
+				t.Errorf("meta = %+v, want %+v", got, tt.meta)
+			}
+			if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantMeta meta
+		wantBody string
+		wantErr  bool
+	}{
+		{"front matter", "---\ntitle: a\n---\nbody\n", meta{Title: "a"}, "body\n", false},
+		{"byte order mark and CRLF", "\ufeff---\r\ntitle: a\r\n---\r\nline\r\n", meta{Title: "a"}, "line\n", false},
+		{"trailing spaces after delimiters", "--- \ntitle: a\n---\t\nbody", meta{Title: "a"}, "body", false},
+		{"empty block", "---\n---\nbody", meta{}, "body", false},
+		{"ends right after the block", "---\ntitle: a\n---", meta{Title: "a"}, "", false},
+		{"no front matter", "# Heading\ntext", meta{}, "# Heading\ntext", false},
+		{"delimiter not on the first line", "\n---\ntitle: a\n---\n", meta{}, "\n---\ntitle: a\n---\n", false},
+		{"never closed", "---\ntitle: a\nbody", meta{}, "---\ntitle: a\nbody", false},
+		{"only a delimiter", "---", meta{}, "---", false},
+		{"longer rule is not a delimiter", "----\ntitle: a\n----\n", meta{}, "----\ntitle: a\n----\n", false},
+		{"invalid yaml", "---\ntitle: [a\n---\nbody", meta{}, "", true},
+		{"wrong type", "---\ntags: five\n---\n", meta{}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got meta
+			body, err := Unmarshal([]byte(tt.data), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.wantMeta) {
+				t.Errorf("meta = %+v, want %+v", got, tt.wantMeta)
+			}
+			if body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
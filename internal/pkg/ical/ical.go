@@ -0,0 +1,117 @@
+// Package ical writes iCalendar (RFC 5545) documents.
+//
+// It only covers what a subscription feed needs: components, properties with
+// escaped text values, UTC date-times and line folding at 75 octets.
+package ical
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// longest content line in octets, without the CRLF
+const maxLineLength = 75
+
+// layouts of UTC date-time and date values
+const (
+	dateTimeLayout = "20060102T150405Z"
+	dateLayout     = "20060102"
+)
+
+// Writer builds a document line by line, String returns it.
+type Writer struct {
+	b strings.Builder
+}
+
+// Begin opens a component like VCALENDAR or VEVENT.
+func (w *Writer) Begin(component string) {
+	w.line("BEGIN:" + component)
+}
+
+// End closes a component opened by Begin.
+func (w *Writer) End(component string) {
+	w.line("END:" + component)
+}
+
+// Raw writes a property whose value is already in iCalendar syntax, name may carry parameters.
+func (w *Writer) Raw(name, value string) {
+	w.line(name + ":" + value)
+}
+
+// Text writes a property with a text value, skipped when the value is empty.
+func (w *Writer) Text(name, value string) {
+	if value == "" {
+		return
+	}
+	w.Raw(name, EscapeText(value))
+}
+
+// List writes a property with a comma separated list of text values, skipped when empty.
+func (w *Writer) List(name string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	escaped := make([]string, 0, len(values))
+	for _, value := range values {
+		escaped = append(escaped, EscapeText(value))
+	}
+	w.Raw(name, strings.Join(escaped, ","))
+}
+
+// Time writes a property with a date-time value in UTC.
+func (w *Writer) Time(name string, t time.Time) {
+	w.Raw(name, FormatTime(t))
+}
+
+// Date writes a property with a date value, the day of t in UTC.
+func (w *Writer) Date(name string, t time.Time) {
+	w.Raw(name+";VALUE=DATE", t.UTC().Format(dateLayout))
+}
+
+// String returns the document written so far.
+func (w *Writer) String() string {
+	return w.b.String()
+}
+
+// FormatTime formats t as a UTC date-time value.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(dateTimeLayout)
+}
+
+// EscapeText escapes a text value, line breaks become \n and other control characters are dropped.
+func EscapeText(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// folds the line into chunks of at most 75 octets, continuation lines start with a space
+// a chunk never ends in the middle of a UTF-8 sequence
+func (w *Writer) line(s string) {
+	limit := maxLineLength
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.b.WriteString(s[:cut])
+		w.b.WriteString("\r\n ")
+		s = s[cut:]
+		// the leading space counts towards the next line
+		limit = maxLineLength - 1
+	}
+	w.b.WriteString(s)
+	w.b.WriteString("\r\n")
+}
@@ -0,0 +1,109 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"a;b,c", `a\;b\,c`},
+		{`back\slash`, `back\\slash`},
+		{"one\ntwo", `one\ntwo`},
+		{"one\r\ntwo", `one\ntwo`},
+		{"one\rtwo", `one\ntwo`},
+		{"tab\tstays", "tab\tstays"},
+		{"bell\a and nul\x00 and del\x7f", "bell and nul and del"},
+		{"ünïcödé ✓", "ünïcödé ✓"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := EscapeText(tt.in); got != tt.want {
+				t.Errorf("EscapeText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	at := time.Date(2026, 10, 17, 14, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	var w Writer
+	w.Begin("VEVENT")
+	w.Text("SUMMARY", "Lunch; then, walk")
+	w.Text("DESCRIPTION", "")
+	w.List("CATEGORIES", []string{"home", "a,b"})
+	w.List("RESOURCES", nil)
+	w.Time("DTSTAMP", at)
+	w.Date("DTSTART", at)
+	w.Raw("RRULE", "FREQ=WEEKLY")
+	w.End("VEVENT")
+
+	want := "BEGIN:VEVENT\r\n" +
+		"SUMMARY:Lunch\\; then\\, walk\r\n" +
+		"CATEGORIES:home,a\\,b\r\n" +
+		"DTSTAMP:20261017T123000Z\r\n" +
+		"DTSTART;VALUE=DATE:20261017\r\n" +
+		"RRULE:FREQ=WEEKLY\r\n" +
+		"END:VEVENT\r\n"
+	if got := w.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+// the date of an all-day event is the day in UTC
+func TestDateUsesUTCDay(t *testing.T) {
+	var w Writer
+	w.Date("DTSTART", time.Date(2026, 10, 18, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60)))
+	if got, want := w.String(), "DTSTART;VALUE=DATE:20261017\r\n"; got != want {
+		t.Errorf("Date() = %q, want %q", got, want)
+	}
+}
+
+func TestLineFolding(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"short", "hello"},
+		{"exactly the limit", strings.Repeat("a", maxLineLength-len("SUMMARY:"))},
+		{"one over the limit", strings.Repeat("a", maxLineLength-len("SUMMARY:")+1)},
+		{"several lines", strings.Repeat("abcdefghij", 30)},
+		{"multibyte characters", strings.Repeat("ü✓😀", 40)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var w Writer
+			w.Text("SUMMARY", tt.value)
+			out := w.String()
+
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("output %q doesn't end in CRLF", out)
+			}
+			lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			for i, line := range lines {
+				if len(line) > maxLineLength {
+					t.Errorf("line %d is %d octets, want at most %d", i, len(line), maxLineLength)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line %d %q splits a UTF-8 sequence", i, line)
+				}
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %d %q doesn't start with a space", i, line)
+				}
+			}
+
+			// unfolding gives back the property
+			unfolded := strings.ReplaceAll(strings.TrimSuffix(out, "\r\n"), "\r\n ", "")
+			if want := "SUMMARY:" + tt.value; unfolded != want {
+				t.Errorf("unfolded = %q, want %q", unfolded, want)
+			}
+		})
+	}
+}
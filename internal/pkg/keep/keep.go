@@ -0,0 +1,83 @@
+// Package keep reads notes from a Google Keep Takeout archive.
+//
+// Takeout stores every note as a JSON file next to an HTML copy and the
+// note's images, only the JSON files are read here.
+package keep
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// returned for JSON that isn't a Keep note
+var ErrInvalid = errors.New("keep: not a Keep note")
+
+// Note is one Keep note as exported by Takeout.
+type Note struct {
+	Title       string `json:"title"`
+	TextContent string `json:"textContent"`
+	// set instead of TextContent for checklist notes
+	ListContent []ListItem `json:"listContent"`
+	Labels      []Label    `json:"labels"`
+	IsPinned    bool       `json:"isPinned"`
+	IsArchived  bool       `json:"isArchived"`
+	IsTrashed   bool       `json:"isTrashed"`
+	// microseconds since the epoch
+	CreatedTimestampUsec    int64 `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec int64 `json:"userEditedTimestampUsec"`
+}
+
+// ListItem is one entry of a checklist note.
+type ListItem struct {
+	Text      string `json:"text"`
+	IsChecked bool   `json:"isChecked"`
+}
+
+// Label is a Keep label, the counterpart of a tag.
+type Label struct {
+	Name string `json:"name"`
+}
+
+// Parse decodes one note file.
+func Parse(data []byte) (*Note, error) {
+	var note Note
+	if err := json.Unmarshal(data, &note); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	// every note file has an edit time, other JSON in the archive doesn't
+	if note.UserEditedTimestampUsec == 0 && note.CreatedTimestampUsec == 0 {
+		return nil, ErrInvalid
+	}
+	return &note, nil
+}
+
+// Created is when the note was created, zero when the export doesn't say.
+func (n *Note) Created() time.Time {
+	return usec(n.CreatedTimestampUsec)
+}
+
+// Updated is when the note was last edited.
+func (n *Note) Updated() time.Time {
+	return usec(n.UserEditedTimestampUsec)
+}
+
+// LabelNames returns the names of the note's labels without empty ones.
+func (n *Note) LabelNames() []string {
+	var names []string
+	for _, label := range n.Labels {
+		if name := strings.TrimSpace(label.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func usec(v int64) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(v).UTC()
+}
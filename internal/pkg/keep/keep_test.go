@@ -0,0 +1,84 @@
+package keep
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	data := []byte(`{
+		"color": "DEFAULT",
+		"isTrashed": false,
+		"isPinned": true,
+		"isArchived": false,
+		"title": "Packing",
+		"listContent": [
+			{"text": "passport", "isChecked": true},
+			{"text": "charger", "isChecked": false}
+		],
+		"labels": [{"name": "travel"}, {"name": "  "}, {"name": " summer "}],
+		"userEditedTimestampUsec": 1760000000123456,
+		"createdTimestampUsec": 1750000000000000
+	}`)
+
+	note, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if note.Title != "Packing" || !note.IsPinned || note.IsArchived || note.IsTrashed {
+		t.Errorf("note = %+v, want the pinned note Packing", note)
+	}
+	wantItems := []ListItem{{Text: "passport", IsChecked: true}, {Text: "charger"}}
+	if !reflect.DeepEqual(note.ListContent, wantItems) {
+		t.Errorf("ListContent = %+v, want %+v", note.ListContent, wantItems)
+	}
+	if got, want := note.LabelNames(), []string{"travel", "summer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LabelNames() = %v, want %v", got, want)
+	}
+	if got, want := note.Updated(), time.UnixMicro(1760000000123456).UTC(); !got.Equal(want) || got.Location() != time.UTC {
+		t.Errorf("Updated() = %v, want %v", got, want)
+	}
+	if got, want := note.Created(), time.Unix(1750000000, 0).UTC(); !got.Equal(want) {
+		t.Errorf("Created() = %v, want %v", got, want)
+	}
+}
+
+func TestParseWithoutCreatedTime(t *testing.T) {
+	note, err := Parse([]byte(`{"textContent": "hi", "userEditedTimestampUsec": 1760000000000000}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !note.Created().IsZero() {
+		t.Errorf("Created() = %v, want zero", note.Created())
+	}
+	if note.LabelNames() != nil {
+		t.Errorf("LabelNames() = %v, want none", note.LabelNames())
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ``},
+		{"not json", `<html></html>`},
+		{"truncated", `{"title": "a", "userEditedTimestampUsec": 17600`},
+		{"array", `[{"title": "a"}]`},
+		{"null", `null`},
+		// other JSON files in the archive, like Labels.json, have no timestamps
+		{"not a note", `{"labels": [{"name": "travel"}]}`},
+		{"wrong type", `{"title": 5, "userEditedTimestampUsec": 1760000000000000}`},
+		{"timestamp as string", `{"title": "a", "userEditedTimestampUsec": "1760000000000000"}`},
+		{"list item of the wrong shape", `{"listContent": ["a"], "userEditedTimestampUsec": 1760000000000000}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); !errors.Is(err, ErrInvalid) {
+				t.Errorf("Parse(%s) error = %v, want ErrInvalid", tt.data, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Package markdown renders note content to sanitized HTML.
+//
+// Markdown is CommonMark with the GitHub extensions (tables, strikethrough,
+// autolinks and task lists). Whatever the renderer produces goes through an
+// allow-list sanitizer, so raw HTML or javascript: links in a note can't run
+// in a client.
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Heading is one entry of a table of contents, ID is the anchor of the heading in the HTML.
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
+}
+
+var (
+	renderer = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	)
+	policy = newPolicy()
+)
+
+// user generated content policy plus what the renderer legitimately emits
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// anchors for the table of contents
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\p{L}\p{M}\p{N}_-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	// fenced code blocks name their language for client side highlighting
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	// task list items
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	return p
+}
+
+// Render turns markdown into sanitized HTML and collects its headings in document order.
+func Render(source string) (string, []Heading, error) {
+	src := []byte(source)
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{seen: map[string]bool{}}))
+	doc := renderer.Parser().Parse(text.NewReader(src), parser.WithContext(ctx))
+
+	headings := []Heading{}
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		entry := Heading{Level: heading.Level, Text: strings.TrimSpace(plainText(heading, src))}
+		if id, ok := heading.AttributeString("id"); ok {
+			if b, ok := id.([]byte); ok {
+				entry.ID = string(b)
+			}
+		}
+		headings = append(headings, entry)
+		return ast.WalkSkipChildren, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := renderer.Renderer().Render(&buf, src, doc); err != nil {
+		return "", nil, err
+	}
+	return policy.Sanitize(buf.String()), headings, nil
+}
+
+// RenderPlain shows plain text as HTML, blank lines separate paragraphs and single line breaks are kept.
+func RenderPlain(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+
+	var b strings.Builder
+	for _, paragraph := range strings.Split(source, "\n\n") {
+		paragraph = strings.Trim(paragraph, "\n")
+		if strings.TrimSpace(paragraph) == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>\n"))
+		b.WriteString("</p>\n")
+	}
+	return b.String()
+}
+
+// anchor ids that keep letters of any script, the default generator drops everything outside ASCII
+type headingIDs struct {
+	seen map[string]bool
+}
+
+// "Über uns" becomes "über-uns", a repeated heading gets "-1", "-2" appended
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(string(value)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r) || r == '_':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		default:
+			dash = true
+		}
+	}
+	base := b.String()
+	if base == "" {
+		base = "heading"
+	}
+
+	id := base
+	for i := 1; ids.seen[id]; i++ {
+		id = base + "-" + strconv.Itoa(i)
+	}
+	ids.seen[id] = true
+	return []byte(id)
+}
+
+// ids given explicitly in the document
+func (ids *headingIDs) Put(value []byte) {
+	ids.seen[string(value)] = true
+}
+
+// text of a heading without markup, e.g. "Use `go test`" gives "Use go test"
+func plainText(n ast.Node, src []byte) string {
+	var b strings.Builder
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch t := c.(type) {
+		case *ast.Text:
+			b.Write(t.Segment.Value(src))
+			if t.SoftLineBreak() || t.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(t.Value)
+		default:
+			b.WriteString(plainText(c, src))
+		}
+	}
+	return b.String()
+}
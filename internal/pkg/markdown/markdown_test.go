@@ -0,0 +1,117 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// nothing in a note may end up as script in the client
+func TestRenderSanitizes(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		// none of these may appear in the lower cased output
+		forbidden []string
+	}{
+		{"script tag", "<script>alert(1)</script>", []string{"<script"}},
+		{"inline script in a paragraph", "hi <script>alert(1)</script> there", []string{"<script"}},
+		{"event handler", `<img src="x.png" onerror="alert(1)">`, []string{"onerror"}},
+		{"event handler in a block", "<div onclick=\"alert(1)\">\nclick\n</div>", []string{"onclick"}},
+		{"javascript link", "[click](javascript:alert(1))", []string{"javascript:"}},
+		{"javascript link with entities", "[click](&#106;avascript:alert(1))", []string{"javascript:", "&#106;avascript"}},
+		{"javascript link with mixed case", "[click](JaVaScRiPt:alert(1))", []string{"javascript:"}},
+		{"vbscript link", "[click](vbscript:msgbox(1))", []string{"vbscript:"}},
+		{"data link", "[click](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)", []string{"data:text/html"}},
+		{"javascript image", "![x](javascript:alert(1))", []string{"javascript:"}},
+		{"javascript autolink", "<javascript:alert(1)>", []string{`href="javascript:`}},
+		{"iframe", `<iframe src="https://evil.example"></iframe>`, []string{"<iframe"}},
+		{"style attribute", `<p style="background:url(javascript:alert(1))">x</p>`, []string{"style=", "javascript:"}},
+		{"svg", `<svg onload="alert(1)"><circle/></svg>`, []string{"<svg", "onload"}},
+		{"form", `<form action="https://evil.example"><input type="submit"></form>`, []string{"<form", `type="submit"`}},
+		{"heading id can't break out", "# a\" onmouseover=\"alert(1)", []string{`onmouseover="`}},
+		{"code block class can't break out", "```go\" onmouseover=\"alert(1)\nx\n```", []string{`onmouseover="`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, _, err := Render(tt.source)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			lower := strings.ToLower(html)
+			for _, bad := range tt.forbidden {
+				if strings.Contains(lower, bad) {
+					t.Errorf("Render(%q) = %q, contains %q", tt.source, html, bad)
+				}
+			}
+		})
+	}
+}
+
+// what the sanitizer lets through must still come out
+func TestRenderKeepsMarkup(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{"link", "[docs](https://example.com/docs)", []string{`href="https://example.com/docs"`}},
+		{"heading anchor", "# Über uns", []string{`<h1 id="über-uns">`}},
+		{"code block language", "```go\nx\n```", []string{`<code class="language-go">`}},
+		{"task list", "- [x] done\n- [ ] open", []string{`type="checkbox"`, "checked", "disabled"}},
+		{"table", "| a | b |\n|---|---|\n| 1 | 2 |", []string{"<table>", "<td>1</td>"}},
+		{"strikethrough", "~~gone~~", []string{"<del>gone</del>"}},
+		{"escaped text", "a < b & c", []string{"a &lt; b &amp; c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, _, err := Render(tt.source)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(html, want) {
+					t.Errorf("Render(%q) = %q, want it to contain %q", tt.source, html, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderHeadings(t *testing.T) {
+	source := "# Intro\n\nText\n\n## Use `go test`\n\n## Intro\n\n### !!!\n"
+	_, headings, err := Render(source)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	want := []Heading{
+		{Level: 1, Text: "Intro", ID: "intro"},
+		{Level: 2, Text: "Use go test", ID: "use-go-test"},
+		{Level: 2, Text: "Intro", ID: "intro-1"},
+		{Level: 3, Text: "!!!", ID: "heading"},
+	}
+	if !reflect.DeepEqual(headings, want) {
+		t.Errorf("headings = %+v, want %+v", headings, want)
+	}
+}
+
+func TestRenderPlain(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"empty", "", ""},
+		{"paragraphs and line breaks", "one\ntwo\n\nthree", "<p>one<br>\ntwo</p>\n<p>three</p>\n"},
+		{"windows line endings", "a\r\n\r\nb", "<p>a</p>\n<p>b</p>\n"},
+		{"blank paragraphs are dropped", "a\n\n  \n\nb", "<p>a</p>\n<p>b</p>\n"},
+		{"markup is escaped", `<script>alert("x")</script>`, "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderPlain(tt.source); got != tt.want {
+				t.Errorf("RenderPlain(%q) = %q, want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
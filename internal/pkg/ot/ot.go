@@ -0,0 +1,294 @@
+// Package ot implements operational transformation for plain text.
+//
+// An Operation walks over the whole document with retain, insert and delete
+// components. Lengths count UTF-16 code units so operations line up with
+// JavaScript strings, and the JSON form is the one ot.js uses: a positive
+// number retains, a negative number deletes and a string inserts.
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// errors returned when an operation doesn't fit the document or the other operation
+var (
+	ErrBaseLength = errors.New("ot: operation base length doesn't match")
+	ErrMalformed  = errors.New("ot: malformed operation")
+)
+
+// a single step of an operation, exactly one field is set
+type component struct {
+	retain int
+	delete int
+	insert []uint16
+}
+
+// Operation turns a document of BaseLen units into one of TargetLen units.
+type Operation struct {
+	ops       []component
+	BaseLen   int
+	TargetLen int
+}
+
+// Retain skips over n units.
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLen += n
+	o.TargetLen += n
+	if last := o.last(); last != nil && last.retain > 0 {
+		last.retain += n
+		return o
+	}
+	o.ops = append(o.ops, component{retain: n})
+	return o
+}
+
+// Insert adds text at the current position.
+func (o *Operation) Insert(text string) *Operation {
+	return o.insertUnits(utf16.Encode([]rune(text)))
+}
+
+// Delete removes n units at the current position.
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.BaseLen += n
+	if last := o.last(); last != nil && last.delete > 0 {
+		last.delete += n
+		return o
+	}
+	o.ops = append(o.ops, component{delete: n})
+	return o
+}
+
+// inserts are kept before deletes at the same position so equal edits look the same
+func (o *Operation) insertUnits(units []uint16) *Operation {
+	if len(units) == 0 {
+		return o
+	}
+	o.TargetLen += len(units)
+
+	n := len(o.ops)
+	switch {
+	case n > 0 && o.ops[n-1].insert != nil:
+		o.ops[n-1].insert = append(o.ops[n-1].insert, units...)
+	case n > 0 && o.ops[n-1].delete > 0:
+		if n > 1 && o.ops[n-2].insert != nil {
+			o.ops[n-2].insert = append(o.ops[n-2].insert, units...)
+		} else {
+			o.ops = append(o.ops, o.ops[n-1])
+			o.ops[n-1] = component{insert: append([]uint16(nil), units...)}
+		}
+	default:
+		o.ops = append(o.ops, component{insert: append([]uint16(nil), units...)})
+	}
+	return o
+}
+
+func (o *Operation) last() *component {
+	if len(o.ops) == 0 {
+		return nil
+	}
+	return &o.ops[len(o.ops)-1]
+}
+
+// IsNoop reports whether applying the operation changes nothing.
+func (o *Operation) IsNoop() bool {
+	return len(o.ops) == 0 || (len(o.ops) == 1 && o.ops[0].retain > 0)
+}
+
+// Apply runs the operation on a document.
+func (o *Operation) Apply(doc string) (string, error) {
+	units := utf16.Encode([]rune(doc))
+	if len(units) != o.BaseLen {
+		return "", ErrBaseLength
+	}
+
+	out := make([]uint16, 0, o.TargetLen)
+	pos := 0
+	for _, c := range o.ops {
+		switch {
+		case c.retain > 0:
+			out = append(out, units[pos:pos+c.retain]...)
+			pos += c.retain
+		case c.insert != nil:
+			out = append(out, c.insert...)
+		default:
+			pos += c.delete
+		}
+	}
+	return string(utf16.Decode(out)), nil
+}
+
+// Transform takes two operations made concurrently on the same document and
+// returns a' and b' such that applying a then b' gives the same result as b then a'.
+// When both insert at the same position the text of a comes first.
+func Transform(a, b *Operation) (*Operation, *Operation, error) {
+	if a.BaseLen != b.BaseLen {
+		return nil, nil, ErrBaseLength
+	}
+
+	aPrime, bPrime := &Operation{}, &Operation{}
+	ops1, ops2 := a.ops, b.ops
+	var op1, op2 *component
+	next := func(ops *[]component) *component {
+		if len(*ops) == 0 {
+			return nil
+		}
+		c := (*ops)[0]
+		*ops = (*ops)[1:]
+		return &c
+	}
+	op1, op2 = next(&ops1), next(&ops2)
+
+	for op1 != nil || op2 != nil {
+		if op1 != nil && op1.insert != nil {
+			aPrime.insertUnits(op1.insert)
+			bPrime.Retain(len(op1.insert))
+			op1 = next(&ops1)
+			continue
+		}
+		if op2 != nil && op2.insert != nil {
+			aPrime.Retain(len(op2.insert))
+			bPrime.insertUnits(op2.insert)
+			op2 = next(&ops2)
+			continue
+		}
+		if op1 == nil || op2 == nil {
+			return nil, nil, ErrMalformed
+		}
+
+		n1, n2 := op1.retain+op1.delete, op2.retain+op2.delete
+		n := min(n1, n2)
+		switch {
+		case op1.retain > 0 && op2.retain > 0:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case op1.delete > 0 && op2.delete > 0:
+			// both removed the same text, nothing left to do
+		case op1.delete > 0:
+			aPrime.Delete(n)
+		default:
+			bPrime.Delete(n)
+		}
+
+		op1 = shorten(op1, n, &ops1, next)
+		op2 = shorten(op2, n, &ops2, next)
+	}
+	return aPrime, bPrime, nil
+}
+
+// consumes n units of a retain or delete, moving to the next component when it's used up
+func shorten(c *component, n int, ops *[]component, next func(*[]component) *component) *component {
+	if c.retain > 0 {
+		c.retain -= n
+		if c.retain == 0 {
+			return next(ops)
+		}
+		return c
+	}
+	c.delete -= n
+	if c.delete == 0 {
+		return next(ops)
+	}
+	return c
+}
+
+// TransformIndex moves a position in the base document, like a cursor,
+// to the same place in the target document.
+func (o *Operation) TransformIndex(index int) int {
+	pos, moved := 0, index
+	for _, c := range o.ops {
+		if pos > index {
+			break
+		}
+		switch {
+		case c.retain > 0:
+			pos += c.retain
+		case c.insert != nil:
+			moved += len(c.insert)
+		default:
+			moved -= min(c.delete, index-pos)
+			pos += c.delete
+		}
+	}
+	return moved
+}
+
+// Replace returns the operation that turns oldDoc into newDoc by replacing
+// everything between their common prefix and common suffix.
+func Replace(oldDoc, newDoc string) *Operation {
+	a, b := utf16.Encode([]rune(oldDoc)), utf16.Encode([]rune(newDoc))
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	// never split a surrogate pair, the inserted text must stay valid utf-16
+	if prefix > 0 && utf16.IsSurrogate(rune(a[prefix-1])) && a[prefix-1] < 0xdc00 {
+		prefix--
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	if suffix > 0 && utf16.IsSurrogate(rune(a[len(a)-suffix])) && a[len(a)-suffix] >= 0xdc00 {
+		suffix--
+	}
+
+	op := &Operation{}
+	op.Retain(prefix)
+	op.insertUnits(b[prefix : len(b)-suffix])
+	op.Delete(len(a) - prefix - suffix)
+	op.Retain(suffix)
+	return op
+}
+
+// MarshalJSON encodes the operation like ot.js does.
+func (o *Operation) MarshalJSON() ([]byte, error) {
+	out := make([]any, 0, len(o.ops))
+	for _, c := range o.ops {
+		switch {
+		case c.retain > 0:
+			out = append(out, c.retain)
+		case c.insert != nil:
+			out = append(out, string(utf16.Decode(c.insert)))
+		default:
+			out = append(out, -c.delete)
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes an ot.js operation.
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*o = Operation{}
+	for _, item := range raw {
+		var text string
+		if err := json.Unmarshal(item, &text); err == nil {
+			o.Insert(text)
+			continue
+		}
+		var n int
+		if err := json.Unmarshal(item, &n); err != nil || n == 0 {
+			return fmt.Errorf("%w: %s", ErrMalformed, item)
+		}
+		if n > 0 {
+			o.Retain(n)
+		} else {
+			o.Delete(-n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package ot
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func op() *Operation {
+	return &Operation{}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		op   *Operation
+		want string
+		err  error
+	}{
+		{"insert in the middle", "hello", op().Retain(2).Insert("XY").Retain(3), "heXYllo", nil},
+		{"delete at the end", "hello", op().Retain(3).Delete(2), "hel", nil},
+		{"replace everything", "abc", op().Insert("xyz").Delete(3), "xyz", nil},
+		// an emoji is two UTF-16 units like in JavaScript
+		{"retain over a surrogate pair", "a😀b", op().Retain(3).Insert("!").Retain(1), "a😀!b", nil},
+		{"delete a surrogate pair", "a😀b", op().Retain(1).Delete(2).Retain(1), "ab", nil},
+		{"base length counts units not bytes", "é😀", op().Retain(3), "é😀", nil},
+		{"too short", "hello", op().Retain(4), "", ErrBaseLength},
+		{"too long", "hi", op().Retain(3), "", ErrBaseLength},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op.Apply(tt.doc)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Apply() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// applying a then b' and b then a' must give the same document
+func TestTransformConverges(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		a, b *Operation
+		want string
+	}{
+		{"inserts at different places", "hello", op().Insert("A").Retain(5), op().Retain(5).Insert("B"), "AhelloB"},
+		{"inserts at the same place, a goes first", "hello", op().Retain(2).Insert("A").Retain(3), op().Retain(2).Insert("B").Retain(3), "heABllo"},
+		{"same delete on both sides", "hello", op().Retain(1).Delete(3).Retain(1), op().Retain(1).Delete(3).Retain(1), "ho"},
+		{"overlapping deletes", "abcdef", op().Retain(1).Delete(3).Retain(2), op().Retain(2).Delete(3).Retain(1), "af"},
+		{"insert inside a deleted range", "abcdef", op().Retain(3).Insert("X").Retain(3), op().Retain(1).Delete(4).Retain(1), "aXf"},
+		{"delete against insert", "abc", op().Delete(3), op().Retain(3).Insert("d"), "d"},
+		{"edits around a surrogate pair", "x😀y", op().Retain(3).Insert("!").Retain(1), op().Retain(1).Delete(2).Retain(1), "x!y"},
+		{"noop against edit", "abc", op().Retain(3), op().Retain(1).Insert("Z").Retain(2), "aZbc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aPrime, bPrime, err := Transform(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("Transform() error = %v", err)
+			}
+
+			afterA, err := tt.a.Apply(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ab, err := bPrime.Apply(afterA)
+			if err != nil {
+				t.Fatalf("b' doesn't fit the document after a: %v", err)
+			}
+			afterB, err := tt.b.Apply(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ba, err := aPrime.Apply(afterB)
+			if err != nil {
+				t.Fatalf("a' doesn't fit the document after b: %v", err)
+			}
+
+			if ab != ba {
+				t.Fatalf("a then b' = %q, b then a' = %q, want them equal", ab, ba)
+			}
+			if ab != tt.want {
+				t.Errorf("merged document = %q, want %q", ab, tt.want)
+			}
+		})
+	}
+}
+
+// the room transforms an edit against every later revision in turn, the result must match
+// applying the whole history first
+func TestTransformAgainstSeveralEdits(t *testing.T) {
+	doc := "one two three"
+	history := []*Operation{
+		op().Insert("zero ").Retain(13),
+		op().Retain(9).Delete(4).Retain(5),
+		op().Retain(14).Insert("!"),
+	}
+	late := op().Retain(8).Insert("2").Retain(5)
+
+	current := doc
+	for _, past := range history {
+		var err error
+		if current, err = past.Apply(current); err != nil {
+			t.Fatal(err)
+		}
+		if late, _, err = Transform(late, past); err != nil {
+			t.Fatalf("Transform() error = %v", err)
+		}
+	}
+	got, err := late.Apply(current)
+	if err != nil {
+		t.Fatalf("late edit doesn't fit the current document: %v", err)
+	}
+	if want := "zero one 2three!"; got != want {
+		t.Errorf("document = %q, want %q", got, want)
+	}
+}
+
+func TestTransformBaseLengthMismatch(t *testing.T) {
+	if _, _, err := Transform(op().Retain(3), op().Retain(4)); !errors.Is(err, ErrBaseLength) {
+		t.Errorf("Transform() error = %v, want ErrBaseLength", err)
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	tests := []struct {
+		name  string
+		op    *Operation
+		index int
+		want  int
+	}{
+		{"insert before", op().Insert("ab").Retain(5), 3, 5},
+		{"insert after", op().Retain(4).Insert("ab").Retain(1), 3, 3},
+		{"insert at the index pushes it", op().Retain(3).Insert("ab").Retain(2), 3, 5},
+		{"delete before", op().Delete(2).Retain(3), 4, 2},
+		{"delete around", op().Retain(1).Delete(3).Retain(1), 2, 1},
+		{"emoji counts twice", op().Insert("😀").Retain(5), 1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.op.TransformIndex(tt.index); got != tt.want {
+				t.Errorf("TransformIndex(%d) = %d, want %d", tt.index, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplace(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		json     string
+	}{
+		{"unchanged", "same", "same", `[4]`},
+		{"append", "ab", "abc", `[2,"c"]`},
+		{"change in the middle", "hello", "hallo", `[1,"a",-1,3]`},
+		{"clear", "abc", "", `[-3]`},
+		// both emoji share their high surrogate, the pair must be replaced as a whole
+		{"keeps surrogate pairs whole", "a😀", "a😁", `[1,"😁",-2]`},
+		{"keeps surrogate pairs whole at the end", "😀b", "😁b", `["😁",-2,1]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := Replace(tt.old, tt.new)
+			got, err := o.Apply(tt.old)
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if got != tt.new {
+				t.Errorf("Apply() = %q, want %q", got, tt.new)
+			}
+			data, err := json.Marshal(o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.json {
+				t.Errorf("Replace() = %s, want %s", data, tt.json)
+			}
+		})
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		err  bool
+	}{
+		{"ot.js form", `[3,"a😀",-2,1]`, false},
+		{"zero is not an operation", `[1,0,2]`, true},
+		{"objects are not operations", `[{"retain":1}]`, true},
+		{"not an array", `"abc"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var o Operation
+			err := json.Unmarshal([]byte(tt.json), &o)
+			if (err != nil) != tt.err {
+				t.Fatalf("Unmarshal() error = %v, want error %v", err, tt.err)
+			}
+			if tt.err {
+				return
+			}
+			data, err := json.Marshal(&o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.json {
+				t.Errorf("Marshal() = %s, want %s", data, tt.json)
+			}
+			// 3 + 2 + 1 units, the emoji counts twice
+			if o.BaseLen != 6 || o.TargetLen != 7 {
+				t.Errorf("lengths = %d -> %d, want 6 -> 7", o.BaseLen, o.TargetLen)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Package rrule parses and expands a subset of iCalendar recurrence rules (RFC 5545).
+//
+// Supported parts are FREQ (DAILY, WEEKLY, MONTHLY or YEARLY), INTERVAL,
+// BYDAY for weekly rules (plain weekdays, no ordinals) and UNTIL. The series
+// starts at the first reminder time and repeats at the same clock time, a
+// monthly or yearly series skips months that don't have its day, like the RFC
+// does.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// returned for rules outside the supported subset, wrapped with the reason
+var ErrInvalid = errors.New("rrule: invalid rule")
+
+// how often a series repeats
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// keeps series with a day that rarely exists, like February 30, from looping forever
+const maxSteps = 1000
+
+// largest accepted INTERVAL
+const maxInterval = 1000
+
+// a weekday with its iCalendar code
+type weekday struct {
+	code string
+	day  time.Weekday
+}
+
+// the order BYDAY is written in
+var weekdays = []weekday{
+	{"MO", time.Monday},
+	{"TU", time.Tuesday},
+	{"WE", time.Wednesday},
+	{"TH", time.Thursday},
+	{"FR", time.Friday},
+	{"SA", time.Saturday},
+	{"SU", time.Sunday},
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// only for weekly rules, empty repeats on the weekday of the start
+	ByDay []time.Weekday
+	// zero when the series never ends
+	Until time.Time
+}
+
+// Parse reads a rule like "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", an "RRULE:" prefix is allowed.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("%w: empty rule", ErrInvalid)
+	}
+
+	rule := &Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("%w: malformed part %q", ErrInvalid, part)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%w: %s given twice", ErrInvalid, key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			freq := Frequency(value)
+			if freq != Daily && freq != Weekly && freq != Monthly && freq != Yearly {
+				return nil, fmt.Errorf("%w: unsupported FREQ %s", ErrInvalid, value)
+			}
+			rule.Freq = freq
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxInterval {
+				return nil, fmt.Errorf("%w: INTERVAL must be between 1 and %d", ErrInvalid, maxInterval)
+			}
+			rule.Interval = n
+		case "BYDAY":
+			days, err := parseByDay(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.ByDay = days
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = until
+		default:
+			return nil, fmt.Errorf("%w: unsupported part %s", ErrInvalid, key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalid)
+	}
+	if len(rule.ByDay) > 0 && rule.Freq != Weekly {
+		return nil, fmt.Errorf("%w: BYDAY is only supported for weekly rules", ErrInvalid)
+	}
+	return rule, nil
+}
+
+// String formats the rule in its canonical form, without the "RRULE:" prefix.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, 0, len(r.ByDay))
+		for _, wd := range weekdays {
+			if slices.Contains(r.ByDay, wd.day) {
+				codes = append(codes, wd.code)
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence of the series beginning at start that lies after the given time.
+// It reports false once the series has ended.
+func (r *Rule) Next(start, after time.Time) (time.Time, bool) {
+	// the start itself is always the first occurrence
+	if after.Before(start) {
+		return r.within(start)
+	}
+
+	interval := max(r.Interval, 1)
+	switch r.Freq {
+	case Daily:
+		return r.nextByDays(start, after, interval)
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return r.nextByDays(start, after, 7*interval)
+		}
+		return r.nextWeekly(start, after, interval)
+	case Monthly:
+		return r.nextByMonths(start, after, interval)
+	case Yearly:
+		return r.nextByMonths(start, after, 12*interval)
+	}
+	return time.Time{}, false
+}
+
+// every step days after start, AddDate keeps the clock time across DST changes
+func (r *Rule) nextByDays(start, after time.Time, step int) (time.Time, bool) {
+	// estimate from elapsed hours, then walk the last few steps
+	k := max(int(after.Sub(start).Hours()/24)/step-1, 0)
+	for range maxSteps {
+		candidate := start.AddDate(0, 0, k*step)
+		if candidate.After(after) {
+			return r.within(candidate)
+		}
+		k++
+	}
+	return time.Time{}, false
+}
+
+// the listed weekdays of every interval-th week, weeks start on Monday
+func (r *Rule) nextWeekly(start, after time.Time, interval int) (time.Time, bool) {
+	monday := start.AddDate(0, 0, -mondayOffset(start.Weekday()))
+	k := max(int(after.Sub(monday).Hours()/24)/(7*interval)-1, 0)
+	for range maxSteps {
+		week := monday.AddDate(0, 0, 7*k*interval)
+		for _, wd := range weekdays {
+			if !slices.Contains(r.ByDay, wd.day) {
+				continue
+			}
+			candidate := week.AddDate(0, 0, mondayOffset(wd.day))
+			if candidate.Before(start) || !candidate.After(after) {
+				continue
+			}
+			return r.within(candidate)
+		}
+		k++
+	}
+	return time.Time{}, false
+}
+
+// same day of month every step months, months without that day are skipped
+func (r *Rule) nextByMonths(start, after time.Time, step int) (time.Time, bool) {
+	elapsed := (after.Year()-start.Year())*12 + int(after.Month()-start.Month())
+	k := max(elapsed/step-1, 0)
+	for range maxSteps {
+		candidate := time.Date(start.Year(), start.Month()+time.Month(k*step), start.Day(),
+			start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+		// time.Date normalizes the 31st of a short month into the next one
+		if candidate.Day() == start.Day() && candidate.After(after) {
+			return r.within(candidate)
+		}
+		k++
+	}
+	return time.Time{}, false
+}
+
+// drops occurrences past UNTIL
+func (r *Rule) within(t time.Time) (time.Time, bool) {
+	if !r.Until.IsZero() && t.After(r.Until) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// days from Monday to the weekday
+func mondayOffset(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// comma separated weekday codes
+func parseByDay(value string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, code := range strings.Split(value, ",") {
+		i := slices.IndexFunc(weekdays, func(wd weekday) bool { return wd.code == code })
+		if i < 0 {
+			return nil, fmt.Errorf("%w: unsupported BYDAY value %s", ErrInvalid, code)
+		}
+		if !slices.Contains(days, weekdays[i].day) {
+			days = append(days, weekdays[i].day)
+		}
+	}
+	return days, nil
+}
+
+// UTC date-time, or a date that counts until the end of that day
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102", value); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: UNTIL must look like 20261231 or 20261231T235959Z", ErrInvalid)
+}
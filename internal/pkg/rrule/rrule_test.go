@@ -0,0 +1,198 @@
+package rrule
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY", false},
+		{"rrule:freq=weekly;byday=we,mo;interval=2", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE", false},
+		{"FREQ=MONTHLY;INTERVAL=1", "FREQ=MONTHLY", false},
+		{"FREQ=YEARLY;UNTIL=20301231", "FREQ=YEARLY;UNTIL=20301231T235959Z", false},
+		{"FREQ=DAILY;UNTIL=20300101T080000Z", "FREQ=DAILY;UNTIL=20300101T080000Z", false},
+		{"FREQ=WEEKLY;BYDAY=MO,MO", "FREQ=WEEKLY;BYDAY=MO", false},
+		{"", "", true},
+		{"INTERVAL=2", "", true},
+		{"FREQ=HOURLY", "", true},
+		{"FREQ=DAILY;FREQ=WEEKLY", "", true},
+		{"FREQ=DAILY;INTERVAL=0", "", true},
+		{"FREQ=DAILY;INTERVAL=1001", "", true},
+		{"FREQ=MONTHLY;BYDAY=MO", "", true},
+		{"FREQ=WEEKLY;BYDAY=1MO", "", true},
+		{"FREQ=DAILY;UNTIL=tomorrow", "", true},
+		// COUNT is outside the supported subset, the series has to end with UNTIL
+		{"FREQ=DAILY;COUNT=5", "", true},
+		{"FREQ=DAILY;", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			rule, err := Parse(tt.in)
+			if tt.err {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("Parse() error = %v, want ErrInvalid", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 30, 0, 0, time.UTC)
+}
+
+// the first n occurrences of the series, fewer when it ends
+func occurrences(rule *Rule, start time.Time, n int) []time.Time {
+	var out []time.Time
+	after := start.Add(-time.Second)
+	for len(out) < n {
+		next, ok := rule.Next(start, after)
+		if !ok {
+			break
+		}
+		out = append(out, next)
+		after = next
+	}
+	return out
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		n     int
+		want  []time.Time
+	}{
+		{
+			"daily every third day",
+			"FREQ=DAILY;INTERVAL=3", date(2026, 2, 27), 3,
+			[]time.Time{date(2026, 2, 27), date(2026, 3, 2), date(2026, 3, 5)},
+		},
+		{
+			"weekly on the weekday of the start",
+			"FREQ=WEEKLY", date(2026, 10, 14), 3,
+			[]time.Time{date(2026, 10, 14), date(2026, 10, 21), date(2026, 10, 28)},
+		},
+		{
+			// 2026-10-14 is a Wednesday, Monday of that week is already past
+			"byday every other week",
+			"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE,FR", date(2026, 10, 14), 5,
+			[]time.Time{date(2026, 10, 14), date(2026, 10, 16), date(2026, 10, 26), date(2026, 10, 28), date(2026, 10, 30)},
+		},
+		{
+			"byday that doesn't include the start",
+			"FREQ=WEEKLY;BYDAY=SU", date(2026, 10, 14), 2,
+			[]time.Time{date(2026, 10, 14), date(2026, 10, 18)},
+		},
+		{
+			"the 31st skips short months",
+			"FREQ=MONTHLY", date(2026, 1, 31), 4,
+			[]time.Time{date(2026, 1, 31), date(2026, 3, 31), date(2026, 5, 31), date(2026, 7, 31)},
+		},
+		{
+			"the 30th skips February",
+			"FREQ=MONTHLY;INTERVAL=1", date(2026, 1, 30), 3,
+			[]time.Time{date(2026, 1, 30), date(2026, 3, 30), date(2026, 4, 30)},
+		},
+		{
+			"every other month across the year end",
+			"FREQ=MONTHLY;INTERVAL=2", date(2026, 11, 15), 3,
+			[]time.Time{date(2026, 11, 15), date(2027, 1, 15), date(2027, 3, 15)},
+		},
+		{
+			"February 29 only in leap years",
+			"FREQ=YEARLY", date(2024, 2, 29), 3,
+			[]time.Time{date(2024, 2, 29), date(2028, 2, 29), date(2032, 2, 29)},
+		},
+		{
+			"February 29 every other year",
+			"FREQ=YEARLY;INTERVAL=2", date(2024, 2, 29), 2,
+			[]time.Time{date(2024, 2, 29), date(2028, 2, 29)},
+		},
+		{
+			"until a date includes that day",
+			"FREQ=DAILY;UNTIL=20261003", date(2026, 10, 1), 10,
+			[]time.Time{date(2026, 10, 1), date(2026, 10, 2), date(2026, 10, 3)},
+		},
+		{
+			"until a time excludes later occurrences that day",
+			"FREQ=DAILY;UNTIL=20261003T090000Z", date(2026, 10, 1), 10,
+			[]time.Time{date(2026, 10, 1), date(2026, 10, 2)},
+		},
+		{
+			"until before the start",
+			"FREQ=WEEKLY;UNTIL=20260101", date(2026, 10, 1), 10,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := occurrences(rule, tt.start, tt.n); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("occurrences = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// a reminder far in the past must find its next occurrence without walking the whole series
+func TestNextLongAfterStart(t *testing.T) {
+	tests := []struct {
+		rule  string
+		start time.Time
+		after time.Time
+		want  time.Time
+	}{
+		{"FREQ=DAILY", date(2000, 1, 1), date(2026, 10, 17), date(2026, 10, 18)},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=TU", date(2000, 1, 4), date(2026, 10, 17), date(2026, 10, 20)},
+		{"FREQ=MONTHLY", date(1990, 1, 31), date(2026, 10, 17), date(2026, 10, 31)},
+		{"FREQ=YEARLY", date(1904, 2, 29), date(2026, 10, 17), date(2028, 2, 29)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			rule, err := Parse(tt.rule)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, ok := rule.Next(tt.start, tt.after)
+			if !ok || !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, %v, want %v, true", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+// the clock time stays the same when daylight saving time starts or ends
+func TestNextKeepsClockTimeAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	rule, err := Parse("FREQ=DAILY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 3, 28, 8, 0, 0, 0, berlin)
+	got, ok := rule.Next(start, start)
+	if want := time.Date(2026, 3, 29, 8, 0, 0, 0, berlin); !ok || !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+}
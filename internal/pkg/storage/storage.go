@@ -0,0 +1,22 @@
+// Package storage keeps uploaded files outside of the database.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// returned by Get and Delete when no object is stored under the key
+var ErrNotFound = errors.New("storage: object not found")
+
+// Storage stores opaque blobs under keys chosen by the caller.
+// Keys are slash separated paths like "notes/12/3f9a...", never user input.
+type Storage interface {
+	// Put writes size bytes from r under key, replacing an existing object.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object for reading, the caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object, deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -1,17 +1,52 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// lifetimes of the tokens handed out on login and refresh
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// AccessClaims holds the values we read back from a verified access token
+type AccessClaims struct {
+	UserID    uint
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// RefreshClaims holds the values we read back from a verified refresh token
+type RefreshClaims struct {
+	UserID    uint
+	TokenID   string
+	ExpiresAt time.Time
+}
+
 func GenerateAccessToken(userId uint) (string, error) {
+	// every access token gets its own id so it can be revoked on logout
+	tokenID, err := NewTokenID()
+	if err != nil {
+		return "", err
+	}
+
 	// define claims payload with store user id and expire within 15mins
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": userId,
-		"exp":     time.Now().Add(15 * time.Minute).Unix(),
+		"jti":     tokenID,
+		// microseconds, so a logout-all cutoff can tell this token from one issued earlier in the same second
+		"iat": issuedAtValue(now),
+		"exp": now.Add(AccessTokenTTL).Unix(),
 	}
 	// Create a new token with HMAC SHA256 signing method
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -19,14 +54,108 @@ func GenerateAccessToken(userId uint) (string, error) {
 	return token.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
 }
 
-func GenerateRefreshToken(userId uint) (string, error) {
-	// define claims payload with store user id and expire within 15mins
+func GenerateRefreshToken(userId uint, tokenID string) (string, error) {
+	// define claims payload with store user id, token id and expire within 7 days
 	claims := jwt.MapClaims{
 		"user_id": userId,
-		"exp":     time.Now().Add(7 * 24 * time.Hour).Unix(),
+		"jti":     tokenID,
+		"exp":     time.Now().Add(RefreshTokenTTL).Unix(),
 	}
 	// Create a new token with HMAC SHA256 signing method
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	// sign the token with the secret key from env
 	return token.SignedString([]byte(os.Getenv("REFRESH_SECRET")))
 }
+
+// verifies an access token against ACCESS_SECRET and extracts its claims
+func ParseAccessToken(tokenStr string) (*AccessClaims, error) {
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("ACCESS_SECRET")), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("invalid user ID in token")
+	}
+	tokenID, ok := claims["jti"].(string)
+	if !ok || tokenID == "" {
+		return nil, errors.New("missing token ID in token")
+	}
+	// read by hand, the jwt library cuts NumericDates to whole seconds
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, errors.New("missing issue time in token")
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, errors.New("missing expiry in token")
+	}
+
+	return &AccessClaims{
+		UserID:    uint(userID),
+		TokenID:   tokenID,
+		IssuedAt:  parseIssuedAt(iat),
+		ExpiresAt: exp.Time,
+	}, nil
+}
+
+// NumericDate with a fraction of microseconds, a float64 holds that exactly for centuries to come
+func issuedAtValue(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
+
+// inverse of issuedAtValue, tokens with whole seconds parse as before
+func parseIssuedAt(value float64) time.Time {
+	return time.UnixMicro(int64(math.Round(value * 1e6)))
+}
+
+// verifies a refresh token against REFRESH_SECRET and extracts its claims
+func ParseRefreshToken(tokenStr string) (*RefreshClaims, error) {
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("REFRESH_SECRET")), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid refresh token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid refresh token claims")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("invalid user ID in refresh token")
+	}
+	tokenID, ok := claims["jti"].(string)
+	if !ok || tokenID == "" {
+		return nil, errors.New("missing token ID in refresh token")
+	}
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, errors.New("missing expiry in refresh token")
+	}
+
+	return &RefreshClaims{
+		UserID:    uint(userID),
+		TokenID:   tokenID,
+		ExpiresAt: exp.Time,
+	}, nil
+}
+
+// returns a random hex id used as jti and as refresh token family id
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAccessTokenIssuedAt(t *testing.T) {
+	t.Setenv("ACCESS_SECRET", "test-secret")
+
+	before := time.Now().Truncate(time.Microsecond)
+	token, err := GenerateAccessToken(7)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	after := time.Now()
+
+	claims, err := ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	if claims.UserID != 7 || claims.TokenID == "" {
+		t.Errorf("claims = %+v, want user 7 with a token id", claims)
+	}
+	// a logout-all cutoff earlier in the same second must be able to tell the token apart
+	if claims.IssuedAt.Before(before) || claims.IssuedAt.After(after) {
+		t.Errorf("IssuedAt = %v, want between %v and %v", claims.IssuedAt, before, after)
+	}
+}
+
+func TestParseIssuedAt(t *testing.T) {
+	tests := []struct {
+		name string
+		in   time.Time
+	}{
+		{"whole second", time.Unix(1760000000, 0)},
+		{"microseconds", time.Unix(1760000000, 123456000)},
+		{"last microsecond of a second", time.Unix(1760000000, 999999000)},
+		{"far future", time.Date(2200, 1, 1, 0, 0, 0, 1000, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseIssuedAt(issuedAtValue(tt.in)); !got.Equal(tt.in) {
+				t.Errorf("round trip of %v = %v", tt.in, got)
+			}
+		})
+	}
+}
+
+// tokens issued before iat carried microseconds still parse
+func TestParseAccessTokenWholeSecondIssuedAt(t *testing.T) {
+	t.Setenv("ACCESS_SECRET", "test-secret")
+
+	issued := time.Now().Truncate(time.Second)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 7,
+		"jti":     "abc",
+		"iat":     issued.Unix(),
+		"exp":     issued.Add(AccessTokenTTL).Unix(),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("ParseAccessToken() error = %v", err)
+	}
+	if !claims.IssuedAt.Equal(issued) {
+		t.Errorf("IssuedAt = %v, want %v", claims.IssuedAt, issued)
+	}
+}
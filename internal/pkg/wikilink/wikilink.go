@@ -0,0 +1,71 @@
+// Package wikilink finds [[...]] references between notes.
+//
+// [[Some Title]] points to a note by its title, matched ignoring case, and
+// [[id:123]] points to a note by id. Brackets can't be nested and a reference
+// can't span lines.
+package wikilink
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// longest title a reference can carry, same as a note title
+const maxTitleLength = 255
+
+var (
+	pattern   = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+	idPattern = regexp.MustCompile(`^id:(\d+)$`)
+)
+
+// Ref is one reference, exactly one of Title and ID is set.
+type Ref struct {
+	Title string
+	ID    uint
+}
+
+// Parse returns the distinct references in content in order of first appearance.
+// Titles are compared ignoring case, the first spelling is kept.
+func Parse(content string) []Ref {
+	var refs []Ref
+	seenTitles := map[string]bool{}
+	seenIDs := map[uint]bool{}
+
+	for _, m := range pattern.FindAllStringSubmatch(content, -1) {
+		inner := strings.TrimSpace(m[1])
+		if inner == "" || utf8.RuneCountInString(inner) > maxTitleLength {
+			continue
+		}
+
+		if idm := idPattern.FindStringSubmatch(inner); idm != nil {
+			id, err := strconv.ParseUint(idm[1], 10, 64)
+			if err != nil || id == 0 || seenIDs[uint(id)] {
+				continue
+			}
+			seenIDs[uint(id)] = true
+			refs = append(refs, Ref{ID: uint(id)})
+			continue
+		}
+
+		key := strings.ToLower(inner)
+		if seenTitles[key] {
+			continue
+		}
+		seenTitles[key] = true
+		refs = append(refs, Ref{Title: inner})
+	}
+	return refs
+}
+
+// ReplaceTitle rewrites every [[oldTitle]] in content, ignoring case and surrounding spaces, to [[newTitle]].
+func ReplaceTitle(content, oldTitle, newTitle string) string {
+	// spaces but no line breaks, like Parse
+	re, err := regexp.Compile(`(?i)\[\[[^\S\n]*` + regexp.QuoteMeta(strings.TrimSpace(oldTitle)) + `[^\S\n]*\]\]`)
+	if err != nil {
+		return content
+	}
+	// $ in the new title must not be read as a group reference
+	return re.ReplaceAllLiteralString(content, "[["+strings.TrimSpace(newTitle)+"]]")
+}
@@ -0,0 +1,66 @@
+package wikilink
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Ref
+	}{
+		{"none", "no links here [single] [[]]", nil},
+		{"title", "see [[Project Plan]] for details", []Ref{{Title: "Project Plan"}}},
+		{"id", "see [[id:42]]", []Ref{{ID: 42}}},
+		{"spaces are trimmed", "[[  Plan  ]]", []Ref{{Title: "Plan"}}},
+		{"order of first appearance", "[[b]] [[id:7]] [[a]]", []Ref{{Title: "b"}, {ID: 7}, {Title: "a"}}},
+		{"titles deduplicated ignoring case", "[[Plan]] [[plan]] [[ PLAN ]]", []Ref{{Title: "Plan"}}},
+		{"ids deduplicated", "[[id:3]] [[id:03]] [[id:3]]", []Ref{{ID: 3}}},
+		{"id zero is skipped", "[[id:0]]", nil},
+		{"id too large is skipped", "[[id:99999999999999999999999]]", nil},
+		{"not an id", "[[id:abc]] [[ID:5]] [[id: 5]]", []Ref{{Title: "id:abc"}, {Title: "ID:5"}, {Title: "id: 5"}}},
+		{"no line breaks inside", "[[first\nsecond]]", nil},
+		{"no nested brackets", "[[outer [[inner]] ]]", []Ref{{Title: "inner"}}},
+		{"blank", "[[   ]]", nil},
+		{"adjacent", "[[a]][[b]]", []Ref{{Title: "a"}, {Title: "b"}}},
+		{"unicode title", "[[Über uns]]", []Ref{{Title: "Über uns"}}},
+		{"longest title", "[[" + strings.Repeat("é", maxTitleLength) + "]]", []Ref{{Title: strings.Repeat("é", maxTitleLength)}}},
+		{"title too long", "[[" + strings.Repeat("é", maxTitleLength+1) + "]]", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceTitle(t *testing.T) {
+	tests := []struct {
+		name               string
+		content            string
+		oldTitle, newTitle string
+		want               string
+	}{
+		{"every reference", "[[Plan]] and [[Plan]]", "Plan", "Roadmap", "[[Roadmap]] and [[Roadmap]]"},
+		{"ignoring case and spaces", "[[ plan ]] [[PLAN]]", "Plan", "Roadmap", "[[Roadmap]] [[Roadmap]]"},
+		{"other titles stay", "[[Plan B]] [[Plan]] [[id:1]]", "Plan", "Roadmap", "[[Plan B]] [[Roadmap]] [[id:1]]"},
+		{"plain text stays", "Plan [Plan] [[Plan", "Plan", "Roadmap", "Plan [Plan] [[Plan"},
+		{"regexp characters in the old title", "[[a.b (1)]] [[axb (1)]]", "a.b (1)", "c", "[[c]] [[axb (1)]]"},
+		{"dollar in the new title", "[[Plan]]", "Plan", "Cost $1", "[[Cost $1]]"},
+		{"titles are trimmed", "[[Plan]]", " Plan ", " Roadmap ", "[[Roadmap]]"},
+		// Parse doesn't see these as references, so they aren't rewritten either
+		{"line breaks inside", "[[\nPlan]] [[Plan\n]]", "Plan", "Roadmap", "[[\nPlan]] [[Plan\n]]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReplaceTitle(tt.content, tt.oldTitle, tt.newTitle); got != tt.want {
+				t.Errorf("ReplaceTitle(%q, %q, %q) = %q, want %q", tt.content, tt.oldTitle, tt.newTitle, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// db operations for personal access tokens
+type AccessTokenRepository interface {
+	Create(token *model.AccessToken) error
+	// gorm.ErrRecordNotFound when no token has this hash
+	FindByTokenHash(hash string) (*model.AccessToken, error)
+	// tokens of a user, newest first
+	FindByUser(userID uint) ([]model.AccessToken, error)
+	CountByUser(userID uint) (int64, error)
+	// deletes the user's token, reports false when the user has no token with this id
+	Delete(userID, id uint) (bool, error)
+	// records a use unless one was recorded after the given time already
+	TouchLastUsed(id uint, at, notBefore time.Time) error
+}
+
+type accessTokenRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new accessTokenRepository struct instance as interface
+func NewAccessTokenRepository(db *gorm.DB) AccessTokenRepository {
+	return &accessTokenRepository{db}
+}
+
+// create token row
+func (r *accessTokenRepository) Create(token *model.AccessToken) error {
+	return r.db.Create(token).Error
+}
+
+// find token by its hash
+func (r *accessTokenRepository) FindByTokenHash(hash string) (*model.AccessToken, error) {
+	var token model.AccessToken
+	err := r.db.Where("token_hash = ?", hash).First(&token).Error
+	return &token, err
+}
+
+// newest first
+func (r *accessTokenRepository) FindByUser(userID uint) ([]model.AccessToken, error) {
+	var tokens []model.AccessToken
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// tokens of a user, expired ones included
+func (r *accessTokenRepository) CountByUser(userID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.AccessToken{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// scoped to the user so nobody can revoke someone else's token
+func (r *accessTokenRepository) Delete(userID, id uint) (bool, error) {
+	res := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.AccessToken{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// conditional so a busy script doesn't write the row on every request
+func (r *accessTokenRepository) TouchLastUsed(id uint, at, notBefore time.Time) error {
+	return r.db.Model(&model.AccessToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, notBefore).
+		Update("last_used_at", at).Error
+}
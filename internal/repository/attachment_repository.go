@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// returned by CreateWithinQuota when the attachment doesn't fit anymore
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+// db operations for note attachments
+type AttachmentRepository interface {
+	// creates the row only if the owner's attachments stay within quota bytes
+	CreateWithinQuota(attachment *model.Attachment, quota int64) error
+	FindByID(id uint) (*model.Attachment, error)
+	// attachments of a note, oldest first
+	FindByNote(noteID uint) ([]model.Attachment, error)
+	// bytes stored for the notes of a user
+	TotalSizeByUser(userID uint) (int64, error)
+	// attachments whose note was deleted permanently
+	FindOrphans(limit int) ([]model.Attachment, error)
+	Delete(id uint) error
+}
+
+type attachmentRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new attachmentRepository struct instance as interface
+func NewAttachmentRepository(db *gorm.DB) AttachmentRepository {
+	return &attachmentRepository{db}
+}
+
+// the file must already be stored, the owner's user row is locked, so parallel uploads are checked one after the other
+func (r *attachmentRepository) CreateWithinQuota(attachment *model.Attachment, quota int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var owner model.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&owner, attachment.UserID).Error
+		if err != nil {
+			return err
+		}
+
+		var used int64
+		err = tx.Model(&model.Attachment{}).Where("user_id = ?", attachment.UserID).Select("COALESCE(SUM(size), 0)").Scan(&used).Error
+		if err != nil {
+			return err
+		}
+		if used+attachment.Size > quota {
+			return ErrQuotaExceeded
+		}
+		return tx.Create(attachment).Error
+	})
+}
+
+// find attachment by primary key
+func (r *attachmentRepository) FindByID(id uint) (*model.Attachment, error) {
+	var attachment model.Attachment
+	err := r.db.First(&attachment, id).Error
+	return &attachment, err
+}
+
+// attachments in upload order
+func (r *attachmentRepository) FindByNote(noteID uint) ([]model.Attachment, error) {
+	var attachments []model.Attachment
+	err := r.db.Where("note_id = ?", noteID).Order("created_at ASC, id ASC").Find(&attachments).Error
+	return attachments, err
+}
+
+// quota usage, notes in the trash still count
+func (r *attachmentRepository) TotalSizeByUser(userID uint) (int64, error) {
+	var total int64
+	err := r.db.Model(&model.Attachment{}).Where("user_id = ?", userID).Select("COALESCE(SUM(size), 0)").Scan(&total).Error
+	return total, err
+}
+
+// notes are removed with a plain delete, their attachments are found afterwards
+func (r *attachmentRepository) FindOrphans(limit int) ([]model.Attachment, error) {
+	var attachments []model.Attachment
+	err := r.db.Where("NOT EXISTS (SELECT 1 FROM notes WHERE notes.id = attachments.note_id)").
+		Order("id ASC").
+		Limit(limit).
+		Find(&attachments).Error
+	return attachments, err
+}
+
+// delete attachment row
+func (r *attachmentRepository) Delete(id uint) error {
+	return r.db.Delete(&model.Attachment{}, id).Error
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// db operations for calendar feed tokens
+type CalendarTokenRepository interface {
+	// stores the user's token, replacing the one they had
+	Replace(userID uint, tokenHash string) (*model.CalendarToken, error)
+	// gorm.ErrRecordNotFound when no token has this hash
+	FindByTokenHash(hash string) (*model.CalendarToken, error)
+	DeleteByUser(userID uint) error
+}
+
+type calendarTokenRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new calendarTokenRepository struct instance as interface
+func NewCalendarTokenRepository(db *gorm.DB) CalendarTokenRepository {
+	return &calendarTokenRepository{db}
+}
+
+// upsert on user_id, so the old url stops working in the same statement
+func (r *calendarTokenRepository) Replace(userID uint, tokenHash string) (*model.CalendarToken, error) {
+	token := model.CalendarToken{UserID: userID, TokenHash: tokenHash}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"token_hash", "created_at"}),
+	}).Create(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// find token by its hash
+func (r *calendarTokenRepository) FindByTokenHash(hash string) (*model.CalendarToken, error) {
+	var token model.CalendarToken
+	err := r.db.Where("token_hash = ?", hash).First(&token).Error
+	return &token, err
+}
+
+// turns the feed off
+func (r *calendarTokenRepository) DeleteByUser(userID uint) error {
+	return r.db.Where("user_id = ?", userID).Delete(&model.CalendarToken{}).Error
+}
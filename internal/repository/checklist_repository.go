@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// db operations for checklist items
+// every write locks the note, keeps positions gapless and refreshes the note's progress counts
+type ChecklistRepository interface {
+	// items of a note in checklist order
+	FindByNote(noteID uint) ([]model.ChecklistItem, error)
+	FindByID(id uint) (*model.ChecklistItem, error)
+	// inserts at item.Position, shifting later items down, a position past the end appends
+	Create(item *model.ChecklistItem) error
+	// saves text and checked state
+	Update(item *model.ChecklistItem) error
+	Delete(item *model.ChecklistItem) error
+	// gives the items the positions of their ids in the slice, which must hold all items of the note
+	Reorder(noteID uint, itemIDs []uint) error
+}
+
+type checklistRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new checklistRepository struct instance as interface
+func NewChecklistRepository(db *gorm.DB) ChecklistRepository {
+	return &checklistRepository{db}
+}
+
+// ordered by position
+func (r *checklistRepository) FindByNote(noteID uint) ([]model.ChecklistItem, error) {
+	var items []model.ChecklistItem
+	err := r.db.Where("note_id = ?", noteID).Order("position ASC, id ASC").Find(&items).Error
+	return items, err
+}
+
+// find item by primary key
+func (r *checklistRepository) FindByID(id uint) (*model.ChecklistItem, error) {
+	var item model.ChecklistItem
+	err := r.db.First(&item, id).Error
+	return &item, err
+}
+
+// the position is clamped to the end of the list
+func (r *checklistRepository) Create(item *model.ChecklistItem) error {
+	return r.write(item.NoteID, func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&model.ChecklistItem{}).Where("note_id = ?", item.NoteID).Count(&count).Error; err != nil {
+			return err
+		}
+		if item.Position < 0 || item.Position > int(count) {
+			item.Position = int(count)
+		}
+
+		err := tx.Model(&model.ChecklistItem{}).
+			Where("note_id = ? AND position >= ?", item.NoteID, item.Position).
+			Update("position", gorm.Expr("position + 1")).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(item).Error
+	})
+}
+
+// position and note stay as they are
+func (r *checklistRepository) Update(item *model.ChecklistItem) error {
+	return r.write(item.NoteID, func(tx *gorm.DB) error {
+		return tx.Model(item).Select("Text", "Checked", "UpdatedAt").Updates(item).Error
+	})
+}
+
+// closes the gap the item leaves
+func (r *checklistRepository) Delete(item *model.ChecklistItem) error {
+	return r.write(item.NoteID, func(tx *gorm.DB) error {
+		if err := tx.Delete(item).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.ChecklistItem{}).
+			Where("note_id = ? AND position > ?", item.NoteID, item.Position).
+			Update("position", gorm.Expr("position - 1")).Error
+	})
+}
+
+// one update per item, checklists are short
+func (r *checklistRepository) Reorder(noteID uint, itemIDs []uint) error {
+	return r.write(noteID, func(tx *gorm.DB) error {
+		for position, id := range itemIDs {
+			err := tx.Model(&model.ChecklistItem{}).
+				Where("id = ? AND note_id = ?", id, noteID).
+				Update("position", position).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// runs fn in a transaction holding the note's row lock, then recounts the note's progress
+// the counts are derived data, so the note's version stays as it is
+func (r *checklistRepository) write(noteID uint, fn func(tx *gorm.DB) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT 1 FROM notes WHERE id = ? FOR UPDATE", noteID).Error; err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE notes SET
+				checklist_total = (SELECT COUNT(*) FROM checklist_items WHERE note_id = @id),
+				checklist_done = (SELECT COUNT(*) FROM checklist_items WHERE note_id = @id AND checked)
+			WHERE id = @id`, map[string]interface{}{"id": noteID}).Error
+	})
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// db operations for background import jobs
+type ImportJobRepository interface {
+	Create(job *model.ImportJob) error
+	// saves status, progress and failures of the job
+	Update(job *model.ImportJob) error
+	FindByID(id uint) (*model.ImportJob, error)
+	// moves a queued job to running, reports false when another worker took it first
+	Claim(job *model.ImportJob) (bool, error)
+	// latest jobs of a user first
+	FindByUser(userID uint, limit int) ([]model.ImportJob, error)
+	// jobs of all users in the given states, oldest first
+	FindByStatus(statuses ...string) ([]model.ImportJob, error)
+}
+
+type importJobRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new importJobRepository struct instance as interface
+func NewImportJobRepository(db *gorm.DB) ImportJobRepository {
+	return &importJobRepository{db}
+}
+
+// create job row, the file must already be stored
+func (r *importJobRepository) Create(job *model.ImportJob) error {
+	return r.db.Create(job).Error
+}
+
+// full row save, only the worker running the job writes to it
+func (r *importJobRepository) Update(job *model.ImportJob) error {
+	return r.db.Save(job).Error
+}
+
+// find job by primary key
+func (r *importJobRepository) FindByID(id uint) (*model.ImportJob, error) {
+	var job model.ImportJob
+	err := r.db.First(&job, id).Error
+	return &job, err
+}
+
+// conditional on the status so a job only ever runs once
+func (r *importJobRepository) Claim(job *model.ImportJob) (bool, error) {
+	now := time.Now()
+	res := r.db.Model(job).
+		Where("status = ?", model.ImportStatusQueued).
+		Updates(map[string]interface{}{"status": model.ImportStatusRunning, "started_at": now})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+	job.Status = model.ImportStatusRunning
+	job.StartedAt = &now
+	return true, nil
+}
+
+// newest first
+func (r *importJobRepository) FindByUser(userID uint, limit int) ([]model.ImportJob, error) {
+	var jobs []model.ImportJob
+	err := r.db.Where("user_id = ?", userID).Order("id DESC").Limit(limit).Find(&jobs).Error
+	return jobs, err
+}
+
+// used on start to pick up jobs a restart interrupted
+func (r *importJobRepository) FindByStatus(statuses ...string) ([]model.ImportJob, error) {
+	var jobs []model.ImportJob
+	err := r.db.Where("status IN ?", statuses).Order("id ASC").Find(&jobs).Error
+	return jobs, err
+}
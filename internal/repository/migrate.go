@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// statements AutoMigrate can't express, all of them must be safe to run on every start
+var (
+	tagMigrations = []string{
+		// tag names are unique per user ignoring case
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_name ON tags (user_id, LOWER(name))`,
+	}
+
+	searchMigrations = []string{
+		// weighted full-text vector over the searchable note fields, kept up to date by postgres
+		// tags live in their own table and are matched separately
+		`ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (
+				setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+				setweight(to_tsvector('english', coalesce(content, '')), 'C')
+			) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_notes_search_vector ON notes USING GIN (search_vector)`,
+	}
+
+	// change feed for offline sync: every write to a note takes the next value of one sequence
+	// writes of the same user are serialized by an advisory lock held until commit,
+	// so a client reading the feed can't skip a change that commits late
+	syncMigrations = []string{
+		`CREATE SEQUENCE IF NOT EXISTS note_change_seq`,
+		`CREATE OR REPLACE FUNCTION notes_next_change_seq() RETURNS trigger AS $$
+			BEGIN
+				PERFORM pg_advisory_xact_lock(hashtext('note_change_seq'), NEW.user_id::int);
+				NEW.change_seq := nextval('note_change_seq');
+				RETURN NEW;
+			END
+			$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS trg_notes_change_seq ON notes`,
+		`CREATE TRIGGER trg_notes_change_seq BEFORE INSERT OR UPDATE ON notes
+			FOR EACH ROW EXECUTE FUNCTION notes_next_change_seq()`,
+
+		`CREATE OR REPLACE FUNCTION notes_record_tombstone() RETURNS trigger AS $$
+			BEGIN
+				PERFORM pg_advisory_xact_lock(hashtext('note_change_seq'), OLD.user_id::int);
+				INSERT INTO note_tombstones (note_id, user_id, change_seq, purged_at)
+					VALUES (OLD.id, OLD.user_id, nextval('note_change_seq'), NOW());
+				RETURN OLD;
+			END
+			$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS trg_notes_tombstone ON notes`,
+		`CREATE TRIGGER trg_notes_tombstone AFTER DELETE ON notes
+			FOR EACH ROW EXECUTE FUNCTION notes_record_tombstone()`,
+
+		// tags are part of a note, adding, removing, renaming or recoloring one is a change of the note
+		// the notes trigger above assigns the actual sequence value
+		`CREATE OR REPLACE FUNCTION note_tags_touch_note() RETURNS trigger AS $$
+			BEGIN
+				IF TG_OP = 'DELETE' THEN
+					UPDATE notes SET change_seq = 0 WHERE id = OLD.note_id;
+					RETURN OLD;
+				END IF;
+				UPDATE notes SET change_seq = 0 WHERE id = NEW.note_id;
+				RETURN NEW;
+			END
+			$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS trg_note_tags_touch_note ON note_tags`,
+		`CREATE TRIGGER trg_note_tags_touch_note AFTER INSERT OR DELETE ON note_tags
+			FOR EACH ROW EXECUTE FUNCTION note_tags_touch_note()`,
+		`CREATE OR REPLACE FUNCTION tags_touch_notes() RETURNS trigger AS $$
+			BEGIN
+				UPDATE notes SET change_seq = 0
+					WHERE id IN (SELECT note_id FROM note_tags WHERE tag_id = NEW.id);
+				RETURN NEW;
+			END
+			$$ LANGUAGE plpgsql`,
+		`DROP TRIGGER IF EXISTS trg_tags_touch_notes ON tags`,
+		`CREATE TRIGGER trg_tags_touch_notes AFTER UPDATE ON tags
+			FOR EACH ROW WHEN (OLD.name IS DISTINCT FROM NEW.name OR OLD.color IS DISTINCT FROM NEW.color)
+			EXECUTE FUNCTION tags_touch_notes()`,
+
+		// notes written before the feed existed get their first value from the trigger
+		`UPDATE notes SET change_seq = 0 WHERE change_seq = 0`,
+		`CREATE INDEX IF NOT EXISTS idx_notes_user_change_seq ON notes (user_id, change_seq)`,
+		// a client id is unique per user so a retried upload finds the note it created before
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_notes_user_client_id ON notes (user_id, client_id) WHERE client_id IS NOT NULL`,
+	}
+)
+
+// creates or updates every table the api uses
+func Migrate(db *gorm.DB) error {
+	// to auto migrate models
+	err := db.AutoMigrate(&model.User{}, &model.Note{}, &model.Tag{}, &model.Notebook{}, &model.NoteRevision{}, &model.NoteShare{}, &model.ShareLink{}, &model.NoteTombstone{}, &model.Attachment{}, &model.CalendarToken{}, &model.ChecklistItem{}, &model.NoteLink{}, &model.ImportJob{}, &model.AccessToken{}, &model.RefreshToken{}, &model.RevokedToken{})
+	if err != nil {
+		return err
+	}
+
+	if err := execAll(db, tagMigrations); err != nil {
+		return err
+	}
+	// needs the tag name index, and must run before search_vector is recreated without tag
+	if err := migrateLegacyTags(db); err != nil {
+		return err
+	}
+	if err := execAll(db, searchMigrations); err != nil {
+		return err
+	}
+	return execAll(db, syncMigrations)
+}
+
+// runs raw statements in order, stops at the first error
+func execAll(db *gorm.DB, stmts []string) error {
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notes used to have a single tag string column, this turns every value into a Tag
+// of the note's owner linked through note_tags and then drops the old column
+func migrateLegacyTags(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&model.Note{}, "tag") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		return execAll(tx, []string{
+			`INSERT INTO tags (user_id, name, color, created_at, updated_at)
+				SELECT DISTINCT ON (user_id, LOWER(TRIM(tag))) user_id, TRIM(tag), '', NOW(), NOW()
+				FROM notes
+				WHERE TRIM(COALESCE(tag, '')) <> ''
+				ON CONFLICT DO NOTHING`,
+			`INSERT INTO note_tags (note_id, tag_id)
+				SELECT notes.id, tags.id
+				FROM notes
+				JOIN tags ON tags.user_id = notes.user_id AND LOWER(tags.name) = LOWER(TRIM(notes.tag))
+				ON CONFLICT DO NOTHING`,
+			// the old search vector depends on the tag column
+			`ALTER TABLE notes DROP COLUMN IF EXISTS search_vector`,
+			`ALTER TABLE notes DROP COLUMN tag`,
+		})
+	})
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// db operations for [[links]] between notes
+type NoteLinkRepository interface {
+	// replaces the links of a note with the given titles and ids, resolved among its owner's notes
+	// titles match live notes ignoring case, the oldest note wins; ids must be notes of the owner
+	ReplaceForSource(source *model.Note, titles []string, ids []uint) error
+	// points dangling links of the user written as [[title]] to the note
+	ResolveDangling(userID uint, title string, targetID uint) error
+	// [[title]] links pointing to the note, id links are left out since they survive renames
+	FindTitleLinksTo(targetID uint) ([]model.NoteLink, error)
+	// live notes linking to the note that the viewer owns or got shared, latest change first
+	FindBacklinks(targetID, viewerID uint) ([]model.Note, error)
+	// live notes of the user and the links between them
+	Graph(userID uint) (*NoteGraph, error)
+}
+
+// a note in the graph
+type GraphNode struct {
+	ID       uint
+	Title    string
+	Archived bool
+}
+
+// one note linking to another, both ends are nodes of the same graph
+type GraphEdge struct {
+	SourceID uint
+	TargetID uint
+}
+
+// notes of a user and their links, nodes are ordered by id
+type NoteGraph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+type noteLinkRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new noteLinkRepository struct instance as interface
+func NewNoteLinkRepository(db *gorm.DB) NoteLinkRepository {
+	return &noteLinkRepository{db}
+}
+
+// unresolved titles are stored too, so a note created later under that title picks them up
+// links of a note to itself are dropped
+func (r *noteLinkRepository) ReplaceForSource(source *model.Note, titles []string, ids []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("source_id = ?", source.ID).Delete(&model.NoteLink{}).Error; err != nil {
+			return err
+		}
+
+		links := make([]model.NoteLink, 0, len(titles)+len(ids))
+
+		if len(titles) > 0 {
+			lowered := make([]string, 0, len(titles))
+			for _, title := range titles {
+				lowered = append(lowered, strings.ToLower(title))
+			}
+			var matches []struct {
+				ID    uint
+				Title string
+			}
+			err := tx.Raw(`SELECT DISTINCT ON (LOWER(title)) id, LOWER(title) AS title
+				FROM notes
+				WHERE user_id = ? AND deleted_at IS NULL AND LOWER(title) IN ?
+				ORDER BY LOWER(title), id`, source.UserID, lowered).Scan(&matches).Error
+			if err != nil {
+				return err
+			}
+			byTitle := make(map[string]uint, len(matches))
+			for _, m := range matches {
+				byTitle[m.Title] = m.ID
+			}
+
+			for _, title := range titles {
+				link := model.NoteLink{UserID: source.UserID, SourceID: source.ID, TargetTitle: title}
+				if id, ok := byTitle[strings.ToLower(title)]; ok {
+					if id == source.ID {
+						continue
+					}
+					link.TargetID = &id
+				}
+				links = append(links, link)
+			}
+		}
+
+		if len(ids) > 0 {
+			// notes in the trash count, the link works again once the note is restored
+			var existing []uint
+			err := tx.Unscoped().Model(&model.Note{}).
+				Where("user_id = ? AND id IN ? AND id <> ?", source.UserID, ids, source.ID).
+				Pluck("id", &existing).Error
+			if err != nil {
+				return err
+			}
+			for _, id := range existing {
+				links = append(links, model.NoteLink{UserID: source.UserID, SourceID: source.ID, TargetID: &id})
+			}
+		}
+
+		if len(links) == 0 {
+			return nil
+		}
+		return tx.Create(&links).Error
+	})
+}
+
+// links of notes the user owns only, never across accounts
+func (r *noteLinkRepository) ResolveDangling(userID uint, title string, targetID uint) error {
+	return r.db.Model(&model.NoteLink{}).
+		Where("user_id = ? AND target_id IS NULL AND target_title <> '' AND LOWER(target_title) = LOWER(?)", userID, title).
+		Where("source_id <> ?", targetID).
+		Update("target_id", targetID).Error
+}
+
+// ordered by source so renames rewrite notes in a stable order
+func (r *noteLinkRepository) FindTitleLinksTo(targetID uint) ([]model.NoteLink, error) {
+	var links []model.NoteLink
+	err := r.db.Where("target_id = ? AND target_title <> ''", targetID).Order("source_id ASC").Find(&links).Error
+	return links, err
+}
+
+// links always stay within one owner, a collaborator only sees the linking notes shared with them as well
+func (r *noteLinkRepository) FindBacklinks(targetID, viewerID uint) ([]model.Note, error) {
+	var notes []model.Note
+	err := r.db.Preload("Tags").
+		Where("id IN (SELECT source_id FROM note_links WHERE target_id = ?)", targetID).
+		Where("user_id = ? OR id IN (SELECT note_id FROM note_shares WHERE user_id = ?)", viewerID, viewerID).
+		Order("updated_at DESC, id DESC").
+		Find(&notes).Error
+	return notes, err
+}
+
+// archived notes are part of the graph, the trash is not
+func (r *noteLinkRepository) Graph(userID uint) (*NoteGraph, error) {
+	var notes []model.Note
+	err := r.db.Select("id", "title", "archived_at").
+		Where("user_id = ?", userID).
+		Order("id ASC").
+		Find(&notes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &NoteGraph{Nodes: make([]GraphNode, 0, len(notes)), Edges: []GraphEdge{}}
+	for _, note := range notes {
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: note.ID, Title: note.Title, Archived: note.ArchivedAt != nil})
+	}
+
+	err = r.db.Raw(`SELECT DISTINCT note_links.source_id, note_links.target_id
+		FROM note_links
+		JOIN notes AS sources ON sources.id = note_links.source_id AND sources.deleted_at IS NULL
+		JOIN notes AS targets ON targets.id = note_links.target_id AND targets.deleted_at IS NULL
+		WHERE note_links.user_id = ? AND targets.user_id = ?
+		ORDER BY note_links.source_id, note_links.target_id`, userID, userID).Scan(&graph.Edges).Error
+	if err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
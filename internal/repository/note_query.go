@@ -0,0 +1,251 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// returned when a cursor can't be decoded or was issued for another sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// page size limits for note listings
+const (
+	DefaultNoteLimit = 20
+	MaxNoteLimit     = 100
+)
+
+// which soft-deleted notes a listing includes
+type DeletedFilter string
+
+const (
+	DeletedExclude DeletedFilter = "exclude"
+	DeletedOnly    DeletedFilter = "only"
+	DeletedInclude DeletedFilter = "include"
+)
+
+// which archived notes a listing includes
+type ArchivedFilter string
+
+const (
+	ArchivedExclude ArchivedFilter = "exclude"
+	ArchivedOnly    ArchivedFilter = "only"
+	ArchivedInclude ArchivedFilter = "include"
+)
+
+// sort keys accepted by note listings mapped to their column
+var noteSortColumns = map[string]string{
+	"created": "created_at",
+	"updated": "updated_at",
+	"title":   "title",
+	"date":    "date",
+}
+
+// checks a sort key from the query string
+func IsValidNoteSort(sort string) bool {
+	_, ok := noteSortColumns[sort]
+	return ok
+}
+
+// paging, sorting and filtering for note listings, zero values mean "no filter"
+type NoteListOptions struct {
+	Limit  int
+	Cursor string
+	// one of created, updated, title, date
+	Sort string
+	Desc bool
+
+	// notes must carry every one of these tags, matched by name ignoring case
+	Tags   []string
+	Pinned *bool
+	// restricts the listing to notes filed in one of these notebooks
+	NotebookIDs []uint
+	DateFrom    *time.Time
+	DateTo      *time.Time
+	Deleted     DeletedFilter
+	Archived    ArchivedFilter
+	// true keeps notes whose checklist is all checked, false the ones with open items
+	// notes without a checklist match neither
+	ChecklistDone *bool
+}
+
+// one page of notes, NextCursor is empty on the last page
+type NotePage struct {
+	Notes      []model.Note
+	NextCursor string
+}
+
+// position of the last note of a page, pinned notes always come first
+type noteCursor struct {
+	Sort   string `json:"s"`
+	Pinned bool   `json:"p"`
+	Value  string `json:"v"`
+	ID     uint   `json:"id"`
+}
+
+// fills in defaults for missing options
+func (o NoteListOptions) normalized() NoteListOptions {
+	if o.Limit <= 0 {
+		o.Limit = DefaultNoteLimit
+	}
+	if o.Limit > MaxNoteLimit {
+		o.Limit = MaxNoteLimit
+	}
+	if o.Sort == "" {
+		o.Sort = "date"
+		o.Desc = true
+	}
+	if o.Deleted == "" {
+		o.Deleted = DeletedExclude
+	}
+	if o.Archived == "" {
+		o.Archived = ArchivedExclude
+	}
+	return o
+}
+
+// identifies sort key and direction inside a cursor
+func (o NoteListOptions) sortKey() string {
+	if o.Desc {
+		return o.Sort + ":desc"
+	}
+	return o.Sort + ":asc"
+}
+
+// applies filters, keyset condition, ordering and limit to a query on notes
+func applyNoteListOptions(q *gorm.DB, opts NoteListOptions) (*gorm.DB, error) {
+	column, ok := noteSortColumns[opts.Sort]
+	if !ok {
+		return nil, errors.New("invalid sort key")
+	}
+
+	q = applyNoteFilters(q, opts)
+
+	// keyset: rows strictly after the cursor in (pinned DESC, column, id) order
+	if opts.Cursor != "" {
+		cur, err := decodeNoteCursor(opts.Cursor)
+		if err != nil || cur.Sort != opts.sortKey() {
+			return nil, ErrInvalidCursor
+		}
+		value, err := cursorValue(opts.Sort, cur.Value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		op := ">"
+		if opts.Desc {
+			op = "<"
+		}
+		q = q.Where("(notes.pinned < ?) OR (notes.pinned = ? AND (notes."+column+" "+op+" ? OR (notes."+column+" = ? AND notes.id "+op+" ?)))",
+			cur.Pinned, cur.Pinned, value, value, cur.ID)
+	}
+
+	direction := " ASC"
+	if opts.Desc {
+		direction = " DESC"
+	}
+	// one extra row tells us whether there is a next page
+	return q.Order("notes.pinned DESC, notes." + column + direction + ", notes.id" + direction).Limit(opts.Limit + 1), nil
+}
+
+// deleted and archived state, tags, pinned, date range and checklist filters
+func applyNoteFilters(q *gorm.DB, opts NoteListOptions) *gorm.DB {
+	switch opts.Deleted {
+	case DeletedOnly:
+		q = q.Unscoped().Where("notes.deleted_at IS NOT NULL")
+	case DeletedInclude:
+		q = q.Unscoped()
+	}
+	switch opts.Archived {
+	case ArchivedExclude:
+		q = q.Where("notes.archived_at IS NULL")
+	case ArchivedOnly:
+		q = q.Where("notes.archived_at IS NOT NULL")
+	}
+
+	for _, tag := range opts.Tags {
+		q = q.Where("EXISTS (SELECT 1 FROM note_tags JOIN tags ON tags.id = note_tags.tag_id "+
+			"WHERE note_tags.note_id = notes.id AND LOWER(tags.name) = LOWER(?))", tag)
+	}
+	if opts.Pinned != nil {
+		q = q.Where("notes.pinned = ?", *opts.Pinned)
+	}
+	if opts.NotebookIDs != nil {
+		q = q.Where("notes.notebook_id IN ?", opts.NotebookIDs)
+	}
+	if opts.DateFrom != nil {
+		q = q.Where("notes.date >= ?", *opts.DateFrom)
+	}
+	if opts.DateTo != nil {
+		q = q.Where("notes.date < ?", *opts.DateTo)
+	}
+	if opts.ChecklistDone != nil {
+		if *opts.ChecklistDone {
+			q = q.Where("notes.checklist_total > 0 AND notes.checklist_done = notes.checklist_total")
+		} else {
+			q = q.Where("notes.checklist_done < notes.checklist_total")
+		}
+	}
+	return q
+}
+
+// trims the extra row fetched by applyNoteListOptions and builds the next cursor
+func buildNotePage(notes []model.Note, opts NoteListOptions) *NotePage {
+	page := &NotePage{Notes: notes}
+	if len(notes) <= opts.Limit {
+		return page
+	}
+
+	page.Notes = notes[:opts.Limit]
+	last := page.Notes[len(page.Notes)-1]
+	page.NextCursor = encodeNoteCursor(noteCursor{
+		Sort:   opts.sortKey(),
+		Pinned: last.Pinned,
+		Value:  sortValue(opts.Sort, &last),
+		ID:     last.ID,
+	})
+	return page
+}
+
+// value of the sort column of a note as stored in the cursor
+func sortValue(sort string, note *model.Note) string {
+	switch sort {
+	case "created":
+		return note.CreatedAt.Format(time.RFC3339Nano)
+	case "updated":
+		return note.UpdatedAt.Format(time.RFC3339Nano)
+	case "title":
+		return note.Title
+	default:
+		return note.Date.Format(time.RFC3339Nano)
+	}
+}
+
+// turns a cursor value back into something comparable with the column
+func cursorValue(sort, value string) (interface{}, error) {
+	if sort == "title" {
+		return value, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func encodeNoteCursor(cur noteCursor) string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeNoteCursor(s string) (*noteCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var cur noteCursor
+	if err := json.Unmarshal(raw, &cur); err != nil {
+		return nil, err
+	}
+	return &cur, nil
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// reminders of notes in the trash wait until the note is restored
+func (r *noteRepository) FindRemindersDue(at time.Time, limit int) ([]model.Note, error) {
+	var notes []model.Note
+	err := r.db.
+		Preload("Tags").
+		Where("remind_at IS NOT NULL AND remind_at <= ?", at).
+		Order("remind_at ASC, id ASC").
+		Limit(limit).
+		Find(&notes).Error
+	return notes, err
+}
+
+// conditional on remind_at so two schedulers never fire the same reminder
+// version is bumped so ETags taken before the reminder moved no longer match
+func (r *noteRepository) AdvanceReminder(id uint, fired time.Time, next, due *time.Time, recurrence string) (bool, error) {
+	res := r.db.Model(&model.Note{}).
+		Where("id = ? AND remind_at = ?", id, fired).
+		Updates(map[string]interface{}{
+			"remind_at":  next,
+			"due_at":     due,
+			"recurrence": recurrence,
+			"version":    gorm.Expr("version + 1"),
+		})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// LEAST skips nulls, so a note is sorted by whichever of its two dates comes first
+// archived notes are done with, they stay out like in the default listing
+func (r *noteRepository) FindUpcoming(userID uint, from, to time.Time) ([]model.Note, error) {
+	var notes []model.Note
+	err := r.db.
+		Preload("Tags").
+		Where("user_id = ? AND archived_at IS NULL", userID).
+		Where("((remind_at >= ? AND remind_at <= ?) OR (due_at >= ? AND due_at <= ?))", from, to, from, to).
+		Order("LEAST(remind_at, due_at) ASC, id ASC").
+		Find(&notes).Error
+	return notes, err
+}
+
+// notes past their due date, archived ones count as done
+func (r *noteRepository) FindOverdue(userID uint, before time.Time) ([]model.Note, error) {
+	var notes []model.Note
+	err := r.db.
+		Preload("Tags").
+		Where("user_id = ? AND due_at < ? AND archived_at IS NULL", userID, before).
+		Order("due_at ASC, id ASC").
+		Find(&notes).Error
+	return notes, err
+}
+
+// tags are matched like in listings, case-insensitive and all of them required
+func (r *noteRepository) FindForCalendar(userID uint, tags []string, limit int) ([]model.Note, error) {
+	q := r.db.
+		Preload("Tags").
+		Where("notes.user_id = ?", userID).
+		// notes written before dates were filled in have the zero time
+		Where("(notes.event_at IS NOT NULL OR notes.due_at IS NOT NULL OR notes.remind_at IS NOT NULL OR notes.date > ?)", time.Time{})
+	for _, tag := range tags {
+		q = q.Where("EXISTS (SELECT 1 FROM note_tags JOIN tags ON tags.id = note_tags.tag_id "+
+			"WHERE note_tags.note_id = notes.id AND LOWER(tags.name) = LOWER(?))", tag)
+	}
+
+	var notes []model.Note
+	err := q.Order("COALESCE(notes.event_at, notes.due_at, notes.remind_at, notes.date) DESC, notes.id DESC").
+		Limit(limit).
+		Find(&notes).Error
+	return notes, err
+}
@@ -1,70 +1,143 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
 	"github.com/dassajib/prohor-api/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// returned by versioned writes when the note changed since it was read
+var ErrVersionConflict = errors.New("note was modified in the meantime")
+
 // interface defines all required methods for note operations
 type NoteRepository interface {
 	Create(note *model.Note) error
+	// saves the note only if its version is still note.Version, then bumps note.Version
 	Update(note *model.Note) error
 	FindByID(id uint) (*model.Note, error)
-	FindByUser(userID uint) ([]model.Note, error)
+	// one page of a user's notes, see NoteListOptions
+	FindByUser(userID uint, opts NoteListOptions) (*NotePage, error)
+	// one page of notes other users shared with the user
+	FindSharedWith(userID uint, opts NoteListOptions) (*NotePage, error)
 	// marks deleted_at but doesn't remove
 	DeleteSoft(id uint) error
-	RestoreDeleted(id uint) error
+	// restores the note only if its version is still the given one
+	RestoreDeleted(id uint, version uint) error
 	DeletePermanent(id uint) error
-	SearchUserNotes(userID uint, query string) ([]model.Note, error)
+	// full-text search, ranked by relevance unless opts.Sort says otherwise
+	SearchUserNotes(userID uint, query string, opts NoteListOptions) (*NoteSearchPage, error)
+	// soft-deleted notes of a user deleted at or after the given time, most recently deleted first
+	// the zero time lists the whole trash
+	FindTrashByUser(userID uint, deletedSince time.Time) ([]model.Note, error)
+	// soft-deleted notes of all users deleted before the given time
+	FindDeletedBefore(before time.Time, limit int) ([]model.Note, error)
+	// notes of a user written after the given change sequence, including the trash, oldest change first
+	FindChangedSince(userID uint, since int64, limit int) ([]model.Note, error)
+	// note a sync client created under its own id, gorm.ErrRecordNotFound if there is none
+	FindByClientID(userID uint, clientID string) (*model.Note, error)
+	// DeleteSoft for every live note in the notebooks, with a shared timestamp, returns the notes it deleted
+	DeleteSoftInNotebooks(notebookIDs []uint, at time.Time) ([]model.Note, error)
+	// RestoreDeleted for notes in the notebooks that were deleted at the given time, returns the notes it restored
+	RestoreDeletedInNotebooks(notebookIDs []uint, at time.Time) ([]model.Note, error)
+	// live notes of all users whose reminder is due at the given time, earliest first
+	FindRemindersDue(at time.Time, limit int) ([]model.Note, error)
+	// moves a fired reminder on to its next occurrence, nil next clears it
+	// reports false when the reminder was changed or fired by someone else meanwhile
+	AdvanceReminder(id uint, fired time.Time, next, due *time.Time, recurrence string) (bool, error)
+	// live, unarchived notes of a user with a reminder or due date in the given window, soonest first
+	FindUpcoming(userID uint, from, to time.Time) ([]model.Note, error)
+	// live, unarchived notes of a user due before the given time, most overdue first
+	FindOverdue(userID uint, before time.Time) ([]model.Note, error)
+	// live notes of a user with a date, event, due or reminder time that carry all the tags, latest first
+	FindForCalendar(userID uint, tags []string, limit int) ([]model.Note, error)
 }
 
 // gorm DB instance injected from outside
 type noteRepository struct {
-	db *gorm.DB 
+	db *gorm.DB
 }
 
 // constructor returns a new noteRepository struct instance as interface
 func NewNoteRepository(db *gorm.DB) NoteRepository {
-	return &noteRepository{db}  
+	return &noteRepository{db}
 }
 
-// create note
+// create note, note.Tags must already exist
 func (r *noteRepository) Create(note *model.Note) error {
-	return r.db.Create(note).Error 
+	return r.db.Omit("Tags.*").Create(note).Error
 }
 
-// update note 
+// update note and replace its tags with note.Tags, also works on notes in the trash
+// the write only happens when nobody else bumped the version since the note was read
 func (r *noteRepository) Update(note *model.Note) error {
-	return r.db.Save(note).Error
+	expected := note.Version
+	note.Version = expected + 1
+
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().Model(note).
+			Where("version = ?", expected).
+			Select("*").
+			Omit("ID", "CreatedAt", "ClientID", "ChecklistTotal", "ChecklistDone", "Tags", "Revisions", "Shares", "ShareLinks", "ChecklistItems", "Links", "Backlinks").
+			Updates(note)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+		return tx.Model(note).Omit("Tags.*").Association("Tags").Replace(note.Tags)
+	})
+	if err != nil {
+		note.Version = expected
+	}
+	return err
 }
 
 // find note including soft-deleted ones
 func (r *noteRepository) FindByID(id uint) (*model.Note, error) {
 	var note model.Note
 	// unscoped includes soft-deleted notes
-	err := r.db.Unscoped().First(&note, id).Error
+	err := r.db.Unscoped().Preload("Tags").First(&note, id).Error
 	return &note, err
 }
 
-// returns all notes created by a specific user
-func (r *noteRepository) FindByUser(userID uint) ([]model.Note, error) {
-	var notes []model.Note
-	// pinned notes first, then most recent
-	err := r.db.Unscoped().
-		Where("user_id = ?", userID).
-		Order("pinned DESC, date DESC"). 
-		Find(&notes).Error
-	return notes, err
+// returns a page of notes created by a specific user
+func (r *noteRepository) FindByUser(userID uint, opts NoteListOptions) (*NotePage, error) {
+	return r.list(r.db.Where("notes.user_id = ?", userID), opts)
+}
+
+// returns a page of notes the user holds a share grant for
+func (r *noteRepository) FindSharedWith(userID uint, opts NoteListOptions) (*NotePage, error) {
+	return r.list(r.db.Where("EXISTS (SELECT 1 FROM note_shares WHERE note_shares.note_id = notes.id AND note_shares.user_id = ?)", userID), opts)
 }
 
 // deleteSoft marks the note as deleted. soft delete using GORM's DeletedAt
+// version is bumped so ETags taken before the delete no longer match
 func (r *noteRepository) DeleteSoft(id uint) error {
-	return r.db.Delete(&model.Note{}, id).Error
+	return r.db.Model(&model.Note{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"deleted_at": time.Now(),
+		"version":    gorm.Expr("version + 1"),
+	}).Error
 }
 
 // resets the deleted_at field to NULL (restores the note)
-func (r *noteRepository) RestoreDeleted(id uint) error {
-	return r.db.Unscoped().Model(&model.Note{}).Where("id = ?", id).Update("deleted_at", nil).Error
+func (r *noteRepository) RestoreDeleted(id uint, version uint) error {
+	res := r.db.Unscoped().Model(&model.Note{}).
+		Where("id = ? AND version = ?", id, version).
+		Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+		})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
 }
 
 // permanently delete
@@ -72,11 +145,105 @@ func (r *noteRepository) DeletePermanent(id uint) error {
 	return r.db.Unscoped().Delete(&model.Note{}, id).Error
 }
 
-// search note
-func (r *noteRepository) SearchUserNotes(userID uint, query string) ([]model.Note, error) {
+// notes in the trash of a user
+func (r *noteRepository) FindTrashByUser(userID uint, deletedSince time.Time) ([]model.Note, error) {
+	var notes []model.Note
+	q := r.db.Unscoped().
+		Preload("Tags").
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID)
+	if !deletedSince.IsZero() {
+		q = q.Where("deleted_at >= ?", deletedSince)
+	}
+	err := q.Order("deleted_at DESC").Find(&notes).Error
+	return notes, err
+}
+
+// notes whose retention window is over, oldest first
+func (r *noteRepository) FindDeletedBefore(before time.Time, limit int) ([]model.Note, error) {
+	var notes []model.Note
+	err := r.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Order("deleted_at ASC").
+		Limit(limit).
+		Find(&notes).Error
+	return notes, err
+}
+
+// change feed of a user, soft-deleted notes are part of it so clients learn about the trash
+func (r *noteRepository) FindChangedSince(userID uint, since int64, limit int) ([]model.Note, error) {
 	var notes []model.Note
 	err := r.db.Unscoped().
-		Where("user_id = ? AND (title ILIKE ? OR content ILIKE ? OR tag ILIKE ?)", userID, "%"+query+"%", "%"+query+"%", "%"+query+"%").
+		Preload("Tags").
+		Where("user_id = ? AND change_seq > ?", userID, since).
+		Order("change_seq ASC").
+		Limit(limit).
 		Find(&notes).Error
 	return notes, err
 }
+
+// find a note by the id its sync client gave it
+func (r *noteRepository) FindByClientID(userID uint, clientID string) (*model.Note, error) {
+	var note model.Note
+	err := r.db.Unscoped().Preload("Tags").Where("user_id = ? AND client_id = ?", userID, clientID).First(&note).Error
+	return &note, err
+}
+
+// soft delete of a whole notebook subtree, the explicit timestamp ties the notes to the notebooks
+func (r *noteRepository) DeleteSoftInNotebooks(notebookIDs []uint, at time.Time) ([]model.Note, error) {
+	return r.updateInNotebooks(notebookIDs, "deleted_at IS NULL", map[string]interface{}{
+		"deleted_at": at,
+		"version":    gorm.Expr("version + 1"),
+	})
+}
+
+// notes deleted on their own before the notebook keep their own deleted_at and stay in the trash
+func (r *noteRepository) RestoreDeletedInNotebooks(notebookIDs []uint, at time.Time) ([]model.Note, error) {
+	return r.updateInNotebooks(notebookIDs, "deleted_at = ?", map[string]interface{}{
+		"deleted_at": nil,
+		"version":    gorm.Expr("version + 1"),
+	}, at)
+}
+
+// updates the matching notes of the notebooks and loads them again with their tags
+// RETURNING tells exactly which rows the update touched
+func (r *noteRepository) updateInNotebooks(notebookIDs []uint, cond string, values map[string]interface{}, args ...interface{}) ([]model.Note, error) {
+	if len(notebookIDs) == 0 {
+		return nil, nil
+	}
+
+	var notes []model.Note
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var updated []model.Note
+		err := tx.Unscoped().Model(&updated).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+			Where("notebook_id IN ?", notebookIDs).
+			Where(cond, args...).
+			Updates(values).Error
+		if err != nil || len(updated) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(updated))
+		for _, note := range updated {
+			ids = append(ids, note.ID)
+		}
+		return tx.Unscoped().Preload("Tags").Where("id IN ?", ids).Order("id").Find(&notes).Error
+	})
+	return notes, err
+}
+
+// runs a listing query with paging, sorting and filters applied
+// soft-deleted notes are excluded unless opts.Deleted says otherwise
+func (r *noteRepository) list(q *gorm.DB, opts NoteListOptions) (*NotePage, error) {
+	opts = opts.normalized()
+	q, err := applyNoteListOptions(q.Model(&model.Note{}).Preload("Tags"), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var notes []model.Note
+	if err := q.Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return buildNotePage(notes, opts), nil
+}
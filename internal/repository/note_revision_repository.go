@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// db operations for note history, revisions are never updated
+type NoteRevisionRepository interface {
+	// assigns the next rev number of the note and inserts the revision
+	Create(revision *model.NoteRevision) error
+	// revisions of a note, newest first
+	FindByNote(noteID uint) ([]model.NoteRevision, error)
+	FindByRev(noteID uint, rev int) (*model.NoteRevision, error)
+	// newest revision of a note, gorm.ErrRecordNotFound when there is none
+	FindLatest(noteID uint) (*model.NoteRevision, error)
+	// deletes the oldest revisions of a user above the cap, a note's latest revision is always kept
+	Prune(userID uint, max int) error
+	// users with more revisions than the cap
+	FindUsersOverCap(max int) ([]uint, error)
+}
+
+type noteRevisionRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new noteRevisionRepository struct instance as interface
+func NewNoteRevisionRepository(db *gorm.DB) NoteRevisionRepository {
+	return &noteRevisionRepository{db}
+}
+
+// rev number and insert in one transaction, the unique (note_id, rev) index catches races
+func (r *noteRevisionRepository) Create(revision *model.NoteRevision) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var last int
+		err := tx.Model(&model.NoteRevision{}).
+			Where("note_id = ?", revision.NoteID).
+			Select("COALESCE(MAX(rev), 0)").
+			Scan(&last).Error
+		if err != nil {
+			return err
+		}
+
+		revision.Rev = last + 1
+		return tx.Create(revision).Error
+	})
+}
+
+// history of a note
+func (r *noteRevisionRepository) FindByNote(noteID uint) ([]model.NoteRevision, error) {
+	var revisions []model.NoteRevision
+	err := r.db.Where("note_id = ?", noteID).Order("rev DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// single revision by its number
+func (r *noteRevisionRepository) FindByRev(noteID uint, rev int) (*model.NoteRevision, error) {
+	var revision model.NoteRevision
+	err := r.db.Where("note_id = ? AND rev = ?", noteID, rev).First(&revision).Error
+	return &revision, err
+}
+
+// latest revision of a note
+func (r *noteRevisionRepository) FindLatest(noteID uint) (*model.NoteRevision, error) {
+	var revision model.NoteRevision
+	err := r.db.Where("note_id = ?", noteID).Order("rev DESC").First(&revision).Error
+	return &revision, err
+}
+
+// counts first so the common case (under the cap) is a single cheap query
+func (r *noteRevisionRepository) Prune(userID uint, max int) error {
+	var count int64
+	if err := r.db.Model(&model.NoteRevision{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return err
+	}
+	excess := int(count) - max
+	if excess <= 0 {
+		return nil
+	}
+
+	return r.db.Exec(`DELETE FROM note_revisions WHERE id IN (
+			SELECT id FROM note_revisions AS old
+			WHERE old.user_id = ?
+				AND old.rev < (SELECT MAX(rev) FROM note_revisions AS latest WHERE latest.note_id = old.note_id)
+			ORDER BY old.created_at ASC, old.id ASC
+			LIMIT ?
+		)`, userID, excess).Error
+}
+
+// one grouped scan instead of a count per user
+func (r *noteRevisionRepository) FindUsersOverCap(max int) ([]uint, error) {
+	var userIDs []uint
+	err := r.db.Model(&model.NoteRevision{}).
+		Group("user_id").
+		Having("COUNT(*) > ?", max).
+		Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
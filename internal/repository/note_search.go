@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// sort key for search results ordered by ts_rank, only valid for SearchUserNotes
+const SortRelevance = "relevance"
+
+// ts_headline marks matches with these control characters, the text around them is
+// html-escaped afterwards so note content can't inject markup into the snippet
+const (
+	headlineStart = "\x02"
+	headlineStop  = "\x03"
+)
+
+// a note whose tag names match the query, tags aren't part of search_vector
+const tagMatchSQL = "EXISTS (SELECT 1 FROM note_tags JOIN tags ON tags.id = note_tags.tag_id " +
+	"WHERE note_tags.note_id = notes.id AND to_tsvector('english', tags.name) @@ search_query)"
+
+// ts_rank over title and content plus a fixed boost for a matching tag
+const rankSQL = "(ts_rank(notes.search_vector, search_query) + CASE WHEN " + tagMatchSQL + " THEN 0.4::real ELSE 0::real END)"
+
+// options for ts_headline, a snippet of a few fragments around the matches
+var (
+	snippetOptions = `StartSel="` + headlineStart + `", StopSel="` + headlineStop + `", MaxFragments=2, MaxWords=25, MinWords=8, FragmentDelimiter=" … "`
+	titleOptions   = `StartSel="` + headlineStart + `", StopSel="` + headlineStop + `", HighlightAll=true`
+)
+
+// a note matching a search with its rank and highlighted text
+// Snippet and TitleHighlight are escaped html with matches wrapped in <mark>
+type NoteSearchResult struct {
+	model.Note
+	Rank           float32
+	Snippet        string
+	TitleHighlight string
+}
+
+// one page of search results, NextCursor is empty on the last page
+type NoteSearchPage struct {
+	Results    []NoteSearchResult
+	NextCursor string
+}
+
+// full-text search over title and content using the generated search_vector column, and over tag names
+// query is parsed with websearch_to_tsquery, so "quoted phrases", OR and -excluded work
+func (r *noteRepository) SearchUserNotes(userID uint, query string, opts NoteListOptions) (*NoteSearchPage, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortRelevance
+		opts.Desc = true
+	}
+	opts = opts.normalized()
+
+	q := r.db.Model(&model.Note{}).
+		Select("notes.*, "+rankSQL+" AS rank, "+
+			"ts_headline('english', notes.content, search_query, ?) AS snippet, "+
+			"ts_headline('english', notes.title, search_query, ?) AS title_highlight", snippetOptions, titleOptions).
+		Joins("CROSS JOIN websearch_to_tsquery('english', ?) AS search_query", query).
+		Where("notes.user_id = ? AND (notes.search_vector @@ search_query OR "+tagMatchSQL+")", userID).
+		Preload("Tags")
+
+	var err error
+	if opts.Sort == SortRelevance {
+		q, err = applyRelevanceOptions(q, opts)
+	} else {
+		q, err = applyNoteListOptions(q, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var results []NoteSearchResult
+	if err := q.Find(&results).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].Snippet = renderHeadline(results[i].Snippet)
+		results[i].TitleHighlight = renderHeadline(results[i].TitleHighlight)
+	}
+	return buildSearchPage(results, opts), nil
+}
+
+// filters plus keyset on (rank, id), best matches first unless opts.Desc is false
+// pinned notes get no special place here
+func applyRelevanceOptions(q *gorm.DB, opts NoteListOptions) (*gorm.DB, error) {
+	q = applyNoteFilters(q, opts)
+
+	op, dir := ">", "ASC"
+	if opts.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	if opts.Cursor != "" {
+		cur, err := decodeNoteCursor(opts.Cursor)
+		if err != nil || cur.Sort != opts.sortKey() {
+			return nil, ErrInvalidCursor
+		}
+		if _, err := strconv.ParseFloat(cur.Value, 32); err != nil {
+			return nil, ErrInvalidCursor
+		}
+
+		// the rank is sent back as text and cast to real so it compares exactly
+		q = q.Where("("+rankSQL+" "+op+" CAST(? AS real)) OR ("+rankSQL+" = CAST(? AS real) AND notes.id "+op+" ?)",
+			cur.Value, cur.Value, cur.ID)
+	}
+
+	return q.Order("rank " + dir + ", notes.id " + dir).Limit(opts.Limit + 1), nil
+}
+
+// trims the extra row and builds the next cursor for either sort mode
+func buildSearchPage(results []NoteSearchResult, opts NoteListOptions) *NoteSearchPage {
+	page := &NoteSearchPage{Results: results}
+	if len(results) <= opts.Limit {
+		return page
+	}
+
+	page.Results = results[:opts.Limit]
+	last := page.Results[len(page.Results)-1]
+
+	cur := noteCursor{Sort: opts.sortKey(), Pinned: last.Pinned, ID: last.ID}
+	if opts.Sort == SortRelevance {
+		cur.Value = strconv.FormatFloat(float64(last.Rank), 'g', -1, 32)
+	} else {
+		cur.Value = sortValue(opts.Sort, &last.Note)
+	}
+	page.NextCursor = encodeNoteCursor(cur)
+	return page
+}
+
+// escapes a ts_headline result and turns the match markers into <mark> tags
+func renderHeadline(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, headlineStart, "<mark>")
+	return strings.ReplaceAll(s, headlineStop, "</mark>")
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// db operations for note share grants
+type NoteShareRepository interface {
+	// creates the grant or changes the role of an existing one for the same note and user
+	Upsert(share *model.NoteShare) error
+	// gorm.ErrRecordNotFound when the user has no grant for the note
+	FindByNoteAndUser(noteID, userID uint) (*model.NoteShare, error)
+	// grants of a note with their users, oldest first
+	FindByNote(noteID uint) ([]model.NoteShare, error)
+	// removes the grant, gorm.ErrRecordNotFound when there was none
+	Delete(noteID, userID uint) error
+}
+
+type noteShareRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new noteShareRepository struct instance as interface
+func NewNoteShareRepository(db *gorm.DB) NoteShareRepository {
+	return &noteShareRepository{db}
+}
+
+// insert on the (note_id, user_id) unique index, a second invite only changes the role
+func (r *noteShareRepository) Upsert(share *model.NoteShare) error {
+	now := time.Now()
+	share.CreatedAt = now
+	share.UpdatedAt = now
+
+	err := r.db.Omit("User").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "note_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "granted_by", "updated_at"}),
+	}).Create(share).Error
+	if err != nil {
+		return err
+	}
+	// read back so id and created_at are right when the grant already existed
+	return r.db.Where("note_id = ? AND user_id = ?", share.NoteID, share.UserID).First(share).Error
+}
+
+// find the grant a user holds for a note
+func (r *noteShareRepository) FindByNoteAndUser(noteID, userID uint) (*model.NoteShare, error) {
+	var share model.NoteShare
+	err := r.db.Where("note_id = ? AND user_id = ?", noteID, userID).First(&share).Error
+	return &share, err
+}
+
+// collaborators of a note, users are preloaded for their name and email
+func (r *noteShareRepository) FindByNote(noteID uint) ([]model.NoteShare, error) {
+	var shares []model.NoteShare
+	err := r.db.Preload("User").Where("note_id = ?", noteID).Order("created_at ASC, id ASC").Find(&shares).Error
+	return shares, err
+}
+
+// revoke a grant
+func (r *noteShareRepository) Delete(noteID, userID uint) error {
+	res := r.db.Where("note_id = ? AND user_id = ?", noteID, userID).Delete(&model.NoteShare{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
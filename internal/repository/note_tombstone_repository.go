@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// reads tombstones of permanently deleted notes, they are written by a trigger
+// tombstones are tiny and kept forever, so any old cursor still sees every deletion
+type NoteTombstoneRepository interface {
+	// tombstones of a user after the given change sequence, oldest first
+	FindSince(userID uint, since int64, limit int) ([]model.NoteTombstone, error)
+}
+
+type noteTombstoneRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new noteTombstoneRepository struct instance as interface
+func NewNoteTombstoneRepository(db *gorm.DB) NoteTombstoneRepository {
+	return &noteTombstoneRepository{db}
+}
+
+// tombstones of a user in feed order
+func (r *noteTombstoneRepository) FindSince(userID uint, since int64, limit int) ([]model.NoteTombstone, error) {
+	var tombstones []model.NoteTombstone
+	err := r.db.Where("user_id = ? AND change_seq > ?", userID, since).
+		Order("change_seq ASC").
+		Limit(limit).
+		Find(&tombstones).Error
+	return tombstones, err
+}
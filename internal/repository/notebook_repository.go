@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// db operations for notebooks and their hierarchy
+type NotebookRepository interface {
+	Create(notebook *model.Notebook) error
+	Update(notebook *model.Notebook) error
+	// find notebook including soft-deleted ones
+	FindByID(id uint) (*model.Notebook, error)
+	// live notebooks of a user ordered by name
+	FindByUser(userID uint) ([]model.Notebook, error)
+	// live notebooks with the given ids
+	FindByIDs(ids []uint) ([]model.Notebook, error)
+	// ids of the notebook and all live notebooks below it
+	FindSubtreeIDs(id uint) ([]uint, error)
+	// ids of the notebook and every notebook below it that was deleted at the given time
+	FindDeletedSubtreeIDs(id uint, deletedAt time.Time) ([]uint, error)
+	// marks the notebooks as deleted with a shared timestamp
+	DeleteSoftMany(ids []uint, at time.Time) error
+	// restores notebooks that were deleted at the given time
+	RestoreDeletedMany(ids []uint, at time.Time) error
+	// permanently removes notebooks deleted before the given time that no note refers to anymore
+	DeleteExpired(before time.Time) (int64, error)
+}
+
+type notebookRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new notebookRepository struct instance as interface
+func NewNotebookRepository(db *gorm.DB) NotebookRepository {
+	return &notebookRepository{db}
+}
+
+// create notebook
+func (r *notebookRepository) Create(notebook *model.Notebook) error {
+	return r.db.Create(notebook).Error
+}
+
+// update name and parent, unscoped so it also works on notebooks in the trash
+func (r *notebookRepository) Update(notebook *model.Notebook) error {
+	return r.db.Unscoped().Save(notebook).Error
+}
+
+// unscoped includes soft-deleted notebooks
+func (r *notebookRepository) FindByID(id uint) (*model.Notebook, error) {
+	var notebook model.Notebook
+	err := r.db.Unscoped().First(&notebook, id).Error
+	return &notebook, err
+}
+
+// notebooks of a user, the client builds the tree from ParentID
+func (r *notebookRepository) FindByUser(userID uint) ([]model.Notebook, error) {
+	var notebooks []model.Notebook
+	err := r.db.Where("user_id = ?", userID).Order("LOWER(name) ASC, id ASC").Find(&notebooks).Error
+	return notebooks, err
+}
+
+// notebooks by id, soft-deleted ones are skipped
+func (r *notebookRepository) FindByIDs(ids []uint) ([]model.Notebook, error) {
+	var notebooks []model.Notebook
+	if len(ids) == 0 {
+		return notebooks, nil
+	}
+	err := r.db.Where("id IN ?", ids).Order("LOWER(name) ASC, id ASC").Find(&notebooks).Error
+	return notebooks, err
+}
+
+// walks down the hierarchy with a recursive query, stopping at deleted notebooks
+func (r *notebookRepository) FindSubtreeIDs(id uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Raw(`WITH RECURSIVE subtree AS (
+			SELECT id FROM notebooks WHERE id = ? AND deleted_at IS NULL
+			UNION
+			SELECT notebooks.id FROM notebooks
+			JOIN subtree ON notebooks.parent_id = subtree.id
+			WHERE notebooks.deleted_at IS NULL
+		)
+		SELECT id FROM subtree`, id).Scan(&ids).Error
+	return ids, err
+}
+
+// same walk as FindSubtreeIDs but over notebooks removed by the same cascading delete
+func (r *notebookRepository) FindDeletedSubtreeIDs(id uint, deletedAt time.Time) ([]uint, error) {
+	var ids []uint
+	err := r.db.Raw(`WITH RECURSIVE subtree AS (
+			SELECT id FROM notebooks WHERE id = ? AND deleted_at = ?
+			UNION
+			SELECT notebooks.id FROM notebooks
+			JOIN subtree ON notebooks.parent_id = subtree.id
+			WHERE notebooks.deleted_at = ?
+		)
+		SELECT id FROM subtree`, id, deletedAt, deletedAt).Scan(&ids).Error
+	return ids, err
+}
+
+// soft delete with an explicit timestamp so the subtree can be restored as one unit
+func (r *notebookRepository) DeleteSoftMany(ids []uint, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Unscoped().Model(&model.Notebook{}).
+		Where("id IN ? AND deleted_at IS NULL", ids).
+		Update("deleted_at", at).Error
+}
+
+// resets deleted_at only for notebooks deleted together at the given time
+func (r *notebookRepository) RestoreDeletedMany(ids []uint, at time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Unscoped().Model(&model.Notebook{}).
+		Where("id IN ? AND deleted_at = ?", ids, at).
+		Update("deleted_at", nil).Error
+}
+
+// notes of an expired notebook are purged first, so only empty notebooks are removed here
+func (r *notebookRepository) DeleteExpired(before time.Time) (int64, error) {
+	res := r.db.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM notes WHERE notes.notebook_id = notebooks.id)").
+		Where("NOT EXISTS (SELECT 1 FROM notebooks AS children WHERE children.parent_id = notebooks.id AND children.deleted_at IS NULL)").
+		Delete(&model.Notebook{})
+	return res.RowsAffected, res.Error
+}
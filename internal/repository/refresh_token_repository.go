@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// db operations needed for refresh token rotation
+type RefreshTokenRepository interface {
+	Create(token *model.RefreshToken) error
+	FindByTokenID(tokenID string) (*model.RefreshToken, error)
+	// marks a token as used, returns false if it was already rotated or revoked
+	MarkRotated(id uint) (bool, error)
+	RevokeFamily(familyID string) error
+	RevokeAllForUser(userID uint) error
+}
+
+type refreshTokenRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new refreshTokenRepository struct instance as interface
+func NewRefreshTokenRepository(db *gorm.DB) RefreshTokenRepository {
+	return &refreshTokenRepository{db}
+}
+
+// save a newly issued refresh token
+func (r *refreshTokenRepository) Create(token *model.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+// find refresh token by its jti claim
+func (r *refreshTokenRepository) FindByTokenID(tokenID string) (*model.RefreshToken, error) {
+	var token model.RefreshToken
+	err := r.db.Where("token_id = ?", tokenID).First(&token).Error
+	return &token, err
+}
+
+// conditional update so two concurrent refreshes with the same token can't both win
+func (r *refreshTokenRepository) MarkRotated(id uint) (bool, error) {
+	res := r.db.Model(&model.RefreshToken{}).
+		Where("id = ? AND rotated_at IS NULL AND revoked_at IS NULL", id).
+		Update("rotated_at", time.Now())
+	return res.RowsAffected == 1, res.Error
+}
+
+// revoke every token that descends from the same login
+func (r *refreshTokenRepository) RevokeFamily(familyID string) error {
+	return r.db.Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revoke every refresh token of a user (logout from all devices)
+func (r *refreshTokenRepository) RevokeAllForUser(userID uint) error {
+	return r.db.Model(&model.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// db operations for the access token revocation list
+type RevokedTokenRepository interface {
+	Create(token *model.RevokedToken) error
+	Exists(tokenID string) (bool, error)
+	// revocations that still matter, used to warm the in-process cache
+	FindActive(now time.Time) ([]model.RevokedToken, error)
+	DeleteExpired(now time.Time) error
+}
+
+type revokedTokenRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new revokedTokenRepository struct instance as interface
+func NewRevokedTokenRepository(db *gorm.DB) RevokedTokenRepository {
+	return &revokedTokenRepository{db}
+}
+
+// revoking the same token twice is not an error
+func (r *revokedTokenRepository) Create(token *model.RevokedToken) error {
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(token).Error
+}
+
+// check whether a token id is on the list
+func (r *revokedTokenRepository) Exists(tokenID string) (bool, error) {
+	var count int64
+	err := r.db.Model(&model.RevokedToken{}).Where("token_id = ?", tokenID).Count(&count).Error
+	return count > 0, err
+}
+
+// all revocations for tokens that haven't expired yet
+func (r *revokedTokenRepository) FindActive(now time.Time) ([]model.RevokedToken, error) {
+	var tokens []model.RevokedToken
+	err := r.db.Where("expires_at > ?", now).Find(&tokens).Error
+	return tokens, err
+}
+
+// drop rows for tokens that expired on their own
+func (r *revokedTokenRepository) DeleteExpired(now time.Time) error {
+	return r.db.Where("expires_at <= ?", now).Delete(&model.RevokedToken{}).Error
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// db operations for public share links
+type ShareLinkRepository interface {
+	Create(link *model.ShareLink) error
+	FindByID(id uint) (*model.ShareLink, error)
+	// gorm.ErrRecordNotFound when no link has this token hash
+	FindByTokenHash(hash string) (*model.ShareLink, error)
+	// links of a note, newest first
+	FindByNote(noteID uint) ([]model.ShareLink, error)
+	// counts a view unless the link used up its views, false when it did
+	RecordView(id uint) (bool, error)
+	Revoke(id uint) error
+}
+
+type shareLinkRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new shareLinkRepository struct instance as interface
+func NewShareLinkRepository(db *gorm.DB) ShareLinkRepository {
+	return &shareLinkRepository{db}
+}
+
+// create link
+func (r *shareLinkRepository) Create(link *model.ShareLink) error {
+	return r.db.Create(link).Error
+}
+
+// find link by primary key
+func (r *shareLinkRepository) FindByID(id uint) (*model.ShareLink, error) {
+	var link model.ShareLink
+	err := r.db.First(&link, id).Error
+	return &link, err
+}
+
+// find link by the hash of its token
+func (r *shareLinkRepository) FindByTokenHash(hash string) (*model.ShareLink, error) {
+	var link model.ShareLink
+	err := r.db.Where("token_hash = ?", hash).First(&link).Error
+	return &link, err
+}
+
+// links of a note including revoked ones
+func (r *shareLinkRepository) FindByNote(noteID uint) ([]model.ShareLink, error) {
+	var links []model.ShareLink
+	err := r.db.Where("note_id = ?", noteID).Order("created_at DESC, id DESC").Find(&links).Error
+	return links, err
+}
+
+// conditional update so concurrent views can't go past max_views
+func (r *shareLinkRepository) RecordView(id uint) (bool, error) {
+	res := r.db.Model(&model.ShareLink{}).
+		Where("id = ? AND (max_views IS NULL OR view_count < max_views)", id).
+		Update("view_count", gorm.Expr("view_count + 1"))
+	return res.RowsAffected == 1, res.Error
+}
+
+// revoked links stay listed so the owner can see what was handed out
+func (r *shareLinkRepository) Revoke(id uint) error {
+	return r.db.Model(&model.ShareLink{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error
+}
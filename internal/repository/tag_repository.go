@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// db operations for a user's tags
+type TagRepository interface {
+	Create(tag *model.Tag) error
+	Update(tag *model.Tag) error
+	FindByID(id uint) (*model.Tag, error)
+	// all tags of a user ordered by name
+	FindByUser(userID uint) ([]model.Tag, error)
+	// case-insensitive lookup, gorm.ErrRecordNotFound when the user has no such tag
+	FindByName(userID uint, name string) (*model.Tag, error)
+	// returns the tags with the given names, creating the missing ones
+	FindOrCreateByNames(userID uint, names []string) ([]model.Tag, error)
+	// moves every note of the source tag to the target tag and deletes the source
+	Merge(sourceID, targetID uint) error
+	// deletes the tag, notes keep existing without it
+	Delete(id uint) error
+}
+
+type tagRepository struct {
+	db *gorm.DB
+}
+
+// constructor returns a new tagRepository struct instance as interface
+func NewTagRepository(db *gorm.DB) TagRepository {
+	return &tagRepository{db}
+}
+
+// create tag
+func (r *tagRepository) Create(tag *model.Tag) error {
+	return r.db.Create(tag).Error
+}
+
+// update tag name and color
+func (r *tagRepository) Update(tag *model.Tag) error {
+	return r.db.Save(tag).Error
+}
+
+// find tag by primary key
+func (r *tagRepository) FindByID(id uint) (*model.Tag, error) {
+	var tag model.Tag
+	err := r.db.First(&tag, id).Error
+	return &tag, err
+}
+
+// tags of a user sorted for display
+func (r *tagRepository) FindByUser(userID uint) ([]model.Tag, error) {
+	var tags []model.Tag
+	err := r.db.Where("user_id = ?", userID).Order("LOWER(name) ASC").Find(&tags).Error
+	return tags, err
+}
+
+// find tag by name ignoring case
+func (r *tagRepository) FindByName(userID uint, name string) (*model.Tag, error) {
+	var tag model.Tag
+	err := r.db.Where("user_id = ? AND LOWER(name) = LOWER(?)", userID, name).First(&tag).Error
+	return &tag, err
+}
+
+// inserts missing names and reads all of them back, existing tags keep their spelling
+func (r *tagRepository) FindOrCreateByNames(userID uint, names []string) ([]model.Tag, error) {
+	if len(names) == 0 {
+		return []model.Tag{}, nil
+	}
+
+	var tags []model.Tag
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		missing := make([]model.Tag, 0, len(names))
+		for _, name := range names {
+			missing = append(missing, model.Tag{UserID: userID, Name: name})
+		}
+		// unique index on (user_id, lower(name)) turns existing names into no-ops
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&missing).Error; err != nil {
+			return err
+		}
+
+		lowered := make([]string, 0, len(names))
+		for _, name := range names {
+			lowered = append(lowered, strings.ToLower(name))
+		}
+		return tx.Where("user_id = ? AND LOWER(name) IN ?", userID, lowered).Find(&tags).Error
+	})
+	return tags, err
+}
+
+// re-links notes in one statement so notes that had both tags end up with the target once
+func (r *tagRepository) Merge(sourceID, targetID uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO note_tags (note_id, tag_id)
+			SELECT note_id, ? FROM note_tags WHERE tag_id = ?
+			ON CONFLICT DO NOTHING`, targetID, sourceID).Error
+		if err != nil {
+			return err
+		}
+		// join rows of the source go away through the cascading foreign key
+		return tx.Delete(&model.Tag{}, sourceID).Error
+	})
+}
+
+// delete tag, join rows are removed by the cascading foreign key
+func (r *tagRepository) Delete(id uint) error {
+	return r.db.Delete(&model.Tag{}, id).Error
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+// runs writes that span several repositories as one db transaction
+type Transactor interface {
+	// fn gets repositories bound to the transaction, an error from fn rolls everything back
+	Transaction(fn func(tx TxRepositories) error) error
+}
+
+// repositories writing through one transaction
+type TxRepositories struct {
+	Notes     NoteRepository
+	Revisions NoteRevisionRepository
+	Links     NoteLinkRepository
+}
+
+type transactor struct {
+	db *gorm.DB
+}
+
+// constructor returns a new transactor struct instance as interface
+func NewTransactor(db *gorm.DB) Transactor {
+	return &transactor{db}
+}
+
+// transactions the repositories open themselves become savepoints inside this one
+func (t *transactor) Transaction(fn func(tx TxRepositories) error) error {
+	return t.db.Transaction(func(tx *gorm.DB) error {
+		return fn(TxRepositories{
+			Notes:     NewNoteRepository(tx),
+			Revisions: NewNoteRevisionRepository(tx),
+			Links:     NewNoteLinkRepository(tx),
+		})
+	})
+}
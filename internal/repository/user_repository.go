@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/dassajib/prohor-api/internal/model"
 	"gorm.io/gorm"
 )
@@ -9,6 +11,8 @@ import (
 type UserRepository interface {
 	Create(user *model.User) error
 	FindByEmail(email string) (*model.User, error)
+	FindByID(id uint) (*model.User, error)
+	SetTokensRevokedAt(id uint, at time.Time) error
 }
 
 // this struct is the actual implementation that does the real database work
@@ -36,3 +40,15 @@ func (r *userRepository) FindByEmail(email string) (*model.User, error) {
 	// return the pointer to the user orr error that might occurred
 	return &user, err
 }
+
+// receiver func to find the user by primary key
+func (r *userRepository) FindByID(id uint) (*model.User, error) {
+	var user model.User
+	err := r.db.First(&user, id).Error
+	return &user, err
+}
+
+// receiver func to invalidate all access tokens issued before the given time
+func (r *userRepository) SetTokensRevokedAt(id uint, at time.Time) error {
+	return r.db.Model(&model.User{}).Where("id = ?", id).Update("tokens_revoked_at", at).Error
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/utils"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// errors returned by the access token service
+var (
+	ErrAccessTokenNotFound    = errors.New("access token not found")
+	ErrInvalidAccessToken     = errors.New("invalid access token")
+	ErrInvalidAccessTokenName = errors.New("token name must be 1 to 100 characters")
+	ErrInvalidScope           = errors.New("scopes must be one or more of read, notes:write, notebooks:write, tags:write")
+	ErrInvalidTokenExpiry     = errors.New("expiry must be in the future")
+	ErrAccessTokenLimit       = errors.New("a user can't have more than 50 access tokens")
+)
+
+// scopes a personal access token can carry, a write scope doesn't include read
+const (
+	// every GET endpoint
+	ScopeRead = "read"
+	// notes and everything attached to them, including imports
+	ScopeNotesWrite     = "notes:write"
+	ScopeNotebooksWrite = "notebooks:write"
+	ScopeTagsWrite      = "tags:write"
+)
+
+// all scopes in the order they are stored in
+var AccessTokenScopes = []string{ScopeRead, ScopeNotesWrite, ScopeNotebooksWrite, ScopeTagsWrite}
+
+// tokens start with this so they are told apart from JWTs and found by secret scanners
+const AccessTokenPrefix = "phr_"
+
+const (
+	maxAccessTokensPerUser = 50
+	maxAccessTokenName     = 100
+	// characters of the token kept for display, the prefix plus a few random ones
+	accessTokenDisplayLength = len(AccessTokenPrefix) + 6
+	// last use is recorded at most this often per token
+	accessTokenTouchInterval = time.Minute
+)
+
+// defines what the access token service must provide
+type AccessTokenService interface {
+	// returns the token once, only its hash is stored; nil expiresAt never expires
+	Create(userID uint, name string, scopes []string, expiresAt *time.Time) (string, *model.AccessToken, error)
+	List(userID uint) ([]model.AccessToken, error)
+	Revoke(userID, id uint) error
+	// looks up the token behind a "phr_" bearer token, ErrInvalidAccessToken if it is unknown or expired
+	Authenticate(token string) (*model.AccessToken, error)
+}
+
+type accessTokenService struct {
+	repo repository.AccessTokenRepository
+}
+
+// constructor returns a new accessTokenService instance
+func NewAccessTokenService(repo repository.AccessTokenRepository) AccessTokenService {
+	return &accessTokenService{repo}
+}
+
+// scopes are deduplicated and stored in a fixed order
+func (s *accessTokenService) Create(userID uint, name string, scopes []string, expiresAt *time.Time) (string, *model.AccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxAccessTokenName {
+		return "", nil, ErrInvalidAccessTokenName
+	}
+	if len(scopes) == 0 {
+		return "", nil, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(AccessTokenScopes, scope) {
+			return "", nil, ErrInvalidScope
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, ErrInvalidTokenExpiry
+	}
+
+	count, err := s.repo.CountByUser(userID)
+	if err != nil {
+		return "", nil, err
+	}
+	if count >= maxAccessTokensPerUser {
+		return "", nil, ErrAccessTokenLimit
+	}
+
+	secret, err := utils.NewSecretToken()
+	if err != nil {
+		return "", nil, err
+	}
+	token := AccessTokenPrefix + secret
+
+	accessToken := &model.AccessToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:accessTokenDisplayLength],
+		TokenHash: utils.HashToken(token),
+		Scopes:    []string{},
+		ExpiresAt: expiresAt,
+	}
+	for _, scope := range AccessTokenScopes {
+		if slices.Contains(scopes, scope) {
+			accessToken.Scopes = append(accessToken.Scopes, scope)
+		}
+	}
+	if err := s.repo.Create(accessToken); err != nil {
+		return "", nil, err
+	}
+	return token, accessToken, nil
+}
+
+// newest first
+func (s *accessTokenService) List(userID uint) ([]model.AccessToken, error) {
+	return s.repo.FindByUser(userID)
+}
+
+// the row is deleted, the token stops working on its next request
+// and open event streams end at their next keep-alive
+func (s *accessTokenService) Revoke(userID, id uint) error {
+	deleted, err := s.repo.Delete(userID, id)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrAccessTokenNotFound
+	}
+	return nil
+}
+
+// unknown, malformed and expired tokens all get the same error
+func (s *accessTokenService) Authenticate(token string) (*model.AccessToken, error) {
+	if !strings.HasPrefix(token, AccessTokenPrefix) {
+		return nil, ErrInvalidAccessToken
+	}
+	accessToken, err := s.repo.FindByTokenHash(utils.HashToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAccessToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if accessToken.ExpiresAt != nil && !accessToken.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidAccessToken
+	}
+
+	// last use is informational, a failed write doesn't fail the request
+	now := time.Now()
+	if accessToken.LastUsedAt == nil || now.Sub(*accessToken.LastUsedAt) >= accessTokenTouchInterval {
+		if err := s.repo.TouchLastUsed(accessToken.ID, now, now.Add(-accessTokenTouchInterval)); err != nil {
+			log.Printf("Failed to record use of access token %d: %v", accessToken.ID, err)
+		}
+		accessToken.LastUsedAt = &now
+	}
+	return accessToken, nil
+}
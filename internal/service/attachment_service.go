@@ -0,0 +1,272 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/storage"
+	"github.com/dassajib/prohor-api/internal/pkg/utils"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"github.com/gabriel-vasile/mimetype"
+	"gorm.io/gorm"
+)
+
+// errors returned by the attachment service
+var (
+	ErrAttachmentNotFound  = errors.New("attachment not found")
+	ErrAttachmentEmpty     = errors.New("attachment is empty")
+	ErrAttachmentTooLarge  = errors.New("attachment is too large")
+	ErrAttachmentType      = errors.New("only images and PDF files can be attached")
+	ErrStorageQuotaReached = errors.New("storage quota exceeded")
+)
+
+// content types accepted for attachments, checked against the sniffed type
+var allowedAttachmentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+}
+
+// bytes mimetype needs to recognize every allowed type
+const sniffLength = 3072
+
+// how many orphaned attachments the sweep loads per round
+const orphanBatchSize = 100
+
+// limits of the attachment service, read from env in main
+type AttachmentSettings struct {
+	MaxFileSize int64
+	// bytes all notes of one owner may hold together
+	UserQuota int64
+}
+
+// defines what the attachment service must provide
+// attachments follow the note: viewers can download, editors can upload and delete
+// the quota is charged to the note's owner, also for files a collaborator uploaded
+type AttachmentService interface {
+	Upload(ctx context.Context, userID, noteID uint, fileName string, r io.Reader, size int64) (*model.Attachment, error)
+	List(userID, noteID uint) ([]model.Attachment, error)
+	// the caller must close the reader
+	Open(ctx context.Context, userID, noteID, attachmentID uint) (*model.Attachment, io.ReadCloser, error)
+	Delete(ctx context.Context, userID, noteID, attachmentID uint) error
+	// bytes used and allowed for the user's notes
+	Usage(userID uint) (used, quota int64, err error)
+	// removes attachments of permanently deleted notes together with their files
+	PurgeOrphans(ctx context.Context) (int, error)
+}
+
+type attachmentService struct {
+	repo     repository.AttachmentRepository
+	storage  storage.Storage
+	notes    NoteService
+	settings AttachmentSettings
+}
+
+// constructor returns a new attachmentService instance
+func NewAttachmentService(repo repository.AttachmentRepository, storage storage.Storage, notes NoteService, settings AttachmentSettings) AttachmentService {
+	return &attachmentService{repo, storage, notes, settings}
+}
+
+// sniffs the type from the first bytes, then streams the file to storage while hashing it
+func (s *attachmentService) Upload(ctx context.Context, userID, noteID uint, fileName string, r io.Reader, size int64) (*model.Attachment, error) {
+	if size <= 0 {
+		return nil, ErrAttachmentEmpty
+	}
+	if size > s.settings.MaxFileSize {
+		return nil, ErrAttachmentTooLarge
+	}
+
+	note, err := s.notes.Authorize(userID, noteID, NoteActionEdit)
+	if err != nil {
+		return nil, err
+	}
+	if note.DeletedAt.Valid {
+		return nil, ErrNoteNotFound
+	}
+
+	// early check so a file that can't fit isn't stored first, the insert checks again
+	used, err := s.repo.TotalSizeByUser(note.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if used+size > s.settings.UserQuota {
+		return nil, ErrStorageQuotaReached
+	}
+
+	head := make([]byte, min(size, sniffLength))
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	head = head[:n]
+	contentType := mimetype.Detect(head)
+	if !isAllowedAttachmentType(contentType) {
+		return nil, ErrAttachmentType
+	}
+
+	id, err := utils.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("notes/%d/%s", note.ID, id)
+
+	hash := sha256.New()
+	body := io.TeeReader(io.MultiReader(bytes.NewReader(head), r), hash)
+	if err := s.storage.Put(ctx, key, body, size, contentType.String()); err != nil {
+		return nil, err
+	}
+
+	attachment := &model.Attachment{
+		NoteID:      note.ID,
+		UserID:      note.UserID,
+		UploadedBy:  userID,
+		FileName:    cleanFileName(fileName),
+		ContentType: contentType.String(),
+		Size:        size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		StorageKey:  key,
+	}
+	if err := s.repo.CreateWithinQuota(attachment, s.settings.UserQuota); err != nil {
+		// nothing refers to the file without its row
+		if delErr := s.storage.Delete(context.Background(), key); delErr != nil {
+			log.Printf("Failed to delete stored file %s: %v", key, delErr)
+		}
+		// a parallel upload took the space in the meantime
+		if errors.Is(err, repository.ErrQuotaExceeded) {
+			return nil, ErrStorageQuotaReached
+		}
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// attachments of a note
+func (s *attachmentService) List(userID, noteID uint) ([]model.Attachment, error) {
+	if _, err := s.notes.Authorize(userID, noteID, NoteActionView); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByNote(noteID)
+}
+
+// opens the stored file of an attachment
+func (s *attachmentService) Open(ctx context.Context, userID, noteID, attachmentID uint) (*model.Attachment, io.ReadCloser, error) {
+	attachment, err := s.load(userID, noteID, attachmentID, NoteActionView)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := s.storage.Get(ctx, attachment.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, file, nil
+}
+
+// the row goes first, a file left behind only costs disk space
+func (s *attachmentService) Delete(ctx context.Context, userID, noteID, attachmentID uint) error {
+	attachment, err := s.load(userID, noteID, attachmentID, NoteActionEdit)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(attachment.ID); err != nil {
+		return err
+	}
+	if err := s.storage.Delete(ctx, attachment.StorageKey); err != nil {
+		log.Printf("Failed to delete stored file %s: %v", attachment.StorageKey, err)
+	}
+	return nil
+}
+
+// quota usage of the user's own notes
+func (s *attachmentService) Usage(userID uint) (int64, int64, error) {
+	used, err := s.repo.TotalSizeByUser(userID)
+	return used, s.settings.UserQuota, err
+}
+
+// the file goes first here, a row without file would be retried forever otherwise
+func (s *attachmentService) PurgeOrphans(ctx context.Context) (int, error) {
+	purged := 0
+	for {
+		attachments, err := s.repo.FindOrphans(orphanBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, attachment := range attachments {
+			if err := s.storage.Delete(ctx, attachment.StorageKey); err != nil {
+				return purged, err
+			}
+			if err := s.repo.Delete(attachment.ID); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(attachments) < orphanBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// fetch an attachment of the note after checking the user may perform the action on the note
+func (s *attachmentService) load(userID, noteID, attachmentID uint, action NoteAction) (*model.Attachment, error) {
+	if _, err := s.notes.Authorize(userID, noteID, action); err != nil {
+		return nil, err
+	}
+
+	attachment, err := s.repo.FindByID(attachmentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && attachment.NoteID != noteID) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// checks the sniffed type against the allow list, aliases like image/jpg count too
+func isAllowedAttachmentType(contentType *mimetype.MIME) bool {
+	for _, allowed := range allowedAttachmentTypes {
+		if contentType.Is(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// keeps only the base name without control characters, it ends up in Content-Disposition
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
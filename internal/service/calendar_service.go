@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/ical"
+	"github.com/dassajib/prohor-api/internal/pkg/utils"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// returned for unknown or replaced feed tokens
+var ErrCalendarNotFound = errors.New("calendar feed not found")
+
+// notes rendered into one feed, the ones with the latest dates win
+const maxCalendarNotes = 1000
+
+// long notes are cut in the description, calendar apps only show the start anyway
+const maxCalendarDescription = 2000
+
+// defines what the calendar service must provide
+type CalendarService interface {
+	// creates the user's feed token, an existing one stops working
+	RegenerateToken(userID uint) (string, error)
+	// turns the user's feed off
+	DeleteToken(userID uint) error
+	// renders the feed of the token's owner, only notes with all the tags if any are given
+	Feed(token string, tags []string) (string, error)
+}
+
+type calendarService struct {
+	tokens repository.CalendarTokenRepository
+	notes  repository.NoteRepository
+}
+
+// constructor returns a new calendarService instance
+func NewCalendarService(tokens repository.CalendarTokenRepository, notes repository.NoteRepository) CalendarService {
+	return &calendarService{tokens, notes}
+}
+
+// only the hash is kept, the token is shown once
+func (s *calendarService) RegenerateToken(userID uint) (string, error) {
+	token, err := utils.NewSecretToken()
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.tokens.Replace(userID, utils.HashToken(token)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// deleting a feed that doesn't exist is fine
+func (s *calendarService) DeleteToken(userID uint) error {
+	return s.tokens.DeleteByUser(userID)
+}
+
+// the feed covers the owner's own notes, shared notes belong to someone else's calendar
+func (s *calendarService) Feed(token string, tags []string) (string, error) {
+	calendarToken, err := s.tokens.FindByTokenHash(utils.HashToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrCalendarNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	notes, err := s.notes.FindForCalendar(calendarToken.UserID, tags, maxCalendarNotes)
+	if err != nil {
+		return "", err
+	}
+	return renderCalendar(notes, time.Now()), nil
+}
+
+// a note with an event time becomes a VEVENT, one with a due date a VTODO, it can be both
+// a note that only has a reminder becomes a VTODO starting then
+// a note with none of these becomes an all-day VEVENT on its date
+// the reminder is attached as alarm to the event if there is one, to the todo otherwise
+func renderCalendar(notes []model.Note, now time.Time) string {
+	var w ical.Writer
+	w.Begin("VCALENDAR")
+	w.Raw("VERSION", "2.0")
+	w.Raw("PRODID", "-//Prohor//Prohor API//EN")
+	w.Raw("CALSCALE", "GREGORIAN")
+	w.Text("X-WR-CALNAME", "Prohor")
+	// hint for clients that poll the feed
+	w.Raw("REFRESH-INTERVAL;VALUE=DURATION", "PT1H")
+	w.Raw("X-PUBLISHED-TTL", "PT1H")
+
+	for i := range notes {
+		note := &notes[i]
+		switch {
+		case note.EventAt != nil:
+			w.Begin("VEVENT")
+			writeNoteProperties(&w, note, "event", now)
+			w.Time("DTSTART", *note.EventAt)
+			if note.RemindAt != nil {
+				writeAlarm(&w, note)
+			}
+			w.End("VEVENT")
+		case note.DueAt == nil && note.RemindAt == nil:
+			// same uid as a timed event, setting an event time later moves the entry
+			w.Begin("VEVENT")
+			writeNoteProperties(&w, note, "event", now)
+			w.Date("DTSTART", note.Date)
+			w.End("VEVENT")
+		}
+
+		if note.DueAt != nil || (note.EventAt == nil && note.RemindAt != nil) {
+			w.Begin("VTODO")
+			writeNoteProperties(&w, note, "todo", now)
+			if note.DueAt != nil {
+				w.Time("DUE", *note.DueAt)
+			} else {
+				w.Time("DTSTART", *note.RemindAt)
+			}
+			if note.RemindAt != nil && note.EventAt == nil {
+				writeAlarm(&w, note)
+			}
+			w.End("VTODO")
+		}
+	}
+
+	w.End("VCALENDAR")
+	return w.String()
+}
+
+// properties shared by the event and the todo of a note
+// uids stay the same across renders so calendar apps update entries instead of duplicating them
+func writeNoteProperties(w *ical.Writer, note *model.Note, kind string, now time.Time) {
+	w.Raw("UID", fmt.Sprintf("note-%d-%s@prohor", note.ID, kind))
+	w.Time("DTSTAMP", now)
+	w.Time("CREATED", note.CreatedAt)
+	w.Time("LAST-MODIFIED", note.UpdatedAt)
+	w.Raw("SEQUENCE", fmt.Sprint(note.Version))
+	w.Text("SUMMARY", note.Title)
+	w.Text("DESCRIPTION", truncateRunes(note.Content, maxCalendarDescription))
+
+	categories := make([]string, 0, len(note.Tags))
+	for _, tag := range note.Tags {
+		categories = append(categories, tag.Name)
+	}
+	w.List("CATEGORIES", categories)
+}
+
+// display alarm at the reminder time, a display alarm must have a description
+func writeAlarm(w *ical.Writer, note *model.Note) {
+	description := note.Title
+	if description == "" {
+		description = "Reminder"
+	}
+	w.Begin("VALARM")
+	w.Raw("ACTION", "DISPLAY")
+	w.Text("DESCRIPTION", description)
+	w.Raw("TRIGGER;VALUE=DATE-TIME", ical.FormatTime(*note.RemindAt))
+	w.End("VALARM")
+}
+
+// cuts s to at most n runes
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
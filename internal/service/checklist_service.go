@@ -0,0 +1,183 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// errors returned by the checklist service
+var (
+	ErrChecklistItemNotFound = errors.New("checklist item not found")
+	ErrInvalidChecklistItem  = errors.New("item text must be 1 to 500 characters")
+	ErrChecklistFull         = errors.New("checklist can't have more than 500 items")
+	ErrInvalidChecklistOrder = errors.New("order must list every item of the checklist once")
+)
+
+// limits of a checklist
+const (
+	maxChecklistItems    = 500
+	maxChecklistItemText = 500
+)
+
+// defines what the checklist service must provide
+// viewers see the checklist, editors change it, notes in the trash can't be changed
+type ChecklistService interface {
+	List(userID, noteID uint) ([]model.ChecklistItem, error)
+	// nil position appends the item
+	Add(userID, noteID uint, text string, checked bool, position *int) (*model.ChecklistItem, error)
+	// nil fields are left as they are
+	Update(userID, noteID, itemID uint, text *string, checked *bool) (*model.ChecklistItem, error)
+	Delete(userID, noteID, itemID uint) error
+	// itemIDs is the new order of all items, returns the reordered checklist
+	Reorder(userID, noteID uint, itemIDs []uint) ([]model.ChecklistItem, error)
+}
+
+type checklistService struct {
+	repo  repository.ChecklistRepository
+	notes NoteService
+}
+
+// constructor returns a new checklistService instance
+func NewChecklistService(repo repository.ChecklistRepository, notes NoteService) ChecklistService {
+	return &checklistService{repo, notes}
+}
+
+// items in checklist order
+func (s *checklistService) List(userID, noteID uint) ([]model.ChecklistItem, error) {
+	if _, err := s.notes.Authorize(userID, noteID, NoteActionView); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByNote(noteID)
+}
+
+// adds an item, text is trimmed
+func (s *checklistService) Add(userID, noteID uint, text string, checked bool, position *int) (*model.ChecklistItem, error) {
+	if _, err := s.editableNote(userID, noteID); err != nil {
+		return nil, err
+	}
+	text, err := normalizeChecklistText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := s.repo.FindByNote(noteID)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) >= maxChecklistItems {
+		return nil, ErrChecklistFull
+	}
+
+	item := &model.ChecklistItem{NoteID: noteID, Text: text, Checked: checked, Position: -1}
+	if position != nil {
+		item.Position = max(*position, 0)
+	}
+	if err := s.repo.Create(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// changes text and/or checked state
+func (s *checklistService) Update(userID, noteID, itemID uint, text *string, checked *bool) (*model.ChecklistItem, error) {
+	if _, err := s.editableNote(userID, noteID); err != nil {
+		return nil, err
+	}
+	item, err := s.loadItem(noteID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	if text != nil {
+		normalized, err := normalizeChecklistText(*text)
+		if err != nil {
+			return nil, err
+		}
+		item.Text = normalized
+	}
+	if checked != nil {
+		item.Checked = *checked
+	}
+	if err := s.repo.Update(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// removes an item, the ones after it move up
+func (s *checklistService) Delete(userID, noteID, itemID uint) error {
+	if _, err := s.editableNote(userID, noteID); err != nil {
+		return err
+	}
+	item, err := s.loadItem(noteID, itemID)
+	if err != nil {
+		return err
+	}
+	return s.repo.Delete(item)
+}
+
+// a partial order would leave gaps or duplicate positions, so every item must be listed
+func (s *checklistService) Reorder(userID, noteID uint, itemIDs []uint) ([]model.ChecklistItem, error) {
+	if _, err := s.editableNote(userID, noteID); err != nil {
+		return nil, err
+	}
+
+	items, err := s.repo.FindByNote(noteID)
+	if err != nil {
+		return nil, err
+	}
+	current := make([]uint, 0, len(items))
+	for _, item := range items {
+		current = append(current, item.ID)
+	}
+	requested := slices.Clone(itemIDs)
+	slices.Sort(current)
+	slices.Sort(requested)
+	if !slices.Equal(current, requested) {
+		return nil, ErrInvalidChecklistOrder
+	}
+
+	if err := s.repo.Reorder(noteID, itemIDs); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByNote(noteID)
+}
+
+// note the user may edit, the trash is read-only
+func (s *checklistService) editableNote(userID, noteID uint) (*model.Note, error) {
+	note, err := s.notes.Authorize(userID, noteID, NoteActionEdit)
+	if err != nil {
+		return nil, err
+	}
+	if note.DeletedAt.Valid {
+		return nil, ErrNoteNotFound
+	}
+	return note, nil
+}
+
+// item of the note, items of other notes are reported as not found
+func (s *checklistService) loadItem(noteID, itemID uint) (*model.ChecklistItem, error) {
+	item, err := s.repo.FindByID(itemID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && item.NoteID != noteID) {
+		return nil, ErrChecklistItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// trims the text and checks its length
+func normalizeChecklistText(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" || utf8.RuneCountInString(text) > maxChecklistItemText {
+		return "", ErrInvalidChecklistItem
+	}
+	return text, nil
+}
@@ -0,0 +1,608 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/ot"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// errors returned while editing in a collaboration session
+var (
+	ErrCollabRevision  = errors.New("edit is based on an unknown revision")
+	ErrCollabOperation = errors.New("operation doesn't fit the document")
+	ErrCollabClosed    = errors.New("collaboration session is closed")
+)
+
+// kinds of messages sent to collaboration clients
+const (
+	// first message of a session with the document and everyone in the room
+	CollabMessageInit = "init"
+	// someone else's edit, to be applied on top of the previous revision
+	CollabMessageOp = "op"
+	// the session's own edit was applied as the given revision
+	CollabMessageAck   = "ack"
+	CollabMessageJoin  = "join"
+	CollabMessageLeave = "leave"
+	// cursor or selection of a participant moved
+	CollabMessageCursor = "cursor"
+	// merged content was written to the note, version is its new ETag
+	CollabMessageSaved = "saved"
+	// the room was shut down, e.g. because the note was deleted
+	CollabMessageClosed = "closed"
+)
+
+// how many edits a room remembers to transform late operations against
+const collabHistoryLimit = 1000
+
+// messages a session may have pending before it is disconnected
+const collabSendBuffer = 256
+
+// position of a participant's cursor, equal values mean no selection
+// positions count UTF-16 code units like the operations do
+type CollabCursor struct {
+	Position     int `json:"position"`
+	SelectionEnd int `json:"selection_end"`
+}
+
+// someone connected to a room, a user with two tabs open has two sessions
+type CollabParticipant struct {
+	SessionID uint64        `json:"session_id"`
+	UserID    uint          `json:"user_id"`
+	Username  string        `json:"username"`
+	CanEdit   bool          `json:"can_edit"`
+	Cursor    *CollabCursor `json:"cursor,omitempty"`
+}
+
+// everything sent to a collaboration client, only the fields of the type are set
+type CollabMessage struct {
+	Type         string              `json:"type"`
+	Rev          int                 `json:"rev"`
+	SessionID    uint64              `json:"session_id,omitempty"`
+	UserID       uint                `json:"user_id,omitempty"`
+	Op           *ot.Operation       `json:"op,omitempty"`
+	Content      *string             `json:"content,omitempty"`
+	Version      uint                `json:"version,omitempty"`
+	Cursor       *CollabCursor       `json:"cursor,omitempty"`
+	Participant  *CollabParticipant  `json:"participant,omitempty"`
+	Participants []CollabParticipant `json:"participants,omitempty"`
+	Error        string              `json:"error,omitempty"`
+}
+
+// live editing of note content by several users
+// edits are transformed against each other on the server and the merged content
+// is written to the note periodically and when the last participant leaves
+type CollabService interface {
+	// opens a session on the note, viewers can follow along but not edit
+	Join(userID, noteID uint) (*CollabSession, error)
+	// saves rooms with unsaved edits and picks up outside saves every interval, blocks forever
+	Run()
+	// checks the user's sessions on the note again after their share grant changed
+	Reauthorize(userID, noteID uint)
+}
+
+type collabService struct {
+	notes    NoteService
+	repo     repository.NoteRepository
+	users    repository.UserRepository
+	interval time.Duration
+
+	mu          sync.Mutex
+	rooms       map[uint]*collabRoom
+	nextSession uint64
+}
+
+// constructor returns a new collabService instance
+func NewCollabService(notes NoteService, repo repository.NoteRepository, users repository.UserRepository, interval time.Duration) CollabService {
+	return &collabService{
+		notes:    notes,
+		repo:     repo,
+		users:    users,
+		interval: interval,
+		rooms:    make(map[uint]*collabRoom),
+	}
+}
+
+// checks access, then adds a session to the note's room, opening the room if needed
+func (s *collabService) Join(userID, noteID uint) (*CollabSession, error) {
+	note, canEdit, err := s.access(userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	room := s.rooms[noteID]
+	if room == nil {
+		room = newCollabRoom(note)
+		s.rooms[noteID] = room
+	}
+	s.nextSession++
+	session := &CollabSession{
+		room:     room,
+		service:  s,
+		messages: make(chan CollabMessage, collabSendBuffer),
+		participant: CollabParticipant{
+			SessionID: s.nextSession,
+			UserID:    userID,
+			Username:  user.Username,
+			CanEdit:   canEdit,
+		},
+	}
+	room.add(session)
+	return session, nil
+}
+
+// sessions of a user who lost access are closed, editors who became viewers can't edit anymore
+// a failed check closes the sessions too, the client can join again
+func (s *collabService) Reauthorize(userID, noteID uint) {
+	s.mu.Lock()
+	room := s.rooms[noteID]
+	s.mu.Unlock()
+	if room == nil {
+		return
+	}
+
+	_, canEdit, err := s.access(userID, noteID)
+	if err != nil && !errors.Is(err, ErrNoteNotFound) {
+		log.Printf("Failed to check access of user %d to note %d: %v", userID, noteID, err)
+	}
+	room.reauthorize(userID, err == nil, canEdit)
+}
+
+// whether the user may follow the note's live edits and whether they may edit
+func (s *collabService) access(userID, noteID uint) (*model.Note, bool, error) {
+	note, err := s.notes.Authorize(userID, noteID, NoteActionView)
+	if err != nil {
+		return nil, false, err
+	}
+	if note.DeletedAt.Valid {
+		return nil, false, ErrNoteNotFound
+	}
+	_, err = s.notes.Authorize(userID, noteID, NoteActionEdit)
+	if err != nil && !errors.Is(err, ErrForbidden) {
+		return nil, false, err
+	}
+	return note, err == nil, nil
+}
+
+// periodic save, a failed room is retried on the next tick
+func (s *collabService) Run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.mu.Lock()
+		rooms := make([]*collabRoom, 0, len(s.rooms))
+		for _, room := range s.rooms {
+			rooms = append(rooms, room)
+		}
+		s.mu.Unlock()
+
+		for _, room := range rooms {
+			if err := s.persist(room); err != nil {
+				log.Printf("Failed to save collaborative edits of note %d: %v", room.noteID, err)
+			}
+		}
+	}
+}
+
+// called by the last session leaving, the room is saved before it's forgotten
+// so a new session can't load content that is about to be overwritten
+func (s *collabService) leave(room *collabRoom) {
+	if err := s.persist(room); err != nil {
+		log.Printf("Failed to save collaborative edits of note %d: %v", room.noteID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	if len(room.sessions) == 0 && s.rooms[room.noteID] == room {
+		delete(s.rooms, room.noteID)
+	}
+}
+
+// writes the room's content to the note, merging in changes made outside the room
+// the note is checked even without local edits, a room nobody types in still has to follow outside saves
+func (s *collabService) persist(room *collabRoom) error {
+	// a second save running at the same time would take the first one's write for an outside change
+	room.saveMu.Lock()
+	defer room.saveMu.Unlock()
+
+	for {
+		room.mu.Lock()
+		if room.closed {
+			room.mu.Unlock()
+			return nil
+		}
+		content, rev, version, editor := room.content, room.rev, room.version, room.editor
+		dirty := room.rev != room.savedRev
+		room.mu.Unlock()
+
+		note, err := s.repo.FindByID(room.noteID)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && note.DeletedAt.Valid) {
+			s.close(room, "note was deleted")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if note.Version == version {
+			if !dirty {
+				return nil
+			}
+			if note.Content == content {
+				room.saved(content, rev, note.Version)
+				return nil
+			}
+			note.Content = content
+			// recorded and published like any other edit, the revision goes to whoever edited last
+			err = s.notes.SaveContent(editor, note)
+			if err == nil {
+				room.saved(content, rev, note.Version)
+				return nil
+			}
+			if !errors.Is(err, repository.ErrVersionConflict) {
+				return err
+			}
+			// written in the meantime, load it again and merge
+			if note, err = s.repo.FindByID(room.noteID); err != nil {
+				return err
+			}
+		}
+
+		// someone saved the note outside the room, fold their change into the room and try again
+		if err := room.merge(note); err != nil {
+			return err
+		}
+	}
+}
+
+// shuts a room down, every session gets a closed message
+func (s *collabService) close(room *collabRoom, reason string) {
+	s.mu.Lock()
+	if s.rooms[room.noteID] == room {
+		delete(s.rooms, room.noteID)
+	}
+	s.mu.Unlock()
+
+	room.mu.Lock()
+	defer room.mu.Unlock()
+	room.closed = true
+	for session := range room.sessions {
+		session.send(CollabMessage{Type: CollabMessageClosed, Rev: room.rev, Error: reason})
+		session.close()
+	}
+	room.sessions = map[*CollabSession]struct{}{}
+}
+
+// one participant's connection to a room
+type CollabSession struct {
+	room        *collabRoom
+	service     *collabService
+	messages    chan CollabMessage
+	participant CollabParticipant
+	// set once the session left or was dropped, guarded by room.mu
+	closed bool
+}
+
+// messages for this session, closed when the session ends
+func (s *CollabSession) Messages() <-chan CollabMessage {
+	return s.messages
+}
+
+// Participant returns who this session belongs to.
+func (s *CollabSession) Participant() CollabParticipant {
+	s.room.mu.Lock()
+	defer s.room.mu.Unlock()
+	return s.participant
+}
+
+// applies an edit the client made on top of revision rev
+func (s *CollabSession) Edit(rev int, op *ot.Operation) error {
+	return s.room.edit(s, rev, op)
+}
+
+// shares the session's cursor with the room, positions are relative to revision rev
+func (s *CollabSession) MoveCursor(rev int, cursor CollabCursor) error {
+	return s.room.moveCursor(s, rev, cursor)
+}
+
+// ends the session, safe to call more than once
+func (s *CollabSession) Leave() {
+	if s.room.remove(s) {
+		s.service.leave(s.room)
+	}
+}
+
+// queues a message without blocking, a session that can't keep up is closed, room.mu must be held
+func (s *CollabSession) send(msg CollabMessage) {
+	if s.closed {
+		return
+	}
+	select {
+	case s.messages <- msg:
+	default:
+		s.room.drop(s)
+	}
+}
+
+// room.mu must be held, nothing is sent after this
+func (s *CollabSession) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.messages)
+}
+
+// shared state of everyone editing the same note
+type collabRoom struct {
+	noteID uint
+	saveMu sync.Mutex
+
+	mu       sync.Mutex
+	sessions map[*CollabSession]struct{}
+	closed   bool
+
+	content string
+	// number of edits applied since the room was opened
+	rev int
+	// the last edits, history[0] turned revision baseRev into baseRev+1
+	history []*ot.Operation
+	baseRev int
+
+	// last content known to be stored in the note and its version
+	savedContent string
+	version      uint
+	// revision that was saved, the room has unsaved edits when it differs from rev
+	savedRev int
+	// user of the latest edit, the author of the revision the next save records
+	editor uint
+}
+
+func newCollabRoom(note *model.Note) *collabRoom {
+	return &collabRoom{
+		noteID:       note.ID,
+		sessions:     make(map[*CollabSession]struct{}),
+		content:      note.Content,
+		savedContent: note.Content,
+		version:      note.Version,
+	}
+}
+
+// sends the new session the document and tells everyone else about it
+func (r *collabRoom) add(session *CollabSession) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	participants := make([]CollabParticipant, 0, len(r.sessions)+1)
+	for other := range r.sessions {
+		participants = append(participants, other.participant)
+		other.send(CollabMessage{Type: CollabMessageJoin, Rev: r.rev, Participant: &session.participant})
+	}
+	participants = append(participants, session.participant)
+
+	content := r.content
+	session.send(CollabMessage{
+		Type:         CollabMessageInit,
+		Rev:          r.rev,
+		SessionID:    session.participant.SessionID,
+		Content:      &content,
+		Version:      r.version,
+		Participants: participants,
+	})
+	r.sessions[session] = struct{}{}
+}
+
+// reports whether the room is empty afterwards, the session may already be gone if it fell behind
+func (r *collabRoom) remove(session *CollabSession) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.drop(session)
+	return len(r.sessions) == 0
+}
+
+// forgets a session and tells the others, r.mu must be held
+func (r *collabRoom) drop(session *CollabSession) {
+	if _, ok := r.sessions[session]; !ok {
+		return
+	}
+	delete(r.sessions, session)
+	session.close()
+	for other := range r.sessions {
+		other.send(CollabMessage{
+			Type:      CollabMessageLeave,
+			Rev:       r.rev,
+			SessionID: session.participant.SessionID,
+			UserID:    session.participant.UserID,
+		})
+	}
+}
+
+// transforms the operation against everything applied since rev, then applies and broadcasts it
+func (r *collabRoom) edit(session *CollabSession, rev int, op *ot.Operation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// a session dropped for falling behind or losing access may still be sending
+	if r.closed || session.closed {
+		return ErrCollabClosed
+	}
+	// checked under the lock, a share change may have taken it away since the last edit
+	if !session.participant.CanEdit {
+		return ErrForbidden
+	}
+	if rev < r.baseRev || rev > r.rev {
+		return ErrCollabRevision
+	}
+	for _, past := range r.history[rev-r.baseRev:] {
+		transformed, _, err := ot.Transform(op, past)
+		if err != nil {
+			return ErrCollabOperation
+		}
+		op = transformed
+	}
+
+	if err := r.apply(op); err != nil {
+		return err
+	}
+	r.editor = session.participant.UserID
+	session.send(CollabMessage{Type: CollabMessageAck, Rev: r.rev})
+	r.broadcast(session, CollabMessage{
+		Type:      CollabMessageOp,
+		Rev:       r.rev,
+		SessionID: session.participant.SessionID,
+		UserID:    session.participant.UserID,
+		Op:        op,
+	})
+	return nil
+}
+
+// applies a changed grant to every session of the user, the others learn about it like a rejoin
+func (r *collabRoom) reauthorize(userID uint, canView, canEdit bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for session := range r.sessions {
+		if session.participant.UserID != userID {
+			continue
+		}
+		if !canView {
+			session.participant.CanEdit = false
+			session.send(CollabMessage{Type: CollabMessageClosed, Rev: r.rev, Error: "access to the note was revoked"})
+			r.drop(session)
+			continue
+		}
+		if session.participant.CanEdit == canEdit {
+			continue
+		}
+		session.participant.CanEdit = canEdit
+		participant := session.participant
+		for other := range r.sessions {
+			other.send(CollabMessage{Type: CollabMessageJoin, Rev: r.rev, Participant: &participant})
+		}
+	}
+}
+
+// brings a cursor from revision rev to the current one and shares it
+func (r *collabRoom) moveCursor(session *CollabSession, rev int, cursor CollabCursor) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed || session.closed {
+		return ErrCollabClosed
+	}
+	if rev < r.baseRev || rev > r.rev {
+		return ErrCollabRevision
+	}
+	for _, past := range r.history[rev-r.baseRev:] {
+		cursor = transformCursor(past, cursor)
+	}
+
+	session.participant.Cursor = &cursor
+	r.broadcast(session, CollabMessage{
+		Type:      CollabMessageCursor,
+		Rev:       r.rev,
+		SessionID: session.participant.SessionID,
+		UserID:    session.participant.UserID,
+		Cursor:    &cursor,
+	})
+	return nil
+}
+
+// applies an operation at the current revision and moves every cursor with it, r.mu must be held
+func (r *collabRoom) apply(op *ot.Operation) error {
+	content, err := op.Apply(r.content)
+	if err != nil {
+		return ErrCollabOperation
+	}
+
+	r.content = content
+	r.rev++
+	r.history = append(r.history, op)
+	// old edits are only needed by clients that are far behind
+	if drop := len(r.history) - collabHistoryLimit; drop > 0 {
+		r.history = r.history[drop:]
+		r.baseRev += drop
+	}
+
+	for session := range r.sessions {
+		if session.participant.Cursor != nil {
+			cursor := transformCursor(op, *session.participant.Cursor)
+			session.participant.Cursor = &cursor
+		}
+	}
+	return nil
+}
+
+// sends a message to everyone but the given session, r.mu must be held
+func (r *collabRoom) broadcast(except *CollabSession, msg CollabMessage) {
+	for session := range r.sessions {
+		if session != except {
+			session.send(msg)
+		}
+	}
+}
+
+// records a successful save of content at revision rev
+func (r *collabRoom) saved(content string, rev int, version uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.savedContent = content
+	r.savedRev = rev
+	r.version = version
+	for session := range r.sessions {
+		session.send(CollabMessage{Type: CollabMessageSaved, Rev: rev, Version: version})
+	}
+}
+
+// folds a change saved outside the room (e.g. a PUT) into the room's content
+// both sides are diffed against the last saved content and transformed against each other,
+// the outside change is then broadcast like an edit of its own
+func (r *collabRoom) merge(note *model.Note) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outside := ot.Replace(r.savedContent, note.Content)
+	inside := ot.Replace(r.savedContent, r.content)
+	outside, _, err := ot.Transform(outside, inside)
+	if err != nil {
+		return err
+	}
+
+	if !outside.IsNoop() {
+		if err := r.apply(outside); err != nil {
+			return err
+		}
+		r.broadcast(nil, CollabMessage{Type: CollabMessageOp, Rev: r.rev, Op: outside})
+	}
+	// the note now holds the outside content, the merged content still has to be written
+	r.savedContent = note.Content
+	r.version = note.Version
+	r.savedRev = -1
+	return nil
+}
+
+// moves both ends of a cursor through an operation
+func transformCursor(op *ot.Operation, cursor CollabCursor) CollabCursor {
+	return CollabCursor{
+		Position:     op.TransformIndex(cursor.Position),
+		SelectionEnd: op.TransformIndex(cursor.SelectionEnd),
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/ot"
+	"github.com/dassajib/prohor-api/internal/repository"
+)
+
+// serves the stored note, only what persist reads
+type fakeCollabNoteRepo struct {
+	repository.NoteRepository
+	note model.Note
+}
+
+func (r *fakeCollabNoteRepo) FindByID(id uint) (*model.Note, error) {
+	note := r.note
+	return &note, nil
+}
+
+// stores saved content in the repo like the real service does
+type fakeCollabNoteService struct {
+	NoteService
+	repo  *fakeCollabNoteRepo
+	saves int
+}
+
+func (s *fakeCollabNoteService) SaveContent(authorID uint, note *model.Note) error {
+	if note.Version != s.repo.note.Version {
+		return repository.ErrVersionConflict
+	}
+	s.saves++
+	note.Version++
+	s.repo.note = *note
+	return nil
+}
+
+func newTestCollabService(note model.Note) (*collabService, *fakeCollabNoteRepo, *fakeCollabNoteService) {
+	repo := &fakeCollabNoteRepo{note: note}
+	notes := &fakeCollabNoteService{repo: repo}
+	return &collabService{notes: notes, repo: repo, rooms: make(map[uint]*collabRoom)}, repo, notes
+}
+
+// adds a session to the room like Join does, without access checks
+func joinTestRoom(room *collabRoom, userID uint, canEdit bool) *CollabSession {
+	session := &CollabSession{
+		room:     room,
+		messages: make(chan CollabMessage, collabSendBuffer),
+		participant: CollabParticipant{
+			SessionID: uint64(userID),
+			UserID:    userID,
+			CanEdit:   canEdit,
+		},
+	}
+	room.add(session)
+	return session
+}
+
+// appends text at the end of a document of the given length
+func appendOp(docLen int, text string) *ot.Operation {
+	return (&ot.Operation{}).Retain(docLen).Insert(text)
+}
+
+// a client that keeps sending without reading its acks is dropped, it must not bring the server down
+func TestCollabRoomDropsSessionThatStopsReading(t *testing.T) {
+	room := newCollabRoom(&model.Note{ID: 1, Version: 1})
+	flooder := joinTestRoom(room, 1, true)
+
+	var err error
+	for rev := 0; rev < collabSendBuffer*2; rev++ {
+		if err = flooder.Edit(rev, appendOp(rev, "x")); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrCollabClosed) {
+		t.Fatalf("edits after the send buffer filled returned %v, want ErrCollabClosed", err)
+	}
+	if err := flooder.MoveCursor(room.rev, CollabCursor{}); !errors.Is(err, ErrCollabClosed) {
+		t.Errorf("cursor move of a dropped session returned %v, want ErrCollabClosed", err)
+	}
+
+	// everything queued before the drop is still delivered, then the channel ends
+	received := 0
+	for range flooder.Messages() {
+		received++
+	}
+	if received != collabSendBuffer {
+		t.Errorf("received %d messages, want the %d that fit the buffer", received, collabSendBuffer)
+	}
+
+	// leaving after being dropped is fine too
+	if !room.remove(flooder) {
+		t.Error("room still has sessions after the only one was dropped")
+	}
+}
+
+// a client whose grant was revoked can't slip in an edit it already had in flight
+func TestCollabRoomEditAfterRevoke(t *testing.T) {
+	room := newCollabRoom(&model.Note{ID: 1, Content: "hi", Version: 1})
+	editor := joinTestRoom(room, 1, true)
+	owner := joinTestRoom(room, 2, true)
+
+	room.reauthorize(1, false, false)
+
+	if err := editor.Edit(0, appendOp(2, "!")); !errors.Is(err, ErrCollabClosed) {
+		t.Fatalf("edit after revoke returned %v, want ErrCollabClosed", err)
+	}
+	if room.content != "hi" || room.rev != 0 {
+		t.Errorf("room content = %q at rev %d, the revoked edit must not be applied", room.content, room.rev)
+	}
+	if editor.participant.CanEdit {
+		t.Error("revoked session can still edit")
+	}
+
+	var last CollabMessage
+	for msg := range editor.Messages() {
+		last = msg
+	}
+	if last.Type != CollabMessageClosed {
+		t.Errorf("last message to the revoked session = %q, want %q", last.Type, CollabMessageClosed)
+	}
+
+	// the owner's session is untouched
+	if err := owner.Edit(0, appendOp(2, "!")); err != nil {
+		t.Errorf("edit of the remaining session: %v", err)
+	}
+}
+
+func TestCollabRoomEditAfterDowngrade(t *testing.T) {
+	room := newCollabRoom(&model.Note{ID: 1, Content: "hi", Version: 1})
+	editor := joinTestRoom(room, 1, true)
+
+	room.reauthorize(1, true, false)
+
+	if err := editor.Edit(0, appendOp(2, "!")); !errors.Is(err, ErrForbidden) {
+		t.Errorf("edit after becoming a viewer returned %v, want ErrForbidden", err)
+	}
+	if err := editor.MoveCursor(0, CollabCursor{Position: 1, SelectionEnd: 1}); err != nil {
+		t.Errorf("viewers can still share their cursor: %v", err)
+	}
+}
+
+// a room nobody typed in still follows saves made outside of it
+func TestCollabPersistPicksUpOutsideSaveWithoutEdits(t *testing.T) {
+	svc, repo, notes := newTestCollabService(model.Note{ID: 1, Content: "hello", Version: 1})
+	room := newCollabRoom(&repo.note)
+	viewer := joinTestRoom(room, 1, false)
+	<-viewer.Messages() // init
+
+	if err := svc.persist(room); err != nil {
+		t.Fatalf("persist of an unchanged room: %v", err)
+	}
+	if notes.saves != 0 {
+		t.Errorf("unchanged room was saved %d times, want 0", notes.saves)
+	}
+
+	repo.note.Content, repo.note.Version = "hello world", 2
+	if err := svc.persist(room); err != nil {
+		t.Fatalf("persist after an outside save: %v", err)
+	}
+	if room.content != "hello world" || room.version != 2 {
+		t.Errorf("room = %q at version %d, want %q at version 2", room.content, room.version, "hello world")
+	}
+	if notes.saves != 0 {
+		t.Errorf("room wrote the note back %d times, it had nothing of its own to add", notes.saves)
+	}
+
+	var op, saved *CollabMessage
+	for len(viewer.Messages()) > 0 {
+		msg := <-viewer.Messages()
+		switch msg.Type {
+		case CollabMessageOp:
+			op = &msg
+		case CollabMessageSaved:
+			saved = &msg
+		}
+	}
+	if op == nil {
+		t.Fatal("the outside change was not sent to the room")
+	}
+	if got, _ := op.Op.Apply("hello"); got != "hello world" {
+		t.Errorf("outside change turns the document into %q, want %q", got, "hello world")
+	}
+	if saved == nil || saved.Version != 2 {
+		t.Errorf("saved message = %+v, want one with version 2", saved)
+	}
+}
+
+func TestCollabPersistMergesOutsideSaveWithEdits(t *testing.T) {
+	svc, repo, notes := newTestCollabService(model.Note{ID: 1, Content: "hello", Version: 1})
+	room := newCollabRoom(&repo.note)
+	editor := joinTestRoom(room, 1, true)
+
+	if err := editor.Edit(0, (&ot.Operation{}).Insert(">> ").Retain(5)); err != nil {
+		t.Fatalf("edit: %v", err)
+	}
+	repo.note.Content, repo.note.Version = "hello world", 2
+
+	if err := svc.persist(room); err != nil {
+		t.Fatalf("persist: %v", err)
+	}
+	if want := ">> hello world"; room.content != want || repo.note.Content != want {
+		t.Errorf("room = %q, note = %q, want both %q", room.content, repo.note.Content, want)
+	}
+	if notes.saves != 1 || room.version != repo.note.Version {
+		t.Errorf("saves = %d, room version %d, note version %d, want one save and matching versions", notes.saves, room.version, repo.note.Version)
+	}
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/enex"
+	"github.com/dassajib/prohor-api/internal/pkg/frontmatter"
+	"github.com/dassajib/prohor-api/internal/pkg/keep"
+	"github.com/dassajib/prohor-api/internal/repository"
+)
+
+// errors returned by the export service
+var (
+	ErrInvalidArchive  = errors.New("file is not a valid zip archive")
+	ErrTooManyFiles    = errors.New("archive can't have more than 10000 files")
+	ErrImportFileSize  = errors.New("file is larger than 10 MB")
+	ErrImportNotMD     = errors.New("not a markdown file")
+	ErrImportTitleSize = errors.New("title can't be longer than 255 characters")
+	ErrFrontMatter     = errors.New("invalid front matter")
+)
+
+// limits of an import
+const (
+	maxImportFiles    = 10000
+	maxImportFileSize = 10 << 20
+	maxNoteTitle      = 255
+)
+
+// longest file name of an exported note, without the extension
+const maxExportFileName = 100
+
+// defines what the export service must provide
+type ExportService interface {
+	// writes a zip of the user's notes, one markdown file with front matter per note
+	Export(userID uint, w io.Writer) error
+	// creates a note for every markdown file in the zip, a file that fails doesn't stop the others
+	Import(userID uint, r io.ReaderAt, size int64) (*ImportReport, error)
+}
+
+// outcome of an import, one result per file in archive order
+type ImportReport struct {
+	Imported int
+	Failed   int
+	Files    []ImportResult
+}
+
+// NoteID is set when the file became a note, Error when it didn't
+type ImportResult struct {
+	File   string
+	NoteID uint
+	Error  string
+}
+
+// front matter of an exported note
+// "tag" is the old single-tag field and still accepted on import
+type noteFrontMatter struct {
+	Title   string     `yaml:"title"`
+	Tags    []string   `yaml:"tags,omitempty"`
+	Tag     string     `yaml:"tag,omitempty"`
+	Pinned  bool       `yaml:"pinned,omitempty"`
+	Format  string     `yaml:"format,omitempty"`
+	Date    *time.Time `yaml:"date,omitempty"`
+	Created *time.Time `yaml:"created,omitempty"`
+	Updated *time.Time `yaml:"updated,omitempty"`
+}
+
+type exportService struct {
+	notes NoteService
+}
+
+// constructor returns a new exportService instance
+func NewExportService(notes NoteService) ExportService {
+	return &exportService{notes}
+}
+
+// archived notes are part of the export, the trash is not
+// the zip is written while pages are read, so a failure leaves it incomplete
+func (s *exportService) Export(userID uint, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	names := map[string]bool{}
+
+	opts := repository.NoteListOptions{
+		Limit:    repository.MaxNoteLimit,
+		Sort:     "created",
+		Deleted:  repository.DeletedExclude,
+		Archived: repository.ArchivedInclude,
+	}
+	for {
+		page, err := s.notes.GetUserNotes(userID, opts)
+		if err != nil {
+			return err
+		}
+		for i := range page.Notes {
+			if err := writeNoteFile(archive, &page.Notes[i], names); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+	return archive.Close()
+}
+
+// notes go through NoteService.Create, so tags, links and validation work as for any new note
+func (s *exportService) Import(userID uint, r io.ReaderAt, size int64) (*ImportReport, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	if len(archive.File) > maxImportFiles {
+		return nil, ErrTooManyFiles
+	}
+
+	report := &ImportReport{Files: []ImportResult{}}
+	for _, file := range archive.File {
+		if skipArchiveEntry(file.Name) {
+			continue
+		}
+
+		result := ImportResult{File: file.Name}
+		note, err := readNoteFile(file)
+		if err == nil {
+			err = s.notes.Create(userID, note)
+		}
+		if err != nil {
+			result.Error = importErrorMessage(err)
+			report.Failed++
+		} else {
+			result.NoteID = note.ID
+			report.Imported++
+		}
+		report.Files = append(report.Files, result)
+	}
+	return report, nil
+}
+
+// one note as <title>.md, names that are taken get " (2)", " (3)" and so on
+func writeNoteFile(archive *zip.Writer, note *model.Note, names map[string]bool) error {
+	meta := noteFrontMatter{
+		Title:   note.Title,
+		Pinned:  note.Pinned,
+		Format:  note.Format,
+		Created: &note.CreatedAt,
+		Updated: &note.UpdatedAt,
+	}
+	for _, tag := range note.Tags {
+		meta.Tags = append(meta.Tags, tag.Name)
+	}
+	if !note.Date.IsZero() {
+		meta.Date = &note.Date
+	}
+	data, err := frontmatter.Marshal(meta, note.Content)
+	if err != nil {
+		return err
+	}
+
+	base := exportFileName(note.Title)
+	name := base + ".md"
+	for i := 2; names[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("%s (%d).md", base, i)
+	}
+	names[strings.ToLower(name)] = true
+
+	f, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: note.UpdatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// turns a markdown file into a note, the title falls back to the file name
+func readNoteFile(file *zip.File) (*model.Note, error) {
+	if !strings.EqualFold(path.Ext(file.Name), ".md") {
+		return nil, ErrImportNotMD
+	}
+	if file.UncompressedSize64 > maxImportFileSize {
+		return nil, ErrImportFileSize
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	// the size in the header can lie
+	data, err := io.ReadAll(io.LimitReader(rc, maxImportFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportFileSize {
+		return nil, ErrImportFileSize
+	}
+
+	var meta noteFrontMatter
+	body, err := frontmatter.Unmarshal(data, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFrontMatter, err)
+	}
+
+	title := strings.TrimSpace(meta.Title)
+	if title == "" {
+		title = strings.TrimSuffix(path.Base(file.Name), path.Ext(file.Name))
+	}
+	if utf8.RuneCountInString(title) > maxNoteTitle {
+		return nil, ErrImportTitleSize
+	}
+
+	note := &model.Note{
+		Title:   title,
+		Content: body,
+		Pinned:  meta.Pinned,
+		// files without a format come from other markdown tools
+		Format: model.NoteFormatMarkdown,
+		Date:   time.Now(),
+	}
+	if meta.Format != "" {
+		note.Format = meta.Format
+	}
+	if meta.Date != nil {
+		note.Date = *meta.Date
+	}
+	// keeps the original times, zero ones are filled in on insert
+	if meta.Created != nil {
+		note.CreatedAt = *meta.Created
+	}
+	if meta.Updated != nil {
+		note.UpdatedAt = *meta.Updated
+	}
+	names := meta.Tags
+	if meta.Tag != "" {
+		names = append(names, meta.Tag)
+	}
+	for _, name := range names {
+		note.Tags = append(note.Tags, model.Tag{Name: name})
+	}
+	return note, nil
+}
+
+// folders, hidden files and the resource forks macOS adds to zips aren't notes
+func skipArchiveEntry(name string) bool {
+	if strings.HasSuffix(name, "/") || strings.HasPrefix(name, "__MACOSX/") {
+		return true
+	}
+	return strings.HasPrefix(path.Base(name), ".")
+}
+
+// title made safe for a file name on any system
+func exportFileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, title)
+	name = strings.Trim(name, " .")
+	if utf8.RuneCountInString(name) > maxExportFileName {
+		name = strings.TrimRight(string([]rune(name)[:maxExportFileName]), " .")
+	}
+	if name == "" {
+		return "untitled"
+	}
+	return name
+}
+
+// validation errors are shown as they are, anything else only in the log
+func importErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrImportNotMD), errors.Is(err, ErrImportFileSize), errors.Is(err, ErrImportTitleSize),
+		errors.Is(err, ErrFrontMatter), errors.Is(err, ErrInvalidTagName), errors.Is(err, ErrInvalidNoteFormat),
+		errors.Is(err, enex.ErrInvalidNote), errors.Is(err, keep.ErrInvalid):
+		return err.Error()
+	default:
+		log.Printf("Failed to import note: %v", err)
+		return "could not import file"
+	}
+}
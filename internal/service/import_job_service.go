@@ -0,0 +1,475 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/enex"
+	"github.com/dassajib/prohor-api/internal/pkg/keep"
+	"github.com/dassajib/prohor-api/internal/pkg/storage"
+	"github.com/dassajib/prohor-api/internal/pkg/utils"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// errors returned by the import job service
+var (
+	ErrImportJobNotFound = errors.New("import job not found")
+	ErrImportSource      = errors.New("source must be enex or keep")
+	ErrImportEmpty       = errors.New("import file is empty")
+	ErrImportInterrupted = errors.New("import was interrupted, notes imported so far were kept")
+)
+
+const (
+	// jobs listed per user
+	importJobListLimit = 50
+	// failures kept per job, the count covers all of them
+	maxImportFailures = 100
+	// progress is saved after this many notes
+	importProgressInterval = 25
+	// a running job whose progress didn't move for this long was cut off by a restart
+	importJobStaleAfter = 10 * time.Minute
+	// how often the worker looks for queued jobs when nobody wakes it up
+	importPollInterval = time.Minute
+	// titles taken from the first line of a note are cut at this length
+	maxDerivedTitle = 80
+)
+
+// title of imported notes that have neither a title nor any text
+const untitledNote = "Untitled"
+
+// defines what the import job service must provide
+// imports from other apps run in the background, clients poll the job for progress
+type ImportJobService interface {
+	// stores the uploaded file and queues a job importing it into the user's notes
+	Start(ctx context.Context, userID uint, source, fileName string, r io.Reader, size int64) (*model.ImportJob, error)
+	Get(userID, id uint) (*model.ImportJob, error)
+	// latest jobs of the user first
+	List(userID uint) ([]model.ImportJob, error)
+	// works through queued jobs one at a time, never returns
+	Run()
+}
+
+type importJobService struct {
+	repo    repository.ImportJobRepository
+	storage storage.Storage
+	notes   NoteService
+	// Start nudges the worker so a new job doesn't wait for the next poll
+	wake chan struct{}
+}
+
+// constructor returns a new importJobService instance
+func NewImportJobService(repo repository.ImportJobRepository, storage storage.Storage, notes NoteService) ImportJobService {
+	return &importJobService{repo: repo, storage: storage, notes: notes, wake: make(chan struct{}, 1)}
+}
+
+// the file is kept in storage so a queued job survives a restart
+func (s *importJobService) Start(ctx context.Context, userID uint, source, fileName string, r io.Reader, size int64) (*model.ImportJob, error) {
+	if source != model.ImportSourceEnex && source != model.ImportSourceKeep {
+		return nil, ErrImportSource
+	}
+	if size <= 0 {
+		return nil, ErrImportEmpty
+	}
+
+	id, err := utils.NewTokenID()
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("imports/%d/%s", userID, id)
+	if err := s.storage.Put(ctx, key, r, size, "application/octet-stream"); err != nil {
+		return nil, err
+	}
+
+	job := &model.ImportJob{
+		UserID:     userID,
+		Source:     source,
+		FileName:   cleanFileName(fileName),
+		Status:     model.ImportStatusQueued,
+		StorageKey: key,
+	}
+	if err := s.repo.Create(job); err != nil {
+		if err := s.storage.Delete(ctx, key); err != nil {
+			log.Printf("Failed to delete import file %s: %v", key, err)
+		}
+		return nil, err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// jobs of other users look like missing ones
+func (s *importJobService) Get(userID, id uint) (*model.ImportJob, error) {
+	job, err := s.repo.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrImportJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, ErrImportJobNotFound
+	}
+	return job, nil
+}
+
+func (s *importJobService) List(userID uint) ([]model.ImportJob, error) {
+	return s.repo.FindByUser(userID, importJobListLimit)
+}
+
+// a failed round is only logged, the next wake up or poll tries again
+func (s *importJobService) Run() {
+	ticker := time.NewTicker(importPollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.failStaleJobs()
+		s.runQueued()
+
+		select {
+		case <-s.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// jobs stop moving when the server stops, they can't be resumed without importing notes twice
+func (s *importJobService) failStaleJobs() {
+	jobs, err := s.repo.FindByStatus(model.ImportStatusRunning)
+	if err != nil {
+		log.Printf("Failed to load running import jobs: %v", err)
+		return
+	}
+	for i := range jobs {
+		if time.Since(jobs[i].UpdatedAt) > importJobStaleAfter {
+			s.finish(&jobs[i], ErrImportInterrupted)
+		}
+	}
+}
+
+func (s *importJobService) runQueued() {
+	jobs, err := s.repo.FindByStatus(model.ImportStatusQueued)
+	if err != nil {
+		log.Printf("Failed to load queued import jobs: %v", err)
+		return
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		claimed, err := s.repo.Claim(job)
+		if err != nil {
+			log.Printf("Failed to start import job %d: %v", job.ID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		s.finish(job, s.run(job))
+	}
+}
+
+// imports the job's file, notes saved before an error stay imported
+func (s *importJobService) run(job *model.ImportJob) error {
+	file, err := s.download(job.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		file.Close()
+		os.Remove(file.Name())
+	}()
+
+	switch job.Source {
+	case model.ImportSourceEnex:
+		return s.importEnex(job, file)
+	case model.ImportSourceKeep:
+		return s.importKeep(job, file)
+	}
+	return ErrImportSource
+}
+
+// both formats need to be read twice, first to count and then to import
+func (s *importJobService) download(key string) (*os.File, error) {
+	rc, err := s.storage.Get(context.Background(), key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	file, err := os.CreateTemp("", "prohor-import-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, rc); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// notes in an export are decoded one at a time
+func (s *importJobService) importEnex(job *model.ImportJob, file *os.File) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	total, err := enex.Count(file)
+	if err != nil {
+		return err
+	}
+	job.Total = total
+	s.saveProgress(job)
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader := enex.NewReader(file)
+	for n := 1; ; n++ {
+		exported, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, enex.ErrInvalidNote) {
+			s.record(job, fmt.Sprintf("note %d", n), err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		note, trashed := noteFromEnex(exported)
+		s.record(job, note.Title, s.save(job.UserID, note, trashed))
+	}
+}
+
+// every note is a JSON file somewhere in the Takeout zip, the rest of the archive is ignored
+func (s *importJobService) importKeep(job *model.ImportJob, file *os.File) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	archive, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return ErrInvalidArchive
+	}
+
+	var entries []*zip.File
+	for _, entry := range archive.File {
+		if !skipArchiveEntry(entry.Name) && strings.EqualFold(path.Ext(entry.Name), ".json") {
+			entries = append(entries, entry)
+		}
+	}
+	job.Total = len(entries)
+	s.saveProgress(job)
+
+	for _, entry := range entries {
+		kept, err := readKeepNote(entry)
+		if err != nil {
+			s.record(job, entry.Name, err)
+			continue
+		}
+		note, trashed := noteFromKeep(kept)
+		s.record(job, entry.Name, s.save(job.UserID, note, trashed))
+	}
+	return nil
+}
+
+// goes through NoteService like any new note, notes that were in the trash go back there
+func (s *importJobService) save(userID uint, note *model.Note, trashed bool) error {
+	if err := s.notes.Create(userID, note); err != nil {
+		return err
+	}
+	if trashed {
+		return s.notes.Delete(userID, note.ID)
+	}
+	return nil
+}
+
+// counts the outcome of one note and saves progress every few notes
+func (s *importJobService) record(job *model.ImportJob, item string, err error) {
+	job.Processed++
+	if err != nil {
+		job.Failed++
+		if len(job.Failures) < maxImportFailures {
+			job.Failures = append(job.Failures, model.ImportFailure{Item: item, Error: importErrorMessage(err)})
+		}
+	} else {
+		job.Imported++
+	}
+	if job.Processed%importProgressInterval == 0 {
+		s.saveProgress(job)
+	}
+}
+
+// progress is informational, a failed save doesn't stop the import
+func (s *importJobService) saveProgress(job *model.ImportJob) {
+	if err := s.repo.Update(job); err != nil {
+		log.Printf("Failed to save progress of import job %d: %v", job.ID, err)
+	}
+}
+
+// marks the job done or failed and removes its file
+func (s *importJobService) finish(job *model.ImportJob, err error) {
+	now := time.Now()
+	job.FinishedAt = &now
+	job.Status = model.ImportStatusDone
+	if err != nil {
+		job.Status = model.ImportStatusFailed
+		job.Error = importJobErrorMessage(err)
+	}
+
+	if job.StorageKey != "" {
+		if err := s.storage.Delete(context.Background(), job.StorageKey); err != nil {
+			log.Printf("Failed to delete import file %s: %v", job.StorageKey, err)
+		} else {
+			job.StorageKey = ""
+		}
+	}
+	if err := s.repo.Update(job); err != nil {
+		log.Printf("Failed to finish import job %d: %v", job.ID, err)
+	}
+}
+
+// a file that can't be read is the user's to fix, anything else only goes to the log
+func importJobErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, enex.ErrInvalid), errors.Is(err, ErrInvalidArchive):
+		return "file could not be read: " + err.Error()
+	case errors.Is(err, ErrImportInterrupted):
+		return err.Error()
+	default:
+		log.Printf("Import job failed: %v", err)
+		return "import failed"
+	}
+}
+
+// ENEX bodies become markdown, Evernote has no pinning or archive
+func noteFromEnex(exported *enex.Note) (*model.Note, bool) {
+	content := enex.Markdown(exported.Content)
+	note := &model.Note{
+		Title:     importTitle(exported.Title, content),
+		Content:   content,
+		Format:    model.NoteFormatMarkdown,
+		CreatedAt: exported.Created,
+		UpdatedAt: exported.Updated,
+		Date:      exported.Created,
+	}
+	if note.Date.IsZero() {
+		note.Date = time.Now()
+	}
+	for _, name := range exported.Tags {
+		note.Tags = append(note.Tags, model.Tag{Name: name})
+	}
+	// reminders in the past already went off in Evernote
+	if exported.ReminderTime != nil && exported.ReminderTime.After(time.Now()) {
+		note.RemindAt = exported.ReminderTime
+	}
+	return note, exported.Deleted != nil
+}
+
+// Keep text is plain, checklist notes become a checklist
+func noteFromKeep(kept *keep.Note) (*model.Note, bool) {
+	note := &model.Note{
+		Title:     importTitle(kept.Title, kept.TextContent),
+		Content:   kept.TextContent,
+		Format:    model.NoteFormatPlain,
+		Pinned:    kept.IsPinned,
+		CreatedAt: kept.Created(),
+		UpdatedAt: kept.Updated(),
+		Date:      kept.Created(),
+	}
+	if note.Date.IsZero() {
+		note.Date = time.Now()
+	}
+	if kept.IsArchived {
+		// Keep doesn't say when, the last edit is the closest guess
+		archivedAt := time.Now()
+		if !note.UpdatedAt.IsZero() {
+			archivedAt = note.UpdatedAt
+		}
+		note.ArchivedAt = &archivedAt
+	}
+	for _, name := range kept.LabelNames() {
+		note.Tags = append(note.Tags, model.Tag{Name: name})
+	}
+
+	// items are inserted with the note, so the progress counts are set here instead of by the checklist repository
+	for _, item := range kept.ListContent {
+		text := strings.TrimSpace(item.Text)
+		if text == "" || len(note.ChecklistItems) == maxChecklistItems {
+			continue
+		}
+		if utf8.RuneCountInString(text) > maxChecklistItemText {
+			text = string([]rune(text)[:maxChecklistItemText])
+		}
+		note.ChecklistItems = append(note.ChecklistItems, model.ChecklistItem{
+			Text:     text,
+			Checked:  item.IsChecked,
+			Position: len(note.ChecklistItems),
+		})
+		note.ChecklistTotal++
+		if item.IsChecked {
+			note.ChecklistDone++
+		}
+	}
+	if note.Title == untitledNote && len(note.ChecklistItems) > 0 {
+		note.Title = importTitle("", note.ChecklistItems[0].Text)
+	}
+	return note, kept.IsTrashed
+}
+
+// reads one JSON file of a Takeout archive
+func readKeepNote(entry *zip.File) (*keep.Note, error) {
+	if entry.UncompressedSize64 > maxImportFileSize {
+		return nil, ErrImportFileSize
+	}
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxImportFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportFileSize {
+		return nil, ErrImportFileSize
+	}
+	return keep.Parse(data)
+}
+
+// other apps allow notes without a title, those get the first line of their text
+func importTitle(title, body string) string {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		for _, line := range strings.Split(body, "\n") {
+			if line = strings.TrimSpace(strings.TrimLeft(line, "#-*> ")); line != "" {
+				title = line
+				if utf8.RuneCountInString(title) > maxDerivedTitle {
+					title = strings.TrimSpace(string([]rune(title)[:maxDerivedTitle])) + "…"
+				}
+				break
+			}
+		}
+	}
+	if title == "" {
+		return untitledNote
+	}
+	if utf8.RuneCountInString(title) > maxNoteTitle {
+		title = string([]rune(title)[:maxNoteTitle])
+	}
+	return title
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+)
+
+// kinds of note events
+const (
+	NoteEventCreated = "note.created"
+	NoteEventUpdated = "note.updated"
+	NoteEventPinned  = "note.pinned"
+	// archived and unarchived notes carry the note, ArchivedAt tells which
+	NoteEventArchived = "note.archived"
+	NoteEventDeleted  = "note.deleted"
+	NoteEventRestored = "note.restored"
+	// removed from the trash for good
+	NoteEventPurged = "note.purged"
+)
+
+// something that happened to a note, Note is nil for purged notes
+type NoteEvent struct {
+	ID      uint64      `json:"id"`
+	Type    string      `json:"type"`
+	NoteID  uint        `json:"note_id"`
+	Version uint        `json:"version"`
+	Note    *model.Note `json:"note,omitempty"`
+	At      time.Time   `json:"at"`
+}
+
+// in-process fan-out of note events to the users they concern
+// events are not stored, a client that reconnects should reload what it shows
+type NoteEventBus interface {
+	// delivers the event to every subscription of the given users
+	Publish(event NoteEvent, userIDs []uint)
+	// the channel is closed when unsubscribe is called or the subscriber fell too far behind
+	Subscribe(userID uint) (events <-chan NoteEvent, unsubscribe func())
+}
+
+// events a subscriber may have pending before it is dropped
+const noteEventBuffer = 64
+
+type noteEventBus struct {
+	mu     sync.Mutex
+	nextID uint64
+	subs   map[uint]map[chan NoteEvent]struct{}
+}
+
+// constructor returns an empty event bus
+func NewNoteEventBus() NoteEventBus {
+	return &noteEventBus{subs: make(map[uint]map[chan NoteEvent]struct{})}
+}
+
+// never blocks, a subscriber whose buffer is full is disconnected instead
+func (b *noteEventBus) Publish(event NoteEvent, userIDs []uint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event.ID = b.nextID
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	for _, userID := range userIDs {
+		for ch := range b.subs[userID] {
+			select {
+			case ch <- event:
+			default:
+				b.remove(userID, ch)
+			}
+		}
+	}
+}
+
+// registers a new subscription of the user
+func (b *noteEventBus) Subscribe(userID uint) (<-chan NoteEvent, func()) {
+	ch := make(chan NoteEvent, noteEventBuffer)
+
+	b.mu.Lock()
+	if b.subs[userID] == nil {
+		b.subs[userID] = make(map[chan NoteEvent]struct{})
+	}
+	b.subs[userID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	unsubscribe := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(userID, ch)
+	}
+	return ch, unsubscribe
+}
+
+// closes and forgets a subscription, safe to call twice, b.mu must be held
+func (b *noteEventBus) remove(userID uint, ch chan NoteEvent) {
+	if _, ok := b.subs[userID][ch]; !ok {
+		return
+	}
+	delete(b.subs[userID], ch)
+	if len(b.subs[userID]) == 0 {
+		delete(b.subs, userID)
+	}
+	close(ch)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/wikilink"
+	"github.com/dassajib/prohor-api/internal/repository"
+)
+
+// links of a note past this many are ignored
+const maxLinksPerNote = 500
+
+// how often a rename retries rewriting a linking note that keeps changing under it
+const retitleAttempts = 3
+
+// defines what the note link service must provide
+type NoteLinkService interface {
+	// notes linking to the note that the user can see
+	Backlinks(userID, noteID uint) ([]model.Note, error)
+	// the user's own notes and the links between them
+	Graph(userID uint) (*repository.NoteGraph, error)
+}
+
+type noteLinkService struct {
+	repo  repository.NoteLinkRepository
+	notes NoteService
+}
+
+// constructor returns a new noteLinkService instance
+func NewNoteLinkService(repo repository.NoteLinkRepository, notes NoteService) NoteLinkService {
+	return &noteLinkService{repo, notes}
+}
+
+// anyone who may view the note sees its backlinks, filtered to the notes they may view
+func (s *noteLinkService) Backlinks(userID, noteID uint) ([]model.Note, error) {
+	if _, err := s.notes.Authorize(userID, noteID, NoteActionView); err != nil {
+		return nil, err
+	}
+	return s.repo.FindBacklinks(noteID, userID)
+}
+
+// shared notes aren't part of it, links never leave their owner's notes
+func (s *noteLinkService) Graph(userID uint) (*repository.NoteGraph, error) {
+	return s.repo.Graph(userID)
+}
+
+// parses the content and stores its links, called after every write of the content
+// goes through the given repository so it can be part of the note's transaction
+func syncLinks(links repository.NoteLinkRepository, note *model.Note) error {
+	refs := wikilink.Parse(note.Content)
+	if len(refs) > maxLinksPerNote {
+		refs = refs[:maxLinksPerNote]
+	}
+
+	var titles []string
+	var ids []uint
+	for _, ref := range refs {
+		if ref.ID != 0 {
+			ids = append(ids, ref.ID)
+		} else {
+			titles = append(titles, ref.Title)
+		}
+	}
+	return links.ReplaceForSource(note, titles, ids)
+}
+
+// rewrites [[Old Title]] to the note's new title in every note linking to it by title
+// the rename itself is already saved, so a note that can't be rewritten is only logged
+func (s *noteService) retitleLinks(note *model.Note) {
+	links, err := s.links.FindTitleLinksTo(note.ID)
+	if err != nil {
+		log.Printf("Failed to load links to note %d: %v", note.ID, err)
+		return
+	}
+	for _, link := range links {
+		if strings.EqualFold(link.TargetTitle, note.Title) {
+			continue
+		}
+		if err := s.retitleLink(link, note.Title); err != nil {
+			log.Printf("Failed to update links in note %d after renaming note %d: %v", link.SourceID, note.ID, err)
+		}
+	}
+}
+
+// saves one linking note with the new title, loading it again when it was written in the meantime
+// links never leave their owner's notes, so the rewrite is recorded as the owner's own revision
+// even when a collaborator renamed the target
+func (s *noteService) retitleLink(link model.NoteLink, title string) error {
+	for attempt := 1; ; attempt++ {
+		source, err := s.repo.FindByID(link.SourceID)
+		if err != nil {
+			return err
+		}
+		content := wikilink.ReplaceTitle(source.Content, link.TargetTitle, title)
+		if content == source.Content {
+			return nil
+		}
+
+		source.Content = content
+		err = s.SaveContent(source.UserID, source)
+		if errors.Is(err, repository.ErrVersionConflict) && attempt < retitleAttempts {
+			continue
+		}
+		return err
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// errors returned by every note operation, handler maps them to 404 and 403
+var (
+	ErrNoteNotFound = errors.New("note not found")
+	ErrForbidden    = errors.New("unauthorized access")
+)
+
+// returned for a content format other than plain or markdown
+var ErrInvalidNoteFormat = errors.New("format must be plain or markdown")
+
+// returned when the caller's version of a note is outdated, handler answers 412
+var ErrVersionConflict = repository.ErrVersionConflict
+
+// passed instead of a version to skip the check, for If-Match: *
+const AnyVersion uint = 0
+
+// fails with ErrVersionConflict unless the caller's version is the note's current one or AnyVersion
+func checkVersion(note *model.Note, version uint) error {
+	if version != AnyVersion && note.Version != version {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// errors returned when restoring from the trash
+var (
+	ErrNoteNotInTrash = errors.New("note is not in trash")
+	ErrRestoreExpired = errors.New("note was deleted too long ago to be restored")
+)
+
+// what the acting user wants to do with a note
+type NoteAction int
+
+const (
+	NoteActionView NoteAction = iota
+	NoteActionEdit
+	// soft delete, restore and permanent delete
+	NoteActionDelete
+	// filing the note in a notebook and managing who it's shared with
+	NoteActionManage
+)
+
+// single place that decides who may do what with a note
+// a note the user can't even see is reported as not found so ids don't leak,
+// a note they can see but not change is reported as forbidden
+type NotePolicy interface {
+	Authorize(userID uint, note *model.Note, action NoteAction) error
+}
+
+// the owner can do everything, other users get what their share grant allows:
+// viewers can view, editors can also edit, owner grants can do everything
+type notePolicy struct {
+	shares repository.NoteShareRepository
+}
+
+// constructor returns the default note policy
+func NewNotePolicy(shares repository.NoteShareRepository) NotePolicy {
+	return &notePolicy{shares}
+}
+
+func (p *notePolicy) Authorize(userID uint, note *model.Note, action NoteAction) error {
+	if note.UserID == userID {
+		return nil
+	}
+
+	share, err := p.shares.FindByNoteAndUser(note.ID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNoteNotFound
+	}
+	if err != nil {
+		return err
+	}
+	// the owner's trash is only visible to those who could restore from it
+	if note.DeletedAt.Valid && share.Role != model.ShareRoleOwner {
+		return ErrNoteNotFound
+	}
+
+	if !shareRoleAllows(share.Role, action) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// what each share role may do
+func shareRoleAllows(role string, action NoteAction) bool {
+	switch role {
+	case model.ShareRoleOwner:
+		return true
+	case model.ShareRoleEditor:
+		return action == NoteActionView || action == NoteActionEdit
+	case model.ShareRoleViewer:
+		return action == NoteActionView
+	default:
+		return false
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/diff"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// returned when a note has no revision with the requested number
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// differences between two revisions of a note
+type RevisionDiff struct {
+	From        int         `json:"from"`
+	To          int         `json:"to"`
+	OldTitle    string      `json:"old_title"`
+	NewTitle    string      `json:"new_title"`
+	AddedTags   []string    `json:"added_tags"`
+	RemovedTags []string    `json:"removed_tags"`
+	Lines       []diff.Line `json:"lines"`
+}
+
+// defines what the revision service must provide
+// access follows the note: viewing history needs view permission, restoring needs edit permission
+type NoteRevisionService interface {
+	List(userID, noteID uint) ([]model.NoteRevision, error)
+	Get(userID, noteID uint, rev int) (*model.NoteRevision, error)
+	// line-level diff of the content plus title and tag changes
+	Diff(userID, noteID uint, from, to int) (*RevisionDiff, error)
+	// writes the revision's title, content and tags back to the note as a new revision
+	Restore(userID, noteID uint, rev int) (*model.Note, error)
+}
+
+type noteRevisionService struct {
+	repo  repository.NoteRevisionRepository
+	notes NoteService
+}
+
+// constructor returns a new noteRevisionService instance
+func NewNoteRevisionService(repo repository.NoteRevisionRepository, notes NoteService) NoteRevisionService {
+	return &noteRevisionService{repo, notes}
+}
+
+// history of a note, newest first
+func (s *noteRevisionService) List(userID, noteID uint) ([]model.NoteRevision, error) {
+	if _, err := s.notes.GetNoteByID(userID, noteID); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByNote(noteID)
+}
+
+// single revision of a note
+func (s *noteRevisionService) Get(userID, noteID uint, rev int) (*model.NoteRevision, error) {
+	if _, err := s.notes.GetNoteByID(userID, noteID); err != nil {
+		return nil, err
+	}
+	return s.loadRevision(noteID, rev)
+}
+
+// compares two revisions, from may be newer than to
+func (s *noteRevisionService) Diff(userID, noteID uint, from, to int) (*RevisionDiff, error) {
+	if _, err := s.notes.GetNoteByID(userID, noteID); err != nil {
+		return nil, err
+	}
+	oldRev, err := s.loadRevision(noteID, from)
+	if err != nil {
+		return nil, err
+	}
+	newRev, err := s.loadRevision(noteID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RevisionDiff{
+		From:        from,
+		To:          to,
+		OldTitle:    oldRev.Title,
+		NewTitle:    newRev.Title,
+		AddedTags:   []string{},
+		RemovedTags: []string{},
+		Lines:       diff.Lines(oldRev.Content, newRev.Content),
+	}
+	for _, tag := range newRev.TagNames {
+		if !slices.Contains(oldRev.TagNames, tag) {
+			result.AddedTags = append(result.AddedTags, tag)
+		}
+	}
+	for _, tag := range oldRev.TagNames {
+		if !slices.Contains(newRev.TagNames, tag) {
+			result.RemovedTags = append(result.RemovedTags, tag)
+		}
+	}
+	if result.Lines == nil {
+		result.Lines = []diff.Line{}
+	}
+	return result, nil
+}
+
+// rollback goes through NoteService.Update, so it's checked and recorded like any other edit
+func (s *noteRevisionService) Restore(userID, noteID uint, rev int) (*model.Note, error) {
+	note, err := s.notes.GetNoteByID(userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	revision, err := s.loadRevision(noteID, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	note.Title = revision.Title
+	note.Content = revision.Content
+	note.Tags = make([]model.Tag, 0, len(revision.TagNames))
+	for _, name := range revision.TagNames {
+		note.Tags = append(note.Tags, model.Tag{Name: name})
+	}
+	note.Date = time.Now()
+
+	if err := s.notes.Update(userID, note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// revision by number, missing ones map to ErrRevisionNotFound
+func (s *noteRevisionService) loadRevision(noteID uint, rev int) (*model.NoteRevision, error) {
+	revision, err := s.repo.FindByRev(noteID, rev)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
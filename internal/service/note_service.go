@@ -1,81 +1,583 @@
 package service
 
 import (
+	"errors"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/dassajib/prohor-api/internal/model"
 	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
 )
 
 // defines what functionalities the note service must provide
+// every method takes the acting user so ownership is checked in one place
 type NoteService interface {
-	Create(note *model.Note) error
-	Update(note *model.Note) error
-	GetNoteByID(id uint) (*model.Note, error)
-	GetUserNotes(userID uint) ([]model.Note, error)
-	TogglePin(id uint, pinned bool) error
+	Create(userID uint, note *model.Note) error
+	// note.Version must be the version the caller based its changes on
+	Update(userID uint, note *model.Note) error
+	GetNoteByID(userID, id uint) (*model.Note, error)
+	// loads the note after checking the user may perform the action on it
+	Authorize(userID, id uint, action NoteAction) (*model.Note, error)
+	GetUserNotes(userID uint, opts repository.NoteListOptions) (*repository.NotePage, error)
+	TogglePin(userID, id uint, pinned bool, version uint) (*model.Note, error)
+	// archives or unarchives a note, notes in the trash can't be archived
+	Archive(userID, id uint, archived bool, version uint) (*model.Note, error)
+	// one page of the user's archived notes
+	GetArchivedNotes(userID uint, opts repository.NoteListOptions) (*repository.NotePage, error)
+	// notes other users shared with the user, never includes the trash
+	GetSharedNotes(userID uint, opts repository.NoteListOptions) (*repository.NotePage, error)
+	// files the note in a notebook of its owner, nil takes it out of any notebook
+	Move(userID, id uint, notebookID *uint) (*model.Note, error)
 	// soft delete a note
-	Delete(id uint) error
-	Restore(id uint) error
-	DeletePermanent(id uint) error
-	SearchUserNotes(userID uint, query string) ([]model.Note, error)
+	Delete(userID, id uint) error
+	Restore(userID, id uint, version uint) (*model.Note, error)
+	DeletePermanent(userID, id uint) error
+	SearchUserNotes(userID uint, query string, opts repository.NoteListOptions) (*repository.NoteSearchPage, error)
+	GetTrash(userID uint) ([]model.Note, error)
+	// permanently deletes everything in the user's trash, returns how many notes were removed
+	EmptyTrash(userID uint) (int, error)
+	// permanently deletes notes of all users whose retention window is over
+	PurgeExpiredTrash() (int, error)
+	// soft-deletes the live notes filed in the notebooks, for notebooks going to the trash
+	DeleteInNotebooks(notebookIDs []uint, at time.Time) error
+	// restores the notes DeleteInNotebooks removed at the given time
+	RestoreInNotebooks(notebookIDs []uint, at time.Time) error
+	// saves content merged outside Update, like a live editing session, as a revision by authorID
+	// permissions were checked by the caller, note.Version must be the version the content is based on
+	SaveContent(authorID uint, note *model.Note) error
+	// drops the oldest revisions of every user above MaxRevisionsPerUser
+	PruneRevisions() error
+}
+
+// tunables of the note service, read from env in main
+type NoteSettings struct {
+	// how long a soft-deleted note can still be restored
+	TrashRetention time.Duration
+	// revisions kept per user before the oldest ones are dropped
+	MaxRevisionsPerUser int
 }
 
 // struct that implements NoteService interface
 type noteService struct {
 	// uses repository layer to access DB
-	repo repository.NoteRepository
+	repo      repository.NoteRepository
+	tags      repository.TagRepository
+	notebooks repository.NotebookRepository
+	revisions repository.NoteRevisionRepository
+	shares    repository.NoteShareRepository
+	links     repository.NoteLinkRepository
+	// a note is saved together with its links and revision
+	tx       repository.Transactor
+	policy   NotePolicy
+	events   NoteEventBus
+	settings NoteSettings
 }
 
+// how many expired notes the purge loads per round
+const purgeBatchSize = 100
+
 // constructor returns a new noteService instance
-func NewNoteService(repo repository.NoteRepository) NoteService {
-	return &noteService{repo}
+// every successful write is published on the event bus
+func NewNoteService(repo repository.NoteRepository, tags repository.TagRepository, notebooks repository.NotebookRepository, revisions repository.NoteRevisionRepository, shares repository.NoteShareRepository, links repository.NoteLinkRepository, tx repository.Transactor, policy NotePolicy, events NoteEventBus, settings NoteSettings) NoteService {
+	return &noteService{repo, tags, notebooks, revisions, shares, links, tx, policy, events, settings}
+}
+
+// calls repository to create, the note always belongs to the acting user
+// note.Tags only needs names, missing tags are created
+func (s *noteService) Create(userID uint, note *model.Note) error {
+	note.UserID = userID
+	if note.Format == "" {
+		note.Format = model.NoteFormatPlain
+	}
+	if err := validateFormat(note); err != nil {
+		return err
+	}
+	if err := validateSchedule(note); err != nil {
+		return err
+	}
+	if err := s.resolveTags(note); err != nil {
+		return err
+	}
+	err := s.tx.Transaction(func(tx repository.TxRepositories) error {
+		if err := tx.Notes.Create(note); err != nil {
+			return err
+		}
+		// links written before the note existed find it now
+		if err := tx.Links.ResolveDangling(note.UserID, note.Title, note.ID); err != nil {
+			return err
+		}
+		if err := syncLinks(tx.Links, note); err != nil {
+			return err
+		}
+		// first revision is the note as created
+		return recordRevision(tx.Revisions, userID, note)
+	})
+	if err != nil {
+		// nothing was saved, the note can be created again
+		note.ID = 0
+		return err
+	}
+	s.publish(NoteEventCreated, note, []uint{note.UserID})
+	return nil
 }
 
-// calls repository to create
-func (s *noteService) Create(note *model.Note) error {
-	return s.repo.Create(note)
+// calls repository to update note after checking edit permission
+func (s *noteService) Update(userID uint, note *model.Note) error {
+	existing, err := s.loadNote(userID, note.ID, NoteActionEdit)
+	if err != nil {
+		return err
+	}
+	if existing.Version != note.Version {
+		return ErrVersionConflict
+	}
+	// owner can't be changed through an update
+	note.UserID = existing.UserID
+	if err := validateFormat(note); err != nil {
+		return err
+	}
+	if err := validateSchedule(note); err != nil {
+		return err
+	}
+	if err := s.resolveTags(note); err != nil {
+		return err
+	}
+
+	renamed := !strings.EqualFold(strings.TrimSpace(existing.Title), strings.TrimSpace(note.Title))
+	version := note.Version
+	err = s.tx.Transaction(func(tx repository.TxRepositories) error {
+		// notes created before revisions existed get their current state saved first
+		if _, err := tx.Revisions.FindLatest(existing.ID); errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := recordRevision(tx.Revisions, existing.UserID, existing); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+
+		if err := tx.Notes.Update(note); err != nil {
+			return err
+		}
+		if err := syncLinks(tx.Links, note); err != nil {
+			return err
+		}
+		if renamed {
+			if err := tx.Links.ResolveDangling(note.UserID, note.Title, note.ID); err != nil {
+				return err
+			}
+		}
+		return recordRevision(tx.Revisions, userID, note)
+	})
+	if err != nil {
+		// rolled back, the caller's version is still the current one
+		note.Version = version
+		return err
+	}
+
+	if renamed {
+		s.retitleLinks(note)
+	}
+	s.publish(NoteEventUpdated, note, s.audience(note))
+	return nil
 }
 
-// calls repository to update note
-func (s *noteService) Update(note *model.Note) error {
-	return s.repo.Update(note)
+// same transaction as Update, only the content changed so links to the note stay as they are
+func (s *noteService) SaveContent(authorID uint, note *model.Note) error {
+	version := note.Version
+	err := s.tx.Transaction(func(tx repository.TxRepositories) error {
+		if err := tx.Notes.Update(note); err != nil {
+			return err
+		}
+		if err := syncLinks(tx.Links, note); err != nil {
+			return err
+		}
+		return recordRevision(tx.Revisions, authorID, note)
+	})
+	if err != nil {
+		note.Version = version
+		return err
+	}
+	s.publish(NoteEventUpdated, note, s.audience(note))
+	return nil
 }
 
 // call repo to find a single note(can include soft-deleted ones)
-func (s *noteService) GetNoteByID(id uint) (*model.Note, error) {
-	return s.repo.FindByID(id)
+func (s *noteService) GetNoteByID(userID, id uint) (*model.Note, error) {
+	return s.loadNote(userID, id, NoteActionView)
+}
+
+// for other services that act on a note, like sharing and revisions
+func (s *noteService) Authorize(userID, id uint, action NoteAction) (*model.Note, error) {
+	return s.loadNote(userID, id, action)
 }
 
 // fetches all notes belonging to a particular user
-func (s *noteService) GetUserNotes(userID uint) ([]model.Note, error) {
-	return s.repo.FindByUser(userID)
+func (s *noteService) GetUserNotes(userID uint, opts repository.NoteListOptions) (*repository.NotePage, error) {
+	return s.repo.FindByUser(userID, opts)
+}
+
+// archived notes of the user, the trash is never part of it
+func (s *noteService) GetArchivedNotes(userID uint, opts repository.NoteListOptions) (*repository.NotePage, error) {
+	opts.Archived = repository.ArchivedOnly
+	opts.Deleted = repository.DeletedExclude
+	return s.repo.FindByUser(userID, opts)
+}
+
+// shared notes in the owner's trash aren't shown to collaborators
+// archiving is the owner's way of tidying up, collaborators still see those notes
+func (s *noteService) GetSharedNotes(userID uint, opts repository.NoteListOptions) (*repository.NotePage, error) {
+	opts.Deleted = repository.DeletedExclude
+	if opts.Archived == "" {
+		opts.Archived = repository.ArchivedInclude
+	}
+	// notebooks belong to the owner, they mean nothing to a collaborator
+	opts.NotebookIDs = nil
+	return s.repo.FindSharedWith(userID, opts)
 }
 
 // soft delete by setting deleted_at field
-func (s *noteService) Delete(id uint) error {
-	return s.repo.DeleteSoft(id)
+func (s *noteService) Delete(userID, id uint) error {
+	note, err := s.loadNote(userID, id, NoteActionDelete)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteSoft(id); err != nil {
+		return err
+	}
+
+	note.Version++
+	s.publishRemoval(NoteEventDeleted, note, s.audience(note))
+	return nil
 }
 
-// brings back a soft-deleted note by nullifying deleted_at
-func (s *noteService) Restore(id uint) error {
-	return s.repo.RestoreDeleted(id)
+// brings back a soft-deleted note by nullifying deleted_at, only within the retention window
+func (s *noteService) Restore(userID, id uint, version uint) (*model.Note, error) {
+	note, err := s.loadNote(userID, id, NoteActionDelete)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(note, version); err != nil {
+		return nil, err
+	}
+	if !note.DeletedAt.Valid {
+		return nil, ErrNoteNotInTrash
+	}
+	if time.Since(note.DeletedAt.Time) > s.settings.TrashRetention {
+		return nil, ErrRestoreExpired
+	}
+
+	// a note whose notebook is still in the trash comes back outside of any notebook
+	detach := false
+	if note.NotebookID != nil {
+		notebook, err := s.notebooks.FindByID(*note.NotebookID)
+		detach = err != nil || notebook.DeletedAt.Valid
+	}
+
+	err = s.tx.Transaction(func(tx repository.TxRepositories) error {
+		if detach {
+			note.NotebookID = nil
+			if err := tx.Notes.Update(note); err != nil {
+				return err
+			}
+		}
+		if err := tx.Notes.RestoreDeleted(id, note.Version); err != nil {
+			return err
+		}
+		// [[title]] links written while the note was in the trash
+		return tx.Links.ResolveDangling(note.UserID, note.Title, note.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	note.DeletedAt = gorm.DeletedAt{}
+	note.Version++
+	s.publish(NoteEventRestored, note, s.audience(note))
+	return note, nil
 }
 
 // delete permanently
-func (s *noteService) DeletePermanent(id uint) error {
-	return s.repo.DeletePermanent(id)
+func (s *noteService) DeletePermanent(userID, id uint) error {
+	note, err := s.loadNote(userID, id, NoteActionDelete)
+	if err != nil {
+		return err
+	}
+	return s.purge(note)
 }
 
 // search note
-func (s *noteService) SearchUserNotes(userID uint, query string) ([]model.Note, error) {
-	return s.repo.SearchUserNotes(userID, query)
+func (s *noteService) SearchUserNotes(userID uint, query string, opts repository.NoteListOptions) (*repository.NoteSearchPage, error) {
+	return s.repo.SearchUserNotes(userID, query, opts)
 }
 
-// toggle pinned status
-func (s *noteService) TogglePin(id uint, pinned bool) error {
-	note, err := s.repo.FindByID(id)
+// notebook must be a live notebook of the note's owner
+func (s *noteService) Move(userID, id uint, notebookID *uint) (*model.Note, error) {
+	note, err := s.loadNote(userID, id, NoteActionManage)
+	if err != nil {
+		return nil, err
+	}
+
+	if notebookID != nil {
+		notebook, err := s.notebooks.FindByID(*notebookID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotebookNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if notebook.UserID != note.UserID || notebook.DeletedAt.Valid {
+			return nil, ErrNotebookNotFound
+		}
+	}
+
+	note.NotebookID = notebookID
+	if err := s.repo.Update(note); err != nil {
+		return nil, err
+	}
+	s.publish(NoteEventUpdated, note, s.audience(note))
+	return note, nil
+}
+
+// lists the user's trash, notes past the retention window can't be restored and are left out
+// until the purger removes them
+func (s *noteService) GetTrash(userID uint) ([]model.Note, error) {
+	return s.repo.FindTrashByUser(userID, time.Now().Add(-s.settings.TrashRetention))
+}
+
+// goes through DeletePermanent one note at a time so every permanent delete takes the same path
+func (s *noteService) EmptyTrash(userID uint) (int, error) {
+	notes, err := s.repo.FindTrashByUser(userID, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for i := range notes {
+		if err := s.purge(&notes[i]); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// removes notes deleted longer ago than the retention window, in batches
+func (s *noteService) PurgeExpiredTrash() (int, error) {
+	cutoff := time.Now().Add(-s.settings.TrashRetention)
+
+	purged := 0
+	for {
+		notes, err := s.repo.FindDeletedBefore(cutoff, purgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		for i := range notes {
+			if err := s.purge(&notes[i]); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(notes) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+// the notebook service checked the notebooks belong to the user, every note gets its own event
+func (s *noteService) DeleteInNotebooks(notebookIDs []uint, at time.Time) error {
+	notes, err := s.repo.DeleteSoftInNotebooks(notebookIDs, at)
+	if err != nil {
+		return err
+	}
+	for i := range notes {
+		s.publishRemoval(NoteEventDeleted, &notes[i], s.audience(&notes[i]))
+	}
+	return nil
+}
+
+// like Restore, [[title]] links written while the notes were in the trash find them again
+func (s *noteService) RestoreInNotebooks(notebookIDs []uint, at time.Time) error {
+	notes, err := s.repo.RestoreDeletedInNotebooks(notebookIDs, at)
 	if err != nil {
 		return err
 	}
+	for i := range notes {
+		// the notes are back either way, a link left dangling is only logged
+		if err := s.links.ResolveDangling(notes[i].UserID, notes[i].Title, notes[i].ID); err != nil {
+			log.Printf("Failed to resolve links to note %d: %v", notes[i].ID, err)
+		}
+		s.publish(NoteEventRestored, &notes[i], s.audience(&notes[i]))
+	}
+	return nil
+}
+
+// toggle pinned status
+func (s *noteService) TogglePin(userID, id uint, pinned bool, version uint) (*model.Note, error) {
+	note, err := s.loadNote(userID, id, NoteActionEdit)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(note, version); err != nil {
+		return nil, err
+	}
+
 	note.Pinned = pinned
-	return s.repo.Update(note)
+	if err := s.repo.Update(note); err != nil {
+		return nil, err
+	}
+	s.publish(NoteEventPinned, note, s.audience(note))
+	return note, nil
+}
+
+// archiving tidies up the owner's listing, so it needs the same permission as moving the note
+// archiving an archived note keeps its original archive time
+func (s *noteService) Archive(userID, id uint, archived bool, version uint) (*model.Note, error) {
+	note, err := s.loadNote(userID, id, NoteActionManage)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(note, version); err != nil {
+		return nil, err
+	}
+	if note.DeletedAt.Valid {
+		return nil, ErrNoteNotFound
+	}
+
+	switch {
+	case archived && note.ArchivedAt == nil:
+		now := time.Now()
+		note.ArchivedAt = &now
+	case !archived:
+		note.ArchivedAt = nil
+	}
+	if err := s.repo.Update(note); err != nil {
+		return nil, err
+	}
+	s.publish(NoteEventArchived, note, s.audience(note))
+	return note, nil
+}
+
+// permanent delete of a single note, collaborators are looked up before their grants go away with it
+func (s *noteService) purge(note *model.Note) error {
+	audience := s.audience(note)
+	if err := s.repo.DeletePermanent(note.ID); err != nil {
+		return err
+	}
+	s.publishRemoval(NoteEventPurged, note, audience)
+	return nil
+}
+
+// owner and collaborators of a note, the ones who get its events
+func (s *noteService) audience(note *model.Note) []uint {
+	userIDs := []uint{note.UserID}
+	shares, err := s.shares.FindByNote(note.ID)
+	if err != nil {
+		// events are best effort, the owner still gets them
+		log.Printf("Failed to load shares of note %d: %v", note.ID, err)
+		return userIDs
+	}
+	for _, share := range shares {
+		userIDs = append(userIDs, share.UserID)
+	}
+	return userIDs
+}
+
+// publishes a copy of the note so later changes to it don't race with subscribers
+func (s *noteService) publish(eventType string, note *model.Note, userIDs []uint) {
+	copied := *note
+	s.events.Publish(NoteEvent{Type: eventType, NoteID: note.ID, Version: note.Version, Note: &copied}, userIDs)
+}
+
+// notes in the trash or gone for good are announced without their content
+func (s *noteService) publishRemoval(eventType string, note *model.Note, userIDs []uint) {
+	s.events.Publish(NoteEvent{Type: eventType, NoteID: note.ID, Version: note.Version}, userIDs)
+}
+
+// revisions are pruned in the background, see PruneRevisions
+func (s *noteService) PruneRevisions() error {
+	userIDs, err := s.revisions.FindUsersOverCap(s.settings.MaxRevisionsPerUser)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if err := s.revisions.Prune(userID, s.settings.MaxRevisionsPerUser); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stores the note's title, content and tags as a new revision unless they equal the latest one
+// the revision goes through the given repository so it can be part of the note's transaction
+func recordRevision(revisions repository.NoteRevisionRepository, authorID uint, note *model.Note) error {
+	tagNames := make([]string, 0, len(note.Tags))
+	for _, tag := range note.Tags {
+		tagNames = append(tagNames, tag.Name)
+	}
+	// tags come back from the db in no particular order
+	slices.Sort(tagNames)
+
+	latest, err := revisions.FindLatest(note.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil && latest.Title == note.Title && latest.Content == note.Content && slices.Equal(latest.TagNames, tagNames) {
+		return nil
+	}
+
+	return revisions.Create(&model.NoteRevision{
+		NoteID:   note.ID,
+		UserID:   note.UserID,
+		AuthorID: authorID,
+		Title:    note.Title,
+		Content:  note.Content,
+		TagNames: tagNames,
+	})
+}
+
+// notes written before formats existed are plain
+func validateFormat(note *model.Note) error {
+	if note.Format != model.NoteFormatPlain && note.Format != model.NoteFormatMarkdown {
+		return ErrInvalidNoteFormat
+	}
+	return nil
+}
+
+// replaces note.Tags with the owner's tags of the same names, creating missing ones
+func (s *noteService) resolveTags(note *model.Note) error {
+	names := make([]string, 0, len(note.Tags))
+	for _, tag := range note.Tags {
+		names = append(names, tag.Name)
+	}
+	names, err := normalizeTagNames(names)
+	if err != nil {
+		return err
+	}
+
+	tags, err := s.tags.FindOrCreateByNames(note.UserID, names)
+	if err != nil {
+		return err
+	}
+	note.Tags = tags
+	return nil
+}
+
+// fetch a note and run it through the policy for the given action
+func (s *noteService) loadNote(userID, id uint, action NoteAction) (*model.Note, error) {
+	note, err := s.repo.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.policy.Authorize(userID, note, action); err != nil {
+		return nil, err
+	}
+	return note, nil
 }
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// errors returned by the share service
+var (
+	ErrShareUserNotFound = errors.New("no user with that email")
+	ErrShareNotFound     = errors.New("note is not shared with that user")
+	ErrInvalidShareRole  = errors.New("role must be viewer, editor or owner")
+	ErrShareWithOwner    = errors.New("note can't be shared with its owner")
+)
+
+// defines what the share service must provide
+// managing grants needs manage permission on the note, see NotePolicy
+type NoteShareService interface {
+	// grants the user with the email access to the note, sharing again changes the role
+	Share(userID, noteID uint, email, role string) (*model.NoteShare, error)
+	List(userID, noteID uint) ([]model.NoteShare, error)
+	// collaborators can always remove their own grant
+	Revoke(userID, noteID, targetUserID uint) error
+}
+
+type noteShareService struct {
+	repo  repository.NoteShareRepository
+	users repository.UserRepository
+	notes NoteService
+	// live editing sessions follow grant changes right away
+	collab CollabService
+}
+
+// constructor returns a new noteShareService instance
+func NewNoteShareService(repo repository.NoteShareRepository, users repository.UserRepository, notes NoteService, collab CollabService) NoteShareService {
+	return &noteShareService{repo, users, notes, collab}
+}
+
+// invite a user by email
+func (s *noteShareService) Share(userID, noteID uint, email, role string) (*model.NoteShare, error) {
+	if !isValidShareRole(role) {
+		return nil, ErrInvalidShareRole
+	}
+	note, err := s.notes.Authorize(userID, noteID, NoteActionManage)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.FindByEmail(strings.TrimSpace(email))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShareUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == note.UserID {
+		return nil, ErrShareWithOwner
+	}
+
+	share := &model.NoteShare{
+		NoteID:    note.ID,
+		UserID:    user.ID,
+		Role:      role,
+		GrantedBy: userID,
+	}
+	if err := s.repo.Upsert(share); err != nil {
+		return nil, err
+	}
+	// sharing again may have lowered the role
+	s.collab.Reauthorize(user.ID, note.ID)
+	share.User = *user
+	return share, nil
+}
+
+// collaborators of a note with their users
+func (s *noteShareService) List(userID, noteID uint) ([]model.NoteShare, error) {
+	if _, err := s.notes.Authorize(userID, noteID, NoteActionManage); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByNote(noteID)
+}
+
+// revoke a grant, or leave a note someone shared with you
+func (s *noteShareService) Revoke(userID, noteID, targetUserID uint) error {
+	action := NoteActionManage
+	if targetUserID == userID {
+		action = NoteActionView
+	}
+	if _, err := s.notes.Authorize(userID, noteID, action); err != nil {
+		return err
+	}
+
+	err := s.repo.Delete(noteID, targetUserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrShareNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.collab.Reauthorize(targetUserID, noteID)
+	return nil
+}
+
+// checks a role from the request body
+func isValidShareRole(role string) bool {
+	switch role {
+	case model.ShareRoleViewer, model.ShareRoleEditor, model.ShareRoleOwner:
+		return true
+	}
+	return false
+}
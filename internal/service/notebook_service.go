@@ -0,0 +1,275 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// longest notebook name the notebooks table accepts
+const maxNotebookNameLength = 100
+
+// errors returned by notebook operations
+var (
+	ErrNotebookNotFound    = errors.New("notebook not found")
+	ErrInvalidNotebookName = errors.New("notebook name must be 1 to 100 characters")
+	ErrNotebookCycle       = errors.New("a notebook cannot be moved into itself or one of its children")
+	ErrNotebookNotInTrash  = errors.New("notebook is not in trash")
+)
+
+// a notebook with what is filed in it
+type NotebookContents struct {
+	Notebook *model.Notebook
+	// direct children, or every notebook below it when listed recursively
+	Notebooks []model.Notebook
+	Notes     *repository.NotePage
+}
+
+// defines what the notebook service must provide, every notebook belongs to one user
+type NotebookService interface {
+	List(userID uint) ([]model.Notebook, error)
+	Create(userID uint, name string, parentID *uint) (*model.Notebook, error)
+	Rename(userID, id uint, name string) (*model.Notebook, error)
+	// moves the notebook under another one, nil moves it to the top level
+	Move(userID, id uint, parentID *uint) (*model.Notebook, error)
+	// notes and notebooks inside the notebook, recursive includes all levels below
+	Contents(userID, id uint, recursive bool, opts repository.NoteListOptions) (*NotebookContents, error)
+	// soft-deletes the notebook, everything below it and all their notes
+	Delete(userID, id uint) error
+	// restores what Delete removed, within the trash retention window
+	Restore(userID, id uint) error
+	// removes notebooks whose retention window is over and that are empty
+	PurgeExpired() (int64, error)
+}
+
+type notebookService struct {
+	repo  repository.NotebookRepository
+	notes repository.NoteRepository
+	// trashes and restores the notes of a notebook so their events go out
+	noteService NoteService
+	retention   time.Duration
+}
+
+// constructor returns a new notebookService instance
+func NewNotebookService(repo repository.NotebookRepository, notes repository.NoteRepository, noteService NoteService, retention time.Duration) NotebookService {
+	return &notebookService{repo, notes, noteService, retention}
+}
+
+// flat list of the user's notebooks
+func (s *notebookService) List(userID uint) ([]model.Notebook, error) {
+	return s.repo.FindByUser(userID)
+}
+
+// creates a notebook, the parent must be a live notebook of the same user
+func (s *notebookService) Create(userID uint, name string, parentID *uint) (*model.Notebook, error) {
+	name, err := normalizeNotebookName(name)
+	if err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		if _, err := s.loadLiveNotebook(userID, *parentID); err != nil {
+			return nil, err
+		}
+	}
+
+	notebook := &model.Notebook{UserID: userID, Name: name, ParentID: parentID}
+	if err := s.repo.Create(notebook); err != nil {
+		return nil, err
+	}
+	return notebook, nil
+}
+
+// renames a notebook
+func (s *notebookService) Rename(userID, id uint, name string) (*model.Notebook, error) {
+	notebook, err := s.loadLiveNotebook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	name, err = normalizeNotebookName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	notebook.Name = name
+	if err := s.repo.Update(notebook); err != nil {
+		return nil, err
+	}
+	return notebook, nil
+}
+
+// re-parents a notebook, refusing moves that would create a cycle
+func (s *notebookService) Move(userID, id uint, parentID *uint) (*model.Notebook, error) {
+	notebook, err := s.loadLiveNotebook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID != nil {
+		if _, err := s.loadLiveNotebook(userID, *parentID); err != nil {
+			return nil, err
+		}
+		subtree, err := s.repo.FindSubtreeIDs(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, descendant := range subtree {
+			if descendant == *parentID {
+				return nil, ErrNotebookCycle
+			}
+		}
+	}
+
+	notebook.ParentID = parentID
+	if err := s.repo.Update(notebook); err != nil {
+		return nil, err
+	}
+	return notebook, nil
+}
+
+// lists child notebooks and a page of notes, recursive walks the whole subtree
+func (s *notebookService) Contents(userID, id uint, recursive bool, opts repository.NoteListOptions) (*NotebookContents, error) {
+	notebook, err := s.loadLiveNotebook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// notes of the notebook itself, or of every notebook in the subtree
+	noteScope := []uint{id}
+	var children []model.Notebook
+	if recursive {
+		subtree, err := s.repo.FindSubtreeIDs(id)
+		if err != nil {
+			return nil, err
+		}
+		noteScope = subtree
+
+		below := make([]uint, 0, len(subtree))
+		for _, nbID := range subtree {
+			if nbID != id {
+				below = append(below, nbID)
+			}
+		}
+		if children, err = s.repo.FindByIDs(below); err != nil {
+			return nil, err
+		}
+	} else {
+		all, err := s.repo.FindByUser(userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, nb := range all {
+			if nb.ParentID != nil && *nb.ParentID == id {
+				children = append(children, nb)
+			}
+		}
+	}
+
+	opts.NotebookIDs = noteScope
+	notes, err := s.notes.FindByUser(userID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NotebookContents{Notebook: notebook, Notebooks: children, Notes: notes}, nil
+}
+
+// cascading soft delete, one timestamp for every notebook and note it touches
+func (s *notebookService) Delete(userID, id uint) error {
+	if _, err := s.loadLiveNotebook(userID, id); err != nil {
+		return err
+	}
+
+	subtree, err := s.repo.FindSubtreeIDs(id)
+	if err != nil {
+		return err
+	}
+
+	// postgres keeps microseconds, truncating keeps the timestamp comparable after a round trip
+	at := time.Now().Truncate(time.Microsecond)
+	if err := s.repo.DeleteSoftMany(subtree, at); err != nil {
+		return err
+	}
+	return s.noteService.DeleteInNotebooks(subtree, at)
+}
+
+// restores the notebook and everything deleted together with it
+// if the parent is still in the trash the notebook comes back at the top level
+func (s *notebookService) Restore(userID, id uint) error {
+	notebook, err := s.loadNotebook(userID, id)
+	if err != nil {
+		return err
+	}
+	if !notebook.DeletedAt.Valid {
+		return ErrNotebookNotInTrash
+	}
+	if time.Since(notebook.DeletedAt.Time) > s.retention {
+		return ErrRestoreExpired
+	}
+
+	at := notebook.DeletedAt.Time
+	subtree, err := s.repo.FindDeletedSubtreeIDs(id, at)
+	if err != nil {
+		return err
+	}
+
+	if notebook.ParentID != nil {
+		parent, err := s.repo.FindByID(*notebook.ParentID)
+		if err != nil || parent.DeletedAt.Valid {
+			notebook.ParentID = nil
+			if err := s.repo.Update(notebook); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.repo.RestoreDeletedMany(subtree, at); err != nil {
+		return err
+	}
+	return s.noteService.RestoreInNotebooks(subtree, at)
+}
+
+// empty notebooks past the retention window are removed for good
+func (s *notebookService) PurgeExpired() (int64, error) {
+	return s.repo.DeleteExpired(time.Now().Add(-s.retention))
+}
+
+// live notebook of the user, deleted ones are reported as not found
+func (s *notebookService) loadLiveNotebook(userID, id uint) (*model.Notebook, error) {
+	notebook, err := s.loadNotebook(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if notebook.DeletedAt.Valid {
+		return nil, ErrNotebookNotFound
+	}
+	return notebook, nil
+}
+
+// notebook of the user including deleted ones, other users' notebooks are reported as not found
+func (s *notebookService) loadNotebook(userID, id uint) (*model.Notebook, error) {
+	notebook, err := s.repo.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotebookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if notebook.UserID != userID {
+		return nil, ErrNotebookNotFound
+	}
+	return notebook, nil
+}
+
+// trims a notebook name and checks its length
+func normalizeNotebookName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxNotebookNameLength {
+		return "", ErrInvalidNotebookName
+	}
+	return name, nil
+}
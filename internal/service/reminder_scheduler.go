@@ -0,0 +1,30 @@
+package service
+
+import (
+	"log"
+	"time"
+)
+
+// background worker that fires due reminders
+type ReminderScheduler struct {
+	reminders ReminderService
+	interval  time.Duration
+}
+
+// constructor for ReminderScheduler
+func NewReminderScheduler(reminders ReminderService, interval time.Duration) *ReminderScheduler {
+	return &ReminderScheduler{reminders: reminders, interval: interval}
+}
+
+// checks right away and then on every tick, never returns
+func (s *ReminderScheduler) Run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.reminders.FireDue(); err != nil {
+			log.Printf("Failed to fire reminders: %v", err)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/rrule"
+	"github.com/dassajib/prohor-api/internal/repository"
+)
+
+// returned when a note's recurrence has nothing to repeat
+var ErrRecurrenceWithoutReminder = errors.New("recurrence needs a remind_at")
+
+// returned for recurrence rules outside the supported subset, the message says why
+var ErrInvalidRecurrence = rrule.ErrInvalid
+
+// sent to the owner's event streams when a reminder fires
+const NoteEventReminder = "note.reminder"
+
+// how many due reminders the scheduler loads per round
+const reminderBatchSize = 100
+
+// a reminder that just fired, RemindAt is the time it was set for
+type Reminder struct {
+	UserID   uint
+	RemindAt time.Time
+	Note     *model.Note
+}
+
+// delivers fired reminders to their users, e.g. as push message or mail
+type Notifier interface {
+	Notify(reminder Reminder) error
+}
+
+// defines what the reminder service must provide
+// reminders go to the note's owner only, collaborators set their own on their notes
+type ReminderService interface {
+	// notes whose reminder or due date falls into the next window
+	Upcoming(userID uint, within time.Duration) ([]model.Note, error)
+	// notes whose due date has passed
+	Overdue(userID uint) ([]model.Note, error)
+	// notifies about every reminder due by now, returns how many fired
+	FireDue() (int, error)
+}
+
+type reminderService struct {
+	repo     repository.NoteRepository
+	notifier Notifier
+}
+
+// constructor returns a new reminderService instance
+func NewReminderService(repo repository.NoteRepository, notifier Notifier) ReminderService {
+	return &reminderService{repo, notifier}
+}
+
+// reminders and due dates between now and now plus the window
+func (s *reminderService) Upcoming(userID uint, within time.Duration) ([]model.Note, error) {
+	now := time.Now()
+	return s.repo.FindUpcoming(userID, now, now.Add(within))
+}
+
+// due dates in the past
+func (s *reminderService) Overdue(userID uint) ([]model.Note, error) {
+	return s.repo.FindOverdue(userID, time.Now())
+}
+
+// every reminder is moved on before it is sent, so a crash loses a notification rather than repeating it
+func (s *reminderService) FireDue() (int, error) {
+	now := time.Now()
+
+	fired := 0
+	for {
+		notes, err := s.repo.FindRemindersDue(now, reminderBatchSize)
+		if err != nil {
+			return fired, err
+		}
+
+		for i := range notes {
+			ok, err := s.fire(&notes[i], now)
+			if err != nil {
+				return fired, err
+			}
+			if ok {
+				fired++
+			}
+		}
+
+		if len(notes) < reminderBatchSize {
+			return fired, nil
+		}
+	}
+}
+
+// a recurring reminder that was missed, e.g. while the server was down, fires once and moves past now
+// the due date moves along by the same amount
+func (s *reminderService) fire(note *model.Note, now time.Time) (bool, error) {
+	remindAt := *note.RemindAt
+	var next *time.Time
+	due := note.DueAt
+	recurrence := note.Recurrence
+
+	if recurrence != "" {
+		rule, err := rrule.Parse(recurrence)
+		if err != nil {
+			// only valid rules are stored, a broken one ends the series
+			log.Printf("Invalid recurrence on note %d: %v", note.ID, err)
+		} else if at, ok := rule.Next(remindAt, now); ok {
+			next = &at
+			if due != nil {
+				shifted := due.Add(at.Sub(remindAt))
+				due = &shifted
+			}
+		}
+	}
+	if next == nil {
+		recurrence = ""
+	}
+
+	ok, err := s.repo.AdvanceReminder(note.ID, remindAt, next, due, recurrence)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	note.RemindAt, note.DueAt, note.Recurrence = next, due, recurrence
+	note.Version++
+	if err := s.notifier.Notify(Reminder{UserID: note.UserID, RemindAt: remindAt, Note: note}); err != nil {
+		// the next reminder is scheduled already, a failed delivery isn't retried
+		log.Printf("Failed to deliver reminder of note %d: %v", note.ID, err)
+	}
+	return true, nil
+}
+
+// checks the recurrence and stores it in its canonical form
+func validateSchedule(note *model.Note) error {
+	if note.Recurrence == "" {
+		return nil
+	}
+	if note.RemindAt == nil {
+		return ErrRecurrenceWithoutReminder
+	}
+	rule, err := rrule.Parse(note.Recurrence)
+	if err != nil {
+		return err
+	}
+	note.Recurrence = rule.String()
+	return nil
+}
+
+// notifier that sends reminders over the note event streams, clients show them while they're connected
+type eventNotifier struct {
+	events NoteEventBus
+}
+
+// constructor returns a Notifier publishing on the event bus
+func NewEventNotifier(events NoteEventBus) Notifier {
+	return &eventNotifier{events}
+}
+
+func (n *eventNotifier) Notify(reminder Reminder) error {
+	copied := *reminder.Note
+	n.events.Publish(NoteEvent{Type: NoteEventReminder, NoteID: copied.ID, Version: copied.Version, Note: &copied}, []uint{reminder.UserID})
+	return nil
+}
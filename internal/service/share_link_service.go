@@ -0,0 +1,159 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/pkg/utils"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// errors returned by the share link service
+var (
+	// unknown, revoked, or pointing to a note that's gone, all look the same to the visitor
+	ErrShareLinkNotFound      = errors.New("share link not found")
+	ErrShareLinkExpired       = errors.New("share link has expired")
+	ErrShareLinkPasswordWrong = errors.New("share link password is missing or wrong")
+	ErrInvalidShareLink       = errors.New("expiry must be in the future and max views at least 1")
+)
+
+// settings of a new link, zero values mean no password, no expiry, unlimited views
+type ShareLinkOptions struct {
+	Password  string
+	ExpiresAt *time.Time
+	MaxViews  *int
+}
+
+// defines what the share link service must provide
+// managing links needs manage permission on the note, opening one needs only the token
+type ShareLinkService interface {
+	// returns the link and its token, the token can't be recovered later
+	Create(userID, noteID uint, opts ShareLinkOptions) (*model.ShareLink, string, error)
+	List(userID, noteID uint) ([]model.ShareLink, error)
+	Revoke(userID, noteID, linkID uint) error
+	// resolves a token to its note and counts the view
+	Open(token, password string) (*model.Note, error)
+}
+
+type shareLinkService struct {
+	repo     repository.ShareLinkRepository
+	notes    NoteService
+	noteRepo repository.NoteRepository
+}
+
+// constructor returns a new shareLinkService instance
+func NewShareLinkService(repo repository.ShareLinkRepository, notes NoteService, noteRepo repository.NoteRepository) ShareLinkService {
+	return &shareLinkService{repo, notes, noteRepo}
+}
+
+// creates a link with a fresh random token, the password is hashed like user passwords
+func (s *shareLinkService) Create(userID, noteID uint, opts ShareLinkOptions) (*model.ShareLink, string, error) {
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(time.Now()) {
+		return nil, "", ErrInvalidShareLink
+	}
+	if opts.MaxViews != nil && *opts.MaxViews < 1 {
+		return nil, "", ErrInvalidShareLink
+	}
+	note, err := s.notes.Authorize(userID, noteID, NoteActionManage)
+	if err != nil {
+		return nil, "", err
+	}
+	if note.DeletedAt.Valid {
+		return nil, "", ErrNoteNotFound
+	}
+
+	token, err := utils.NewSecretToken()
+	if err != nil {
+		return nil, "", err
+	}
+	link := &model.ShareLink{
+		NoteID:    note.ID,
+		CreatedBy: userID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: opts.ExpiresAt,
+		MaxViews:  opts.MaxViews,
+	}
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, "", err
+		}
+		link.PasswordHash = string(hash)
+	}
+
+	if err := s.repo.Create(link); err != nil {
+		return nil, "", err
+	}
+	return link, token, nil
+}
+
+// links of a note including revoked and expired ones
+func (s *shareLinkService) List(userID, noteID uint) ([]model.ShareLink, error) {
+	if _, err := s.notes.Authorize(userID, noteID, NoteActionManage); err != nil {
+		return nil, err
+	}
+	return s.repo.FindByNote(noteID)
+}
+
+// revoke a link of the note
+func (s *shareLinkService) Revoke(userID, noteID, linkID uint) error {
+	if _, err := s.notes.Authorize(userID, noteID, NoteActionManage); err != nil {
+		return err
+	}
+
+	link, err := s.repo.FindByID(linkID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && link.NoteID != noteID) {
+		return ErrShareLinkNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return s.repo.Revoke(link.ID)
+}
+
+// checks revocation, expiry and password before counting the view
+// a wrong password doesn't use up a view
+func (s *shareLinkService) Open(token, password string) (*model.Note, error) {
+	link, err := s.repo.FindByTokenHash(utils.HashToken(token))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShareLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if link.RevokedAt != nil {
+		return nil, ErrShareLinkNotFound
+	}
+	if link.ExpiresAt != nil && time.Now().After(*link.ExpiresAt) {
+		return nil, ErrShareLinkExpired
+	}
+	if link.PasswordHash != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)); err != nil {
+			return nil, ErrShareLinkPasswordWrong
+		}
+	}
+
+	note, err := s.noteRepo.FindByID(link.NoteID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShareLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	// links of a note in the trash stop working until it's restored
+	if note.DeletedAt.Valid {
+		return nil, ErrShareLinkNotFound
+	}
+
+	counted, err := s.repo.RecordView(link.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !counted {
+		return nil, ErrShareLinkExpired
+	}
+	return note, nil
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// limits of the sync endpoints
+const (
+	DefaultSyncLimit = 100
+	MaxSyncLimit     = 500
+	MaxSyncBatch     = 100
+)
+
+// returned when an upload has more changes than MaxSyncBatch
+var ErrSyncBatchTooLarge = errors.New("too many changes in one upload")
+
+// reported for a new note without a usable client id
+var errSyncClientIDRequired = errors.New("client_id of up to 64 characters is required for new notes")
+
+// outcome of a single uploaded change
+const (
+	SyncApplied = "applied"
+	// the note changed on the server since the client's copy, Note holds the server copy
+	SyncConflict = "conflict"
+	// the change can never be applied, e.g. the note is gone or the client may not edit it
+	SyncRejected = "rejected"
+	// something went wrong on our side, the client should upload the change again later
+	SyncFailed = "failed"
+)
+
+// one page of the change feed, Cursor is passed as since to get the next one
+type SyncPage struct {
+	Notes      []model.Note
+	Tombstones []model.NoteTombstone
+	Cursor     int64
+	HasMore    bool
+}
+
+// a change the client made while offline
+// ID 0 means the client created the note, ClientID identifies it so uploads can be retried
+type SyncChange struct {
+	ID          uint     `json:"id"`
+	ClientID    string   `json:"client_id"`
+	BaseVersion uint     `json:"base_version"`
+	Title       string   `json:"title"`
+	Content     string   `json:"content"`
+	Tags        []string `json:"tags"`
+	Pinned      bool     `json:"pinned"`
+	Deleted     bool     `json:"deleted"`
+}
+
+// result of one uploaded change, in the same order as the upload
+type SyncResult struct {
+	ID       uint        `json:"id,omitempty"`
+	ClientID string      `json:"client_id,omitempty"`
+	Status   string      `json:"status"`
+	Error    string      `json:"error,omitempty"`
+	Note     *model.Note `json:"note,omitempty"`
+}
+
+// delta sync for offline clients
+// the feed covers the user's own notes, every write goes through NoteService like any other request
+type SyncService interface {
+	// changes after the cursor, since 0 returns everything
+	Pull(userID uint, since int64, limit int) (*SyncPage, error)
+	// applies uploaded changes one by one, a failing change doesn't stop the others
+	Push(userID uint, changes []SyncChange) ([]SyncResult, error)
+}
+
+type syncService struct {
+	notes      NoteService
+	repo       repository.NoteRepository
+	tombstones repository.NoteTombstoneRepository
+}
+
+// constructor returns a new syncService instance
+func NewSyncService(notes NoteService, repo repository.NoteRepository, tombstones repository.NoteTombstoneRepository) SyncService {
+	return &syncService{notes, repo, tombstones}
+}
+
+// notes and tombstones come from two tables, both are read one past the limit and merged by sequence
+func (s *syncService) Pull(userID uint, since int64, limit int) (*SyncPage, error) {
+	if limit <= 0 {
+		limit = DefaultSyncLimit
+	}
+	limit = min(limit, MaxSyncLimit)
+
+	notes, err := s.repo.FindChangedSince(userID, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	tombstones, err := s.tombstones.FindSince(userID, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SyncPage{Notes: []model.Note{}, Tombstones: []model.NoteTombstone{}, Cursor: since}
+	i, j := 0, 0
+	for i < len(notes) || j < len(tombstones) {
+		if len(page.Notes)+len(page.Tombstones) == limit {
+			page.HasMore = true
+			break
+		}
+		if j == len(tombstones) || (i < len(notes) && notes[i].ChangeSeq < tombstones[j].ChangeSeq) {
+			page.Notes = append(page.Notes, notes[i])
+			page.Cursor = notes[i].ChangeSeq
+			i++
+		} else {
+			page.Tombstones = append(page.Tombstones, tombstones[j])
+			page.Cursor = tombstones[j].ChangeSeq
+			j++
+		}
+	}
+	return page, nil
+}
+
+// every change is applied on its own, results say which ones the client must redo
+func (s *syncService) Push(userID uint, changes []SyncChange) ([]SyncResult, error) {
+	if len(changes) > MaxSyncBatch {
+		return nil, ErrSyncBatchTooLarge
+	}
+
+	results := make([]SyncResult, 0, len(changes))
+	for _, change := range changes {
+		results = append(results, s.apply(userID, change))
+	}
+	return results, nil
+}
+
+// applies one change and turns its error into a result
+func (s *syncService) apply(userID uint, change SyncChange) SyncResult {
+	result := SyncResult{ID: change.ID, ClientID: change.ClientID}
+
+	var note *model.Note
+	var err error
+	switch {
+	case change.ID == 0:
+		note, err = s.create(userID, change)
+	case change.Deleted:
+		note, err = s.delete(userID, change)
+	default:
+		note, err = s.update(userID, change)
+	}
+
+	switch {
+	case err == nil:
+		result.Status = SyncApplied
+		result.ID = note.ID
+		result.Note = note
+	case errors.Is(err, ErrVersionConflict):
+		result.Status = SyncConflict
+		result.Error = err.Error()
+		// the client needs the server copy to resolve the conflict
+		if current, getErr := s.notes.GetNoteByID(userID, change.ID); getErr == nil {
+			result.Note = current
+		}
+	case errors.Is(err, ErrNoteNotFound), errors.Is(err, ErrForbidden), errors.Is(err, ErrInvalidTagName), errors.Is(err, errSyncClientIDRequired):
+		result.Status = SyncRejected
+		result.Error = err.Error()
+	default:
+		log.Printf("Failed to apply sync change of user %d: %v", userID, err)
+		result.Status = SyncFailed
+		result.Error = "could not apply change"
+	}
+	return result
+}
+
+// creating twice with the same client id returns the note from the first time
+func (s *syncService) create(userID uint, change SyncChange) (*model.Note, error) {
+	if change.ClientID == "" || len(change.ClientID) > 64 {
+		return nil, errSyncClientIDRequired
+	}
+	existing, err := s.repo.FindByClientID(userID, change.ClientID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	clientID := change.ClientID
+	note := &model.Note{
+		Title:    change.Title,
+		Content:  change.Content,
+		Tags:     tagsFromNames(change.Tags),
+		Pinned:   change.Pinned,
+		Date:     time.Now(),
+		ClientID: &clientID,
+	}
+	if err := s.notes.Create(userID, note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// replaces the note's fields with the client's copy if nobody changed it in between
+func (s *syncService) update(userID uint, change SyncChange) (*model.Note, error) {
+	note, err := s.notes.GetNoteByID(userID, change.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	note.Title = change.Title
+	note.Content = change.Content
+	note.Tags = tagsFromNames(change.Tags)
+	note.Pinned = change.Pinned
+	note.Date = time.Now()
+	note.Version = change.BaseVersion
+	if err := s.notes.Update(userID, note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// moves the note to the trash, deleting a note that's already there is a no-op
+func (s *syncService) delete(userID uint, change SyncChange) (*model.Note, error) {
+	note, err := s.notes.GetNoteByID(userID, change.ID)
+	if err != nil {
+		return nil, err
+	}
+	if note.DeletedAt.Valid {
+		return note, nil
+	}
+	if note.Version != change.BaseVersion {
+		return nil, ErrVersionConflict
+	}
+	if err := s.notes.Delete(userID, change.ID); err != nil {
+		return nil, err
+	}
+	return s.notes.GetNoteByID(userID, change.ID)
+}
+
+// note.Tags only needs names, NoteService looks up or creates the tags
+func tagsFromNames(names []string) []model.Tag {
+	tags := make([]model.Tag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, model.Tag{Name: name})
+	}
+	return tags
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/repository"
+	"gorm.io/gorm"
+)
+
+// longest tag name the tags table accepts
+const maxTagNameLength = 30
+
+// errors returned by tag operations
+var (
+	ErrTagNotFound    = errors.New("tag not found")
+	ErrTagExists      = errors.New("tag with this name already exists")
+	ErrInvalidTagName = errors.New("tag name must be 1 to 30 characters")
+	ErrInvalidColor   = errors.New("color must look like #rrggbb")
+	ErrMergeSameTag   = errors.New("cannot merge a tag into itself")
+)
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// defines what the tag service must provide, every tag belongs to one user
+type TagService interface {
+	List(userID uint) ([]model.Tag, error)
+	Create(userID uint, name, color string) (*model.Tag, error)
+	// nil arguments leave the field unchanged
+	Update(userID, id uint, name, color *string) (*model.Tag, error)
+	// moves all notes from the source tag to the target tag and deletes the source
+	Merge(userID, sourceID, targetID uint) (*model.Tag, error)
+	Delete(userID, id uint) error
+}
+
+type tagService struct {
+	repo repository.TagRepository
+}
+
+// constructor returns a new tagService instance
+func NewTagService(repo repository.TagRepository) TagService {
+	return &tagService{repo}
+}
+
+// all tags of the user
+func (s *tagService) List(userID uint) ([]model.Tag, error) {
+	return s.repo.FindByUser(userID)
+}
+
+// creates a tag after validating name and color
+func (s *tagService) Create(userID uint, name, color string) (*model.Tag, error) {
+	name, err := normalizeTagName(name)
+	if err != nil {
+		return nil, err
+	}
+	if color != "" && !tagColorPattern.MatchString(color) {
+		return nil, ErrInvalidColor
+	}
+	if err := s.ensureNameFree(userID, name, 0); err != nil {
+		return nil, err
+	}
+
+	tag := &model.Tag{UserID: userID, Name: name, Color: strings.ToLower(color)}
+	if err := s.repo.Create(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// rename and/or recolor a tag
+func (s *tagService) Update(userID, id uint, name, color *string) (*model.Tag, error) {
+	tag, err := s.loadTag(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != nil {
+		normalized, err := normalizeTagName(*name)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.ensureNameFree(userID, normalized, tag.ID); err != nil {
+			return nil, err
+		}
+		tag.Name = normalized
+	}
+	if color != nil {
+		if *color != "" && !tagColorPattern.MatchString(*color) {
+			return nil, ErrInvalidColor
+		}
+		tag.Color = strings.ToLower(*color)
+	}
+
+	if err := s.repo.Update(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+// both tags must belong to the user, returns the surviving target tag
+func (s *tagService) Merge(userID, sourceID, targetID uint) (*model.Tag, error) {
+	if sourceID == targetID {
+		return nil, ErrMergeSameTag
+	}
+	if _, err := s.loadTag(userID, sourceID); err != nil {
+		return nil, err
+	}
+	target, err := s.loadTag(userID, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.Merge(sourceID, targetID); err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// deletes the tag, notes lose only this label
+func (s *tagService) Delete(userID, id uint) error {
+	if _, err := s.loadTag(userID, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(id)
+}
+
+// fetch a tag and make sure it belongs to the user, other users' tags are reported as not found
+func (s *tagService) loadTag(userID, id uint) (*model.Tag, error) {
+	tag, err := s.repo.FindByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTagNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tag.UserID != userID {
+		return nil, ErrTagNotFound
+	}
+	return tag, nil
+}
+
+// a name is free when no other tag of the user has it, ignoring case
+func (s *tagService) ensureNameFree(userID uint, name string, exceptID uint) error {
+	existing, err := s.repo.FindByName(userID, name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if existing.ID != exceptID {
+		return ErrTagExists
+	}
+	return nil
+}
+
+// trims a tag name and checks its length
+func normalizeTagName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxTagNameLength {
+		return "", ErrInvalidTagName
+	}
+	return name, nil
+}
+
+// normalizes a list of tag names and drops duplicates ignoring case, keeps the first spelling
+func normalizeTagNames(names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		name, err := normalizeTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, name)
+	}
+	return result, nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/repository"
+)
+
+// how long a "not revoked" answer from the db is trusted before asking again
+// keeps the middleware off the db on most requests while other instances still catch up quickly
+const revocationCacheTTL = 30 * time.Second
+
+// answers "is this access token still usable" for the auth middleware
+type TokenRevocationService interface {
+	// revoke a single access token until it expires
+	RevokeToken(tokenID string, userID uint, expiresAt time.Time) error
+	// revoke every access and refresh token issued to the user so far
+	RevokeAllForUser(userID uint) error
+	IsRevoked(tokenID string, userID uint, issuedAt time.Time) (bool, error)
+	// drops expired rows and stale cache entries
+	PurgeExpired() error
+}
+
+// cached answer for a token id
+type revokedEntry struct {
+	revoked bool
+	// revoked entries live until the token expires, negative ones for revocationCacheTTL
+	validUntil time.Time
+}
+
+// cached logout-all time for a user
+type cutoffEntry struct {
+	at        *time.Time
+	checkedAt time.Time
+}
+
+// db-backed revocation list with an in-process cache in front of it
+type tokenRevocationService struct {
+	revoked       repository.RevokedTokenRepository
+	users         repository.UserRepository
+	refreshTokens repository.RefreshTokenRepository
+
+	mu      sync.RWMutex
+	tokens  map[string]revokedEntry
+	cutoffs map[uint]cutoffEntry
+}
+
+// constructor warms the cache with every revocation that hasn't expired yet
+func NewTokenRevocationService(revoked repository.RevokedTokenRepository, users repository.UserRepository, refreshTokens repository.RefreshTokenRepository) (TokenRevocationService, error) {
+	s := &tokenRevocationService{
+		revoked:       revoked,
+		users:         users,
+		refreshTokens: refreshTokens,
+		tokens:        make(map[string]revokedEntry),
+		cutoffs:       make(map[uint]cutoffEntry),
+	}
+
+	active, err := revoked.FindActive(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range active {
+		s.tokens[t.TokenID] = revokedEntry{revoked: true, validUntil: t.ExpiresAt}
+	}
+
+	return s, nil
+}
+
+// write-through: db first so other instances see it, then the local cache
+func (s *tokenRevocationService) RevokeToken(tokenID string, userID uint, expiresAt time.Time) error {
+	err := s.revoked.Create(&model.RevokedToken{
+		TokenID:   tokenID,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.tokens[tokenID] = revokedEntry{revoked: true, validUntil: expiresAt}
+	s.mu.Unlock()
+	return nil
+}
+
+// sets the user's cutoff time and kills all refresh token families
+func (s *tokenRevocationService) RevokeAllForUser(userID uint) error {
+	// the precision of the column and of the iat claim, the cached value matches what other instances read
+	now := time.Now().Truncate(time.Microsecond)
+	if err := s.users.SetTokensRevokedAt(userID, now); err != nil {
+		return err
+	}
+	if err := s.refreshTokens.RevokeAllForUser(userID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cutoffs[userID] = cutoffEntry{at: &now, checkedAt: now}
+	s.mu.Unlock()
+	return nil
+}
+
+// called on every authenticated request
+func (s *tokenRevocationService) IsRevoked(tokenID string, userID uint, issuedAt time.Time) (bool, error) {
+	now := time.Now()
+
+	cutoff, err := s.userCutoff(userID, now)
+	if err != nil {
+		return false, err
+	}
+	// iat has microsecond precision like the cutoff, a token from the very same microsecond counts as revoked
+	// older tokens with a whole-second iat are never later than when they were really issued
+	if cutoff != nil && !issuedAt.After(*cutoff) {
+		return true, nil
+	}
+
+	s.mu.RLock()
+	entry, ok := s.tokens[tokenID]
+	s.mu.RUnlock()
+	if ok && now.Before(entry.validUntil) {
+		return entry.revoked, nil
+	}
+
+	// cache miss or stale negative answer, ask the db
+	revoked, err := s.revoked.Exists(tokenID)
+	if err != nil {
+		return false, err
+	}
+	if !revoked {
+		s.mu.Lock()
+		s.tokens[tokenID] = revokedEntry{revoked: false, validUntil: now.Add(revocationCacheTTL)}
+		s.mu.Unlock()
+		return false, nil
+	}
+
+	// revoked on another instance, the exact expiry doesn't matter much here
+	s.mu.Lock()
+	s.tokens[tokenID] = revokedEntry{revoked: true, validUntil: now.Add(revocationCacheTTL)}
+	s.mu.Unlock()
+	return true, nil
+}
+
+// returns the user's logout-all time, cached for revocationCacheTTL
+func (s *tokenRevocationService) userCutoff(userID uint, now time.Time) (*time.Time, error) {
+	s.mu.RLock()
+	entry, ok := s.cutoffs[userID]
+	s.mu.RUnlock()
+	if ok && now.Sub(entry.checkedAt) < revocationCacheTTL {
+		return entry.at, nil
+	}
+
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cutoffs[userID] = cutoffEntry{at: user.TokensRevokedAt, checkedAt: now}
+	s.mu.Unlock()
+	return user.TokensRevokedAt, nil
+}
+
+// remove revocations of tokens that expired anyway and stale cache entries
+func (s *tokenRevocationService) PurgeExpired() error {
+	now := time.Now()
+	if err := s.revoked.DeleteExpired(now); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, entry := range s.tokens {
+		if !now.Before(entry.validUntil) {
+			delete(s.tokens, id)
+		}
+	}
+	for id, entry := range s.cutoffs {
+		if now.Sub(entry.checkedAt) >= revocationCacheTTL {
+			delete(s.cutoffs, id)
+		}
+	}
+	return nil
+}
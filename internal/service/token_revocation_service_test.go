@@ -0,0 +1,105 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dassajib/prohor-api/internal/model"
+	"github.com/dassajib/prohor-api/internal/repository"
+)
+
+// nothing revoked one by one
+type fakeRevokedTokenRepo struct {
+	repository.RevokedTokenRepository
+}
+
+func (fakeRevokedTokenRepo) FindActive(now time.Time) ([]model.RevokedToken, error) {
+	return nil, nil
+}
+
+func (fakeRevokedTokenRepo) Exists(tokenID string) (bool, error) {
+	return false, nil
+}
+
+// keeps the logout-all time of a single user like a timestamp column would
+type fakeCutoffUserRepo struct {
+	repository.UserRepository
+	revokedAt *time.Time
+}
+
+func (r *fakeCutoffUserRepo) SetTokensRevokedAt(id uint, at time.Time) error {
+	// postgres keeps microseconds
+	at = at.Round(time.Microsecond)
+	r.revokedAt = &at
+	return nil
+}
+
+func (r *fakeCutoffUserRepo) FindByID(id uint) (*model.User, error) {
+	return &model.User{TokensRevokedAt: r.revokedAt}, nil
+}
+
+type fakeRefreshTokenRepo struct {
+	repository.RefreshTokenRepository
+}
+
+func (fakeRefreshTokenRepo) RevokeAllForUser(userID uint) error {
+	return nil
+}
+
+func TestLogoutAllCutoff(t *testing.T) {
+	users := &fakeCutoffUserRepo{}
+	revocations, err := NewTokenRevocationService(fakeRevokedTokenRepo{}, users, fakeRefreshTokenRepo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before := time.Now().Truncate(time.Microsecond)
+	if err := revocations.RevokeAllForUser(1); err != nil {
+		t.Fatalf("RevokeAllForUser() error = %v", err)
+	}
+	cutoff := *users.revokedAt
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued before logout-all", before, true},
+		{"issued in the same microsecond", cutoff, true},
+		// the login right after logging out everywhere usually lands in the same second
+		{"issued right after in the same second", cutoff.Add(time.Microsecond), false},
+		{"issued a second later", cutoff.Add(time.Second), false},
+		// tokens from before microsecond iat carry the whole second they were issued in
+		{"whole-second iat of an older token", cutoff.Truncate(time.Second), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the cached cutoff and the one other instances load from the db must agree
+			for _, fresh := range []bool{false, true} {
+				svc := revocations
+				if fresh {
+					if svc, err = NewTokenRevocationService(fakeRevokedTokenRepo{}, users, fakeRefreshTokenRepo{}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				revoked, err := svc.IsRevoked("token", 1, tt.issuedAt)
+				if err != nil {
+					t.Fatalf("IsRevoked() error = %v", err)
+				}
+				if revoked != tt.want {
+					t.Errorf("IsRevoked(issued %v after the cutoff, from db %v) = %v, want %v", tt.issuedAt.Sub(cutoff), fresh, revoked, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsRevokedWithoutLogoutAll(t *testing.T) {
+	revocations, err := NewTokenRevocationService(fakeRevokedTokenRepo{}, &fakeCutoffUserRepo{}, fakeRefreshTokenRepo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := revocations.IsRevoked("token", 1, time.Now()); err != nil || revoked {
+		t.Errorf("IsRevoked() = %v, %v, want false", revoked, err)
+	}
+}
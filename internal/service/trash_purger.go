@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// background worker that empties expired notes and notebooks out of every user's trash
+// and trims revision history down to its cap
+type TrashPurger struct {
+	notes       NoteService
+	notebooks   NotebookService
+	attachments AttachmentService
+	interval    time.Duration
+}
+
+// constructor for TrashPurger
+func NewTrashPurger(notes NoteService, notebooks NotebookService, attachments AttachmentService, interval time.Duration) *TrashPurger {
+	return &TrashPurger{notes: notes, notebooks: notebooks, attachments: attachments, interval: interval}
+}
+
+// runs one purge right away and then on every tick, never returns
+func (p *TrashPurger) Run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge()
+		<-ticker.C
+	}
+}
+
+// a failed round is only logged, the next tick tries again
+func (p *TrashPurger) purge() {
+	purged, err := p.notes.PurgeExpiredTrash()
+	if err != nil {
+		log.Printf("Failed to purge trash: %v", err)
+	}
+	if purged > 0 {
+		log.Printf("Purged %d expired notes from trash", purged)
+	}
+
+	// notes go first so the notebooks they were in are empty by now
+	notebooks, err := p.notebooks.PurgeExpired()
+	if err != nil {
+		log.Printf("Failed to purge notebooks: %v", err)
+	}
+	if notebooks > 0 {
+		log.Printf("Purged %d expired notebooks from trash", notebooks)
+	}
+
+	// files of every note deleted for good, by the purge above or by a user
+	attachments, err := p.attachments.PurgeOrphans(context.Background())
+	if err != nil {
+		log.Printf("Failed to purge attachments: %v", err)
+	}
+	if attachments > 0 {
+		log.Printf("Purged %d attachments of deleted notes", attachments)
+	}
+
+	// kept off the request path, a user may go over the cap until the next round
+	if err := p.notes.PruneRevisions(); err != nil {
+		log.Printf("Failed to prune revisions: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"errors"
+	"time"
 
 	"github.com/dassajib/prohor-api/internal/model"
 	"github.com/dassajib/prohor-api/internal/pkg/utils"
@@ -9,21 +10,30 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// errors returned by Refresh, handler maps them to 401
+var (
+	ErrInvalidRefreshToken = errors.New("Invalid refresh token.")
+	ErrRefreshTokenReused  = errors.New("Refresh token reuse detected.")
+)
+
 // UserService defines the methods that user-related services must implement.
 type UserService interface {
 	Register(username, email, password, confirmPassword string) error
 	Login(email, password string) (string, string, error)
+	Refresh(refreshToken string) (string, string, error)
+	Logout(userID uint, refreshToken string) error
 }
 
 // userService provides implementation of the UserService interface.
 type userService struct {
-	repo repository.UserRepository
+	repo   repository.UserRepository
+	tokens repository.RefreshTokenRepository
 }
 
 // constructor func
 // NewUserService creates and returns a new UserService instance.
-func NewUserService(repo repository.UserRepository) userService {
-	return userService{repo: repo}
+func NewUserService(repo repository.UserRepository, tokens repository.RefreshTokenRepository) userService {
+	return userService{repo: repo, tokens: tokens}
 }
 
 // receiver func for registration logic, validation and db operation
@@ -67,9 +77,97 @@ func (s *userService) Login(email, password string) (string, string, error) {
 		return "", "", errors.New("Wrong password.")
 	}
 
+	// every login starts a new refresh token family
+	familyID, err := utils.NewTokenID()
+	if err != nil {
+		return "", "", err
+	}
+
 	// generate access and refresh tokens
-	accessToken, _ := utils.GenerateAccessToken(user.ID)
-	refreshToken, _ := utils.GenerateRefreshToken(user.ID)
+	return s.issueTokens(user.ID, familyID)
+}
+
+// exchange a refresh token for a new pair, the old one can't be used again
+func (s *userService) Refresh(refreshToken string) (string, string, error) {
+	// verify signature and expiry
+	claims, err := utils.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	// token must be one we issued to the same user
+	stored, err := s.tokens.FindByTokenID(claims.TokenID)
+	if err != nil || stored.UserID != claims.UserID {
+		return "", "", ErrInvalidRefreshToken
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return "", "", ErrInvalidRefreshToken
+	}
+
+	// an already rotated token is being replayed, someone else may hold a copy
+	// so the whole family is revoked and the user has to log in again
+	if stored.RotatedAt != nil {
+		if err := s.tokens.RevokeFamily(stored.FamilyID); err != nil {
+			return "", "", err
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+
+	// lost the race against a concurrent refresh with the same token, treat as reuse
+	rotated, err := s.tokens.MarkRotated(stored.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if !rotated {
+		if err := s.tokens.RevokeFamily(stored.FamilyID); err != nil {
+			return "", "", err
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+
+	return s.issueTokens(stored.UserID, stored.FamilyID)
+}
+
+// revokes the family of the given refresh token, if it belongs to the user
+func (s *userService) Logout(userID uint, refreshToken string) error {
+	claims, err := utils.ParseRefreshToken(refreshToken)
+	if err != nil {
+		return ErrInvalidRefreshToken
+	}
+
+	stored, err := s.tokens.FindByTokenID(claims.TokenID)
+	if err != nil || stored.UserID != userID {
+		return ErrInvalidRefreshToken
+	}
+
+	return s.tokens.RevokeFamily(stored.FamilyID)
+}
+
+// generates access and refresh tokens and persists the refresh token in its family
+func (s *userService) issueTokens(userID uint, familyID string) (string, string, error) {
+	accessToken, err := utils.GenerateAccessToken(userID)
+	if err != nil {
+		return "", "", err
+	}
+
+	tokenID, err := utils.NewTokenID()
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := utils.GenerateRefreshToken(userID, tokenID)
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.tokens.Create(&model.RefreshToken{
+		UserID:    userID,
+		TokenID:   tokenID,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
 
 	// return generated tokens
 	return accessToken, refreshToken, nil